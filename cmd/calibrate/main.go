@@ -0,0 +1,176 @@
+// Command calibrate bewertet einen Korpus von Referenzlösungen mit bekannter Qualität und
+// berichtet Notenfehler, Abweichung je Level und Streuung zwischen Durchläufen. Mit
+// -prompt-b oder -models-b werden zwei Varianten nebeneinander verglichen.
+//
+//	go run ./cmd/calibrate -runs 3 -prompt-b neuer_prompt.txt
+//
+// Für ein lokales Modell mit OpenAI-kompatibler Schnittstelle OPENAI_BASE_URL setzen.
+package main
+
+import (
+	"api-test/handlers"
+	"api-test/models"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/joho/godotenv"
+)
+
+func loadCorpus(path string) (models.CalibrationCorpus, error) {
+	var corpus models.CalibrationCorpus
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return corpus, err
+	}
+	if err := json.Unmarshal(data, &corpus); err != nil {
+		return corpus, fmt.Errorf("%s: %w", path, err)
+	}
+	return corpus, nil
+}
+
+func variant(label, promptFile, modelList string, base models.CalibrationConfig) (models.CalibrationConfig, error) {
+	cfg := base
+	cfg.Label = label
+
+	if modelList != "" {
+		cfg.Models = nil
+		for _, m := range strings.Split(modelList, ",") {
+			if m = strings.TrimSpace(m); m != "" {
+				cfg.Models = append(cfg.Models, m)
+			}
+		}
+	}
+
+	if promptFile != "" {
+		data, err := os.ReadFile(promptFile)
+		if err != nil {
+			return cfg, err
+		}
+		cfg.Prompt = string(data)
+		cfg.PromptName = filepath.Base(promptFile)
+	}
+	return cfg, nil
+}
+
+func printReports(corpus models.CalibrationCorpus, reports []models.CalibrationReport) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	defer w.Flush()
+
+	fmt.Fprintf(w, "Korpus %s, %d Fälle\n\n", corpus.Version, len(corpus.Cases))
+
+	fmt.Fprint(w, "Variante\tPrompt\tModelle\tStichproben\tDurchläufe\tMAE\tBias\tTreffer\tStreuung\tFehler\n")
+	for _, r := range reports {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%d\t%.2f\t%+.2f\t%.0f%%\t%.2f\t%d\n",
+			r.Config.Label, r.Config.PromptName, strings.Join(r.Config.Models, ","), r.Config.Samples,
+			r.Config.Runs, r.Overall.MAE, r.Overall.Bias, r.Overall.HitRate*100, r.Overall.StdDev, r.Overall.Failures)
+	}
+
+	var levels []string
+	for level := range reports[0].Levels {
+		levels = append(levels, level)
+	}
+	sort.Strings(levels)
+
+	fmt.Fprint(w, "\nLevel")
+	for _, r := range reports {
+		fmt.Fprintf(w, "\tBias %s\tMAE %s", r.Config.Label, r.Config.Label)
+	}
+	fmt.Fprintln(w)
+	for _, level := range levels {
+		fmt.Fprint(w, level)
+		for _, r := range reports {
+			fmt.Fprintf(w, "\t%+.2f\t%.2f", r.Levels[level].Bias, r.Levels[level].MAE)
+		}
+		fmt.Fprintln(w)
+	}
+
+	fmt.Fprint(w, "\nFall\tErwartet")
+	for _, r := range reports {
+		fmt.Fprintf(w, "\tNoten %s\tFehler %s", r.Config.Label, r.Config.Label)
+	}
+	fmt.Fprintln(w)
+	for i, c := range reports[0].Cases {
+		fmt.Fprintf(w, "%s\t%.1f–%.1f", c.ID, c.Expected[0], c.Expected[1])
+		for _, r := range reports {
+			var marks []string
+			for _, m := range r.Cases[i].Marks {
+				marks = append(marks, fmt.Sprintf("%.1f", m))
+			}
+			fmt.Fprintf(w, "\t%s\t%+.2f", strings.Join(marks, " "), r.Cases[i].Error)
+		}
+		fmt.Fprintln(w)
+	}
+}
+
+func main() {
+	corpusPath := flag.String("corpus", "calibration/corpus.json", "Pfad zum Kalibrierungskorpus")
+	runs := flag.Int("runs", 3, "Durchläufe je Fall")
+	samples := flag.Int("samples", 1, "Stichproben je Bewertung")
+	aggregate := flag.String("aggregate", "median", "Aggregation der Stichproben (median, trimmed_mean)")
+	temperature := flag.Float64("temperature", 0, "Temperatur, 0 für den Standardwert")
+	modelList := flag.String("models", "", "Modelle der Variante A, kommagetrennt")
+	promptFile := flag.String("prompt", "", "Prompt-Vorlage der Variante A, sonst der aktuelle Prompt")
+	modelListB := flag.String("models-b", "", "Modelle der Variante B, kommagetrennt")
+	promptFileB := flag.String("prompt-b", "", "Prompt-Vorlage der Variante B")
+	out := flag.String("out", "", "Bericht zusätzlich als JSON schreiben")
+	flag.Parse()
+
+	if err := godotenv.Load(); err != nil {
+		log.Println("Keine .env Datei gefunden")
+	}
+
+	corpus, err := loadCorpus(*corpusPath)
+	if err != nil {
+		log.Fatalf("Korpus konnte nicht geladen werden: %v", err)
+	}
+
+	base := models.CalibrationConfig{
+		Samples:     *samples,
+		Aggregate:   *aggregate,
+		Temperature: float32(*temperature),
+		Runs:        *runs,
+	}
+
+	a, err := variant("A", *promptFile, *modelList, base)
+	if err != nil {
+		log.Fatalf("Variante A: %v", err)
+	}
+	configs := []models.CalibrationConfig{a}
+
+	if *promptFileB != "" || *modelListB != "" {
+		b, err := variant("B", *promptFileB, *modelListB, a)
+		if err != nil {
+			log.Fatalf("Variante B: %v", err)
+		}
+		configs = append(configs, b)
+	}
+
+	var reports []models.CalibrationReport
+	for _, cfg := range configs {
+		report, err := handlers.RunCalibration(corpus, cfg)
+		if err != nil {
+			log.Fatalf("Kalibrierung fehlgeschlagen: %v", err)
+		}
+		reports = append(reports, report)
+	}
+
+	printReports(corpus, reports)
+
+	if *out != "" {
+		data, err := json.MarshalIndent(reports, "", "  ")
+		if err != nil {
+			log.Fatalf("Bericht konnte nicht erstellt werden: %v", err)
+		}
+		if err := os.WriteFile(*out, data, 0o644); err != nil {
+			log.Fatalf("Bericht konnte nicht geschrieben werden: %v", err)
+		}
+	}
+}
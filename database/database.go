@@ -1,6 +1,7 @@
 package database
 
 import (
+	"fmt"
 	"log"
 	"os"
 
@@ -33,8 +34,19 @@ func InitDB() {
 		CREATE TABLE IF NOT EXISTS users (
 			id INTEGER PRIMARY KEY AUTOINCREMENT,
 			username TEXT NOT NULL UNIQUE,
-			password TEXT
+			password TEXT,
+			role TEXT NOT NULL DEFAULT 'student'
 		);
+
+		CREATE TABLE IF NOT EXISTS auth_tokens (
+			token_hash TEXT PRIMARY KEY,
+			user_id INTEGER NOT NULL,
+			created_at INTEGER NOT NULL,
+			expires_at INTEGER NOT NULL,
+			FOREIGN KEY (user_id) REFERENCES users(id)
+		);
+
+		CREATE INDEX IF NOT EXISTS idx_auth_tokens_user ON auth_tokens (user_id);
 		
 		CREATE TABLE IF NOT EXISTS tasks (
 			id INTEGER PRIMARY KEY AUTOINCREMENT,
@@ -43,7 +55,23 @@ func InitDB() {
 			language TEXT,
 			level TEXT,
 			time_estimated INTEGER,
-			FOREIGN KEY (user_id) REFERENCES users(id)
+			time_limit INTEGER,
+			catalog_task_id INTEGER,
+			similarity REAL,
+			topic TEXT,
+			assignment_id INTEGER,
+			multi_file INTEGER NOT NULL DEFAULT 0,
+			task_type TEXT NOT NULL DEFAULT 'write',
+			starter_code TEXT,
+			answer_key TEXT,
+			entry_points TEXT,
+			tests TEXT,
+			reference_solution TEXT,
+			user_provided INTEGER NOT NULL DEFAULT 0,
+			source_text TEXT,
+			FOREIGN KEY (user_id) REFERENCES users(id),
+			FOREIGN KEY (catalog_task_id) REFERENCES catalog_tasks(id),
+			FOREIGN KEY (assignment_id) REFERENCES assignments(id)
 		);
 		
 		CREATE TABLE IF NOT EXISTS solutions (
@@ -55,6 +83,25 @@ func InitDB() {
 			ai_usage INTEGER,
 			chat TEXT,
 			time_spent INTEGER,
+			raw_mark REAL,
+			late_penalty REAL,
+			created_at INTEGER,
+			ai_mark REAL,
+			graded_by INTEGER,
+			graded_at INTEGER,
+			samples INTEGER,
+			mark_spread REAL,
+			confidence REAL,
+			needs_review INTEGER NOT NULL DEFAULT 0,
+			reference_solution TEXT,
+			ai_reliance REAL,
+			tutor_overlap REAL,
+			paste_overlap REAL,
+			reference_overlap REAL,
+			code_lines INTEGER,
+			complexity INTEGER,
+			max_nesting INTEGER,
+			analysis_tools TEXT,
 			FOREIGN KEY (task_id) REFERENCES tasks(id)
 		);
 		
@@ -72,15 +119,539 @@ func InitDB() {
 			time_remaining INTEGER,
 			time_spent INTEGER,
 			category_id INTEGER,
+			code TEXT,
+			selection TEXT,
+			run_output TEXT,
+			created_at INTEGER,
 			FOREIGN KEY (user_id) REFERENCES users(id),
 			FOREIGN KEY (task_id) REFERENCES tasks(id),
 			FOREIGN KEY (category_id) REFERENCES categories(id)
 		);
+
+		CREATE TABLE IF NOT EXISTS code_snapshots (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			user_id INTEGER NOT NULL,
+			task_id INTEGER NOT NULL,
+			kind TEXT NOT NULL,
+			content TEXT NOT NULL,
+			length INTEGER NOT NULL,
+			event TEXT,
+			created_at INTEGER NOT NULL,
+			FOREIGN KEY (user_id) REFERENCES users(id),
+			FOREIGN KEY (task_id) REFERENCES tasks(id)
+		);
+
+		CREATE INDEX IF NOT EXISTS idx_code_snapshots_task ON code_snapshots(task_id, created_at);
+
+		CREATE TABLE IF NOT EXISTS catalog_tasks (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			description TEXT NOT NULL,
+			language TEXT NOT NULL,
+			level TEXT NOT NULL,
+			time_estimated INTEGER,
+			source TEXT NOT NULL,
+			source_task_id INTEGER,
+			created_at INTEGER NOT NULL,
+			FOREIGN KEY (source_task_id) REFERENCES tasks(id)
+		);
+
+		CREATE TABLE IF NOT EXISTS topics (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			name TEXT NOT NULL UNIQUE
+		);
+
+		CREATE TABLE IF NOT EXISTS catalog_task_topics (
+			catalog_task_id INTEGER NOT NULL,
+			topic_id INTEGER NOT NULL,
+			PRIMARY KEY (catalog_task_id, topic_id),
+			FOREIGN KEY (catalog_task_id) REFERENCES catalog_tasks(id),
+			FOREIGN KEY (topic_id) REFERENCES topics(id)
+		);
+
+		CREATE TABLE IF NOT EXISTS skill_ratings (
+			user_id INTEGER NOT NULL,
+			language TEXT NOT NULL,
+			topic TEXT NOT NULL DEFAULT '',
+			rating REAL NOT NULL,
+			rd REAL NOT NULL,
+			solutions INTEGER NOT NULL DEFAULT 0,
+			updated_at INTEGER NOT NULL,
+			PRIMARY KEY (user_id, language, topic),
+			FOREIGN KEY (user_id) REFERENCES users(id)
+		);
+
+		CREATE TABLE IF NOT EXISTS skill_rating_history (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			user_id INTEGER NOT NULL,
+			language TEXT NOT NULL,
+			topic TEXT NOT NULL DEFAULT '',
+			task_id INTEGER,
+			solution_id INTEGER,
+			quiz_id INTEGER,
+			task_rating REAL NOT NULL,
+			outcome REAL NOT NULL,
+			expected REAL NOT NULL,
+			rating_before REAL NOT NULL,
+			rd_before REAL NOT NULL,
+			rating REAL NOT NULL,
+			rd REAL NOT NULL,
+			created_at INTEGER NOT NULL,
+			FOREIGN KEY (user_id) REFERENCES users(id),
+			FOREIGN KEY (task_id) REFERENCES tasks(id),
+			FOREIGN KEY (solution_id) REFERENCES solutions(id),
+			FOREIGN KEY (quiz_id) REFERENCES quizzes(id)
+		);
+
+		CREATE INDEX IF NOT EXISTS idx_skill_rating_history_user ON skill_rating_history(user_id, language, topic, id);
+
+		CREATE TABLE IF NOT EXISTS review_items (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			user_id INTEGER NOT NULL,
+			language TEXT NOT NULL,
+			topic TEXT NOT NULL DEFAULT '',
+			catalog_task_id INTEGER NOT NULL DEFAULT 0,
+			level TEXT,
+			easiness REAL NOT NULL,
+			interval_days INTEGER NOT NULL,
+			repetitions INTEGER NOT NULL,
+			last_quality INTEGER NOT NULL,
+			last_task_id INTEGER,
+			due_at INTEGER NOT NULL,
+			updated_at INTEGER NOT NULL,
+			UNIQUE (user_id, language, topic, catalog_task_id),
+			FOREIGN KEY (user_id) REFERENCES users(id)
+		);
+
+		CREATE TABLE IF NOT EXISTS learning_paths (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			language TEXT NOT NULL,
+			title TEXT NOT NULL,
+			description TEXT,
+			created_at INTEGER NOT NULL
+		);
+
+		CREATE TABLE IF NOT EXISTS path_modules (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			path_id INTEGER NOT NULL,
+			position INTEGER NOT NULL,
+			title TEXT NOT NULL,
+			description TEXT,
+			target_level TEXT NOT NULL,
+			FOREIGN KEY (path_id) REFERENCES learning_paths(id)
+		);
+
+		CREATE TABLE IF NOT EXISTS path_module_topics (
+			module_id INTEGER NOT NULL,
+			topic_id INTEGER NOT NULL,
+			PRIMARY KEY (module_id, topic_id),
+			FOREIGN KEY (module_id) REFERENCES path_modules(id),
+			FOREIGN KEY (topic_id) REFERENCES topics(id)
+		);
+
+		CREATE TABLE IF NOT EXISTS path_module_tasks (
+			module_id INTEGER NOT NULL,
+			catalog_task_id INTEGER NOT NULL,
+			PRIMARY KEY (module_id, catalog_task_id),
+			FOREIGN KEY (module_id) REFERENCES path_modules(id),
+			FOREIGN KEY (catalog_task_id) REFERENCES catalog_tasks(id)
+		);
+
+		CREATE TABLE IF NOT EXISTS path_module_prerequisites (
+			module_id INTEGER NOT NULL,
+			prerequisite_id INTEGER NOT NULL,
+			PRIMARY KEY (module_id, prerequisite_id),
+			FOREIGN KEY (module_id) REFERENCES path_modules(id),
+			FOREIGN KEY (prerequisite_id) REFERENCES path_modules(id)
+		);
+
+		CREATE TABLE IF NOT EXISTS courses (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			name TEXT NOT NULL,
+			description TEXT,
+			teacher_id INTEGER NOT NULL,
+			invite_code TEXT NOT NULL UNIQUE,
+			created_at INTEGER NOT NULL,
+			FOREIGN KEY (teacher_id) REFERENCES users(id)
+		);
+
+		CREATE TABLE IF NOT EXISTS course_members (
+			course_id INTEGER NOT NULL,
+			user_id INTEGER NOT NULL,
+			role TEXT NOT NULL,
+			joined_at INTEGER NOT NULL,
+			PRIMARY KEY (course_id, user_id),
+			FOREIGN KEY (course_id) REFERENCES courses(id),
+			FOREIGN KEY (user_id) REFERENCES users(id)
+		);
+
+		CREATE INDEX IF NOT EXISTS idx_course_members_user ON course_members (user_id);
+
+		CREATE TABLE IF NOT EXISTS assignments (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			course_id INTEGER NOT NULL,
+			catalog_task_id INTEGER,
+			title TEXT NOT NULL,
+			description TEXT NOT NULL,
+			language TEXT NOT NULL,
+			level TEXT NOT NULL,
+			time_estimated INTEGER,
+			time_limit INTEGER,
+			open_at INTEGER NOT NULL,
+			due_at INTEGER NOT NULL,
+			ai_policy TEXT NOT NULL DEFAULT 'allowed',
+			max_attempts INTEGER NOT NULL DEFAULT 0,
+			late_penalty REAL NOT NULL DEFAULT 0,
+			late_days INTEGER NOT NULL DEFAULT 0,
+			created_at INTEGER NOT NULL,
+			FOREIGN KEY (course_id) REFERENCES courses(id),
+			FOREIGN KEY (catalog_task_id) REFERENCES catalog_tasks(id)
+		);
+
+		CREATE INDEX IF NOT EXISTS idx_assignments_course ON assignments (course_id);
+
+		CREATE TABLE IF NOT EXISTS grade_changes (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			solution_id INTEGER NOT NULL,
+			source TEXT NOT NULL,
+			changed_by INTEGER,
+			previous_mark REAL,
+			mark REAL NOT NULL,
+			reason TEXT NOT NULL,
+			created_at INTEGER NOT NULL,
+			FOREIGN KEY (solution_id) REFERENCES solutions(id),
+			FOREIGN KEY (changed_by) REFERENCES users(id)
+		);
+
+		CREATE INDEX IF NOT EXISTS idx_grade_changes_solution ON grade_changes (solution_id);
+
+		CREATE TABLE IF NOT EXISTS solution_comments (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			solution_id INTEGER NOT NULL,
+			author_id INTEGER NOT NULL,
+			start_line INTEGER NOT NULL,
+			end_line INTEGER NOT NULL,
+			body TEXT NOT NULL,
+			created_at INTEGER NOT NULL,
+			FOREIGN KEY (solution_id) REFERENCES solutions(id),
+			FOREIGN KEY (author_id) REFERENCES users(id)
+		);
+
+		CREATE INDEX IF NOT EXISTS idx_solution_comments_solution ON solution_comments (solution_id);
+
+		CREATE TABLE IF NOT EXISTS appeals (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			solution_id INTEGER NOT NULL,
+			user_id INTEGER NOT NULL,
+			justification TEXT NOT NULL,
+			status TEXT NOT NULL,
+			previous_mark REAL,
+			regrade_mark REAL,
+			regrade_spread REAL,
+			regrade_samples INTEGER NOT NULL DEFAULT 0,
+			response TEXT,
+			resolved_by INTEGER,
+			resolved_mark REAL,
+			created_at INTEGER NOT NULL,
+			updated_at INTEGER NOT NULL,
+			FOREIGN KEY (solution_id) REFERENCES solutions(id),
+			FOREIGN KEY (user_id) REFERENCES users(id),
+			FOREIGN KEY (resolved_by) REFERENCES users(id)
+		);
+
+		CREATE INDEX IF NOT EXISTS idx_appeals_status ON appeals (status);
+
+		CREATE TABLE IF NOT EXISTS notifications (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			user_id INTEGER NOT NULL,
+			kind TEXT NOT NULL,
+			reference_id INTEGER,
+			message TEXT NOT NULL,
+			created_at INTEGER NOT NULL,
+			read_at INTEGER,
+			FOREIGN KEY (user_id) REFERENCES users(id)
+		);
+
+		CREATE INDEX IF NOT EXISTS idx_notifications_user ON notifications (user_id, read_at);
+
+		CREATE TABLE IF NOT EXISTS evaluation_settings (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			course_id INTEGER NOT NULL DEFAULT 0,
+			level TEXT NOT NULL DEFAULT '',
+			samples INTEGER NOT NULL,
+			models TEXT NOT NULL,
+			aggregate TEXT NOT NULL,
+			review_threshold REAL NOT NULL,
+			updated_at INTEGER NOT NULL,
+			UNIQUE (course_id, level)
+		);
+
+		CREATE TABLE IF NOT EXISTS evaluation_samples (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			solution_id INTEGER NOT NULL,
+			model TEXT NOT NULL,
+			mark REAL NOT NULL,
+			FOREIGN KEY (solution_id) REFERENCES solutions(id)
+		);
+
+		CREATE INDEX IF NOT EXISTS idx_evaluation_samples_solution ON evaluation_samples (solution_id);
+
+		CREATE TABLE IF NOT EXISTS similarity_flags (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			solution_id INTEGER NOT NULL,
+			other_solution_id INTEGER,
+			kind TEXT NOT NULL,
+			similarity REAL NOT NULL,
+			created_at INTEGER NOT NULL,
+			FOREIGN KEY (solution_id) REFERENCES solutions(id),
+			FOREIGN KEY (other_solution_id) REFERENCES solutions(id)
+		);
+
+		CREATE INDEX IF NOT EXISTS idx_similarity_flags_solution ON similarity_flags (solution_id);
+
+		CREATE TABLE IF NOT EXISTS solution_diagnostics (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			solution_id INTEGER NOT NULL,
+			tool TEXT NOT NULL,
+			file TEXT NOT NULL DEFAULT '',
+			line INTEGER NOT NULL,
+			col INTEGER NOT NULL DEFAULT 0,
+			severity TEXT NOT NULL,
+			message TEXT NOT NULL,
+			FOREIGN KEY (solution_id) REFERENCES solutions(id)
+		);
+
+		CREATE INDEX IF NOT EXISTS idx_solution_diagnostics_solution ON solution_diagnostics (solution_id);
+
+		CREATE TABLE IF NOT EXISTS solution_files (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			solution_id INTEGER NOT NULL,
+			path TEXT NOT NULL,
+			content TEXT NOT NULL,
+			size INTEGER NOT NULL,
+			UNIQUE (solution_id, path),
+			FOREIGN KEY (solution_id) REFERENCES solutions(id)
+		);
+
+		CREATE TABLE IF NOT EXISTS quizzes (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			user_id INTEGER NOT NULL,
+			language TEXT NOT NULL,
+			level TEXT NOT NULL,
+			topic TEXT NOT NULL DEFAULT '',
+			created_at INTEGER NOT NULL,
+			submitted_at INTEGER,
+			correct INTEGER,
+			score REAL,
+			mark REAL,
+			FOREIGN KEY (user_id) REFERENCES users(id)
+		);
+
+		CREATE INDEX IF NOT EXISTS idx_quizzes_user ON quizzes (user_id, language);
+
+		CREATE TABLE IF NOT EXISTS quiz_questions (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			quiz_id INTEGER NOT NULL,
+			position INTEGER NOT NULL,
+			kind TEXT NOT NULL,
+			question TEXT NOT NULL,
+			options TEXT NOT NULL DEFAULT '[]',
+			correct_option INTEGER,
+			answers TEXT NOT NULL DEFAULT '[]',
+			explanation TEXT NOT NULL,
+			answer TEXT,
+			is_correct INTEGER,
+			FOREIGN KEY (quiz_id) REFERENCES quizzes(id)
+		);
+
+		CREATE TABLE IF NOT EXISTS task_session_events (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			task_id INTEGER NOT NULL,
+			user_id INTEGER NOT NULL,
+			state TEXT NOT NULL,
+			auto INTEGER NOT NULL DEFAULT 0,
+			created_at INTEGER NOT NULL,
+			FOREIGN KEY (user_id) REFERENCES users(id),
+			FOREIGN KEY (task_id) REFERENCES tasks(id)
+		);
+
+		CREATE TABLE IF NOT EXISTS rate_limits (
+			key TEXT PRIMARY KEY,
+			count INTEGER NOT NULL,
+			expires_at INTEGER NOT NULL
+		);
+
+		CREATE TABLE IF NOT EXISTS login_attempts (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			username TEXT NOT NULL,
+			user_id INTEGER,
+			ip TEXT NOT NULL,
+			success INTEGER NOT NULL,
+			reason TEXT NOT NULL,
+			created_at INTEGER NOT NULL
+		);
+
+		CREATE INDEX IF NOT EXISTS idx_login_attempts_username ON login_attempts (username, created_at);
+		CREATE INDEX IF NOT EXISTS idx_login_attempts_ip ON login_attempts (ip, created_at);
+
+		CREATE TABLE IF NOT EXISTS login_challenges (
+			challenge TEXT PRIMARY KEY,
+			expires_at INTEGER NOT NULL
+		);
+
+		CREATE TABLE IF NOT EXISTS generated_tasks (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			user_id INTEGER NOT NULL,
+			task_type TEXT NOT NULL,
+			multi_file INTEGER NOT NULL DEFAULT 0,
+			starter_code TEXT,
+			answer_key TEXT,
+			entry_points TEXT,
+			reference_solution TEXT,
+			created_at INTEGER NOT NULL,
+			FOREIGN KEY (user_id) REFERENCES users(id)
+		);
 	`
 
+	if err := renameLegacyRatingHistory(); err != nil {
+		log.Fatalf("Failed to migrate skill_rating_history: %v", err)
+	}
+
 	if _, err := DB.Exec(schema); err != nil {
 		log.Fatal(err)
 	}
 
+	migrations := []struct {
+		table      string
+		column     string
+		definition string
+	}{
+		{"users", "role", "TEXT NOT NULL DEFAULT 'student'"},
+		{"interactions", "code", "TEXT"},
+		{"interactions", "selection", "TEXT"},
+		{"interactions", "run_output", "TEXT"},
+		{"interactions", "created_at", "INTEGER"},
+		{"tasks", "time_limit", "INTEGER"},
+		{"tasks", "catalog_task_id", "INTEGER"},
+		{"tasks", "similarity", "REAL"},
+		{"tasks", "topic", "TEXT"},
+		{"tasks", "assignment_id", "INTEGER"},
+		{"solutions", "raw_mark", "REAL"},
+		{"solutions", "late_penalty", "REAL"},
+		{"solutions", "created_at", "INTEGER"},
+		{"solutions", "ai_mark", "REAL"},
+		{"solutions", "graded_by", "INTEGER"},
+		{"solutions", "graded_at", "INTEGER"},
+		{"solutions", "samples", "INTEGER"},
+		{"solutions", "mark_spread", "REAL"},
+		{"solutions", "confidence", "REAL"},
+		{"solutions", "needs_review", "INTEGER NOT NULL DEFAULT 0"},
+		{"solutions", "reference_solution", "TEXT"},
+		{"solutions", "ai_reliance", "REAL"},
+		{"solutions", "tutor_overlap", "REAL"},
+		{"solutions", "paste_overlap", "REAL"},
+		{"solutions", "reference_overlap", "REAL"},
+		{"solutions", "code_lines", "INTEGER"},
+		{"solutions", "complexity", "INTEGER"},
+		{"solutions", "max_nesting", "INTEGER"},
+		{"solutions", "analysis_tools", "TEXT"},
+		{"solution_diagnostics", "file", "TEXT NOT NULL DEFAULT ''"},
+		{"tasks", "multi_file", "INTEGER NOT NULL DEFAULT 0"},
+		{"tasks", "task_type", "TEXT NOT NULL DEFAULT 'write'"},
+		{"tasks", "starter_code", "TEXT"},
+		{"tasks", "answer_key", "TEXT"},
+		{"tasks", "entry_points", "TEXT"},
+		{"tasks", "tests", "TEXT"},
+		{"tasks", "user_provided", "INTEGER NOT NULL DEFAULT 0"},
+		{"tasks", "source_text", "TEXT"},
+		{"skill_rating_history", "quiz_id", "INTEGER"},
+		{"catalog_tasks", "task_type", "TEXT NOT NULL DEFAULT 'write'"},
+		{"catalog_tasks", "starter_code", "TEXT"},
+		{"catalog_tasks", "answer_key", "TEXT"},
+		{"catalog_tasks", "entry_points", "TEXT"},
+		{"catalog_tasks", "tests", "TEXT"},
+		{"catalog_tasks", "multi_file", "INTEGER NOT NULL DEFAULT 0"},
+		{"tasks", "evaluating_since", "INTEGER"},
+		{"tasks", "reference_solution", "TEXT"},
+		{"catalog_tasks", "reference_solution", "TEXT"},
+		{"generated_tasks", "reference_solution", "TEXT"},
+	}
+
+	for _, m := range migrations {
+		if err := addColumnIfMissing(m.table, m.column, m.definition); err != nil {
+			log.Fatalf("Failed to migrate %s.%s: %v", m.table, m.column, err)
+		}
+	}
+
+	if err := copyLegacyRatingHistory(); err != nil {
+		log.Fatalf("Failed to migrate skill_rating_history: %v", err)
+	}
+
 	log.Println("Database connected and schema initialized successfully.")
 }
+
+func addColumnIfMissing(table, column, definition string) error {
+	var count int
+	err := DB.Get(&count, "SELECT COUNT(*) FROM pragma_table_info(?) WHERE name = ?", table, column)
+	if err != nil {
+		return err
+	}
+
+	if count > 0 {
+		return nil
+	}
+
+	_, err = DB.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition))
+	return err
+}
+
+// renameLegacyRatingHistory legt eine skill_rating_history beiseite, in der task_id und
+// solution_id noch NOT NULL sind. SQLite kann das nicht per ALTER TABLE ändern, das Schema
+// legt die Tabelle deshalb neu an und copyLegacyRatingHistory übernimmt die Einträge.
+func renameLegacyRatingHistory() error {
+	var notNull int
+	err := DB.Get(&notNull, `
+		SELECT COUNT(*) FROM pragma_table_info('skill_rating_history')
+		WHERE name IN ('task_id', 'solution_id') AND "notnull" = 1`)
+	if err != nil || notNull == 0 {
+		return err
+	}
+
+	_, err = DB.Exec(`
+		DROP INDEX IF EXISTS idx_skill_rating_history_user;
+		ALTER TABLE skill_rating_history RENAME TO skill_rating_history_legacy;`)
+	return err
+}
+
+// copyLegacyRatingHistory übernimmt die Einträge der beiseitegelegten Tabelle. Quizze
+// hatten dort Aufgabe und Lösung 0 und erhalten NULL.
+func copyLegacyRatingHistory() error {
+	var exists int
+	err := DB.Get(&exists, "SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'skill_rating_history_legacy'")
+	if err != nil || exists == 0 {
+		return err
+	}
+	if err := addColumnIfMissing("skill_rating_history_legacy", "quiz_id", "INTEGER"); err != nil {
+		return err
+	}
+
+	tx, err := DB.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+		INSERT INTO skill_rating_history (id, user_id, language, topic, task_id, solution_id, quiz_id, task_rating,
+			outcome, expected, rating_before, rd_before, rating, rd, created_at)
+		SELECT id, user_id, language, topic, NULLIF(task_id, 0), NULLIF(solution_id, 0), quiz_id, task_rating,
+			outcome, expected, rating_before, rd_before, rating, rd, created_at
+		FROM skill_rating_history_legacy`)
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec("DROP TABLE skill_rating_history_legacy"); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,425 @@
+package handlers
+
+import (
+	"api-test/database"
+	"api-test/models"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jmoiron/sqlx"
+)
+
+const (
+	analyzerTimeout  = 10 * time.Second
+	maxDiagnostics   = 50
+	maxLineLength    = 120
+	maxNestingDepth  = 4
+	maxComplexity    = 15
+	maxCodeLines     = 300
+	severityError    = "error"
+	severityWarning  = "warning"
+	severityInfo     = "info"
+	builtinAnalyzer  = "metrics"
+	analysisFileName = "main"
+)
+
+// Ein analyzer prüft Code mit einem lokal installierten Werkzeug. Ist das Werkzeug
+// nicht vorhanden, wird es übersprungen. Files sind die Konfigurationsdateien des
+// Werkzeugs, Reserved die Dateinamen, die es selbst als Konfiguration lesen würde.
+type analyzer struct {
+	Name      string
+	Command   string
+	Extension string
+	Files     map[string]string
+	Reserved  []string
+	Args      func(configDir string, files []string) []string
+	Env       []string
+}
+
+// analyzers ordnet den Sprachen die externen Werkzeuge zu. Neue Werkzeuge werden hier
+// eingetragen, die eingebauten Metriken laufen für jede Sprache.
+var analyzers = map[string][]analyzer{
+	"go": {{
+		Name:      "go vet",
+		Command:   "go",
+		Extension: ".go",
+		Files:     map[string]string{"go.mod": "module analysis\n\ngo 1.21\n"},
+		Reserved:  []string{"go.mod", "go.work"},
+		Args:      func(string, []string) []string { return []string{"vet", "./..."} },
+		Env: []string{"CGO_ENABLED=0", "GOPROXY=off", "GOFLAGS=-mod=mod", "GOTOOLCHAIN=local", "GOWORK=off",
+			"GOCACHE=" + filepath.Join(os.TempDir(), "analysis-gocache")},
+	}},
+	"python": {{
+		Name:      "pyflakes",
+		Command:   "pyflakes",
+		Extension: ".py",
+		Args:      func(_ string, files []string) []string { return files },
+	}},
+	"javascript": {{
+		Name:      "eslint",
+		Command:   "eslint",
+		Extension: ".js",
+		Files: map[string]string{"eslint.config.mjs": `export default [{ rules: {
+	"no-unused-vars": "warn", "no-unreachable": "warn", "no-dupe-keys": "error",
+	"no-constant-condition": "warn", "eqeqeq": "warn"
+} }];
+`},
+		Reserved: []string{"eslint.config.js", "eslint.config.mjs", "eslint.config.cjs", "eslint.config.ts",
+			"eslint.config.mts", "eslint.config.cts", ".eslintrc", ".eslintrc.js", ".eslintrc.cjs", ".eslintrc.json",
+			".eslintrc.yml", ".eslintrc.yaml", ".eslintignore"},
+		Args: func(configDir string, files []string) []string {
+			return append([]string{"--no-config-lookup", "-c", filepath.Join(configDir, "eslint.config.mjs"), "--format", "unix"}, files...)
+		},
+	}},
+}
+
+// reservedAnalysisFile meldet Dateinamen, die ein Analysewerkzeug als Konfiguration
+// laden würde. Solche Dateien werden in Abgaben nicht angenommen, da etwa eine
+// eslint-Konfiguration beliebigen Code auf dem Server ausführt.
+func reservedAnalysisFile(p string) bool {
+	base := path.Base(p)
+	for _, list := range analyzers {
+		for _, a := range list {
+			if slices.Contains(a.Reserved, base) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func analysisLanguage(language string) string {
+	switch l := strings.ToLower(strings.TrimSpace(language)); l {
+	case "golang":
+		return "go"
+	case "js", "node", "node.js":
+		return "javascript"
+	case "python3":
+		return "python"
+	default:
+		return l
+	}
+}
+
+// diagnosticLine erkennt Ausgaben der Form "datei:zeile:spalte: meldung". Fehler sind bei
+// go vet mit "vet:" eingeleitet, bei eslint mit "[Error/regel]" markiert.
+var diagnosticLine = regexp.MustCompile(`^(vet: )?([^\s:]+\.\w+):(\d+)(?::(\d+))?:?\s*(.*?)(?:\s*\[(Error|Warning)/[^\]]*\])?$`)
+
+// run schreibt die Dateien in das Unterverzeichnis src eines temporären Verzeichnisses
+// und die Konfiguration daneben, damit keine Abgabe sie ersetzen kann. Das Werkzeug
+// läuft ohne Netzwerk und ohne die Umgebungsvariablen des Servers. Eine Datei ohne Pfad
+// ist eine einzelne Abgabe und wird als main gespeichert.
+func (a analyzer) run(files []models.CodeFile) ([]models.Diagnostic, error) {
+	root, err := os.MkdirTemp("", "analysis")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(root)
+
+	dir := filepath.Join(root, "src")
+	var targets []string
+	written := map[string]bool{}
+	for _, f := range files {
+		name := f.Path
+		if name == "" {
+			name = analysisFileName + a.Extension
+		}
+		if reservedAnalysisFile(name) {
+			return nil, fmt.Errorf("%s: Datei %q nicht erlaubt", a.Name, name)
+		}
+		target := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(target), 0o700); err != nil {
+			return nil, err
+		}
+		if err := os.WriteFile(target, []byte(f.Content), 0o600); err != nil {
+			return nil, err
+		}
+		written[name] = true
+		if strings.HasSuffix(name, a.Extension) {
+			targets = append(targets, name)
+		}
+	}
+	if len(targets) == 0 {
+		return nil, nil
+	}
+
+	for name, content := range a.Files {
+		if err := os.WriteFile(filepath.Join(root, name), []byte(content), 0o600); err != nil {
+			return nil, err
+		}
+	}
+
+	tmp := filepath.Join(root, "tmp")
+	if err := os.Mkdir(tmp, 0o700); err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), analyzerTimeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, a.Command, a.Args(root, targets)...)
+	cmd.Dir = dir
+	cmd.Env = append([]string{"PATH=" + os.Getenv("PATH"), "HOME=" + root, "TMPDIR=" + tmp}, a.Env...)
+	if err := sandbox(cmd); err != nil {
+		return nil, fmt.Errorf("%s: %w", a.Name, err)
+	}
+	// Die Werkzeuge melden Befunde mit einem Exit-Code ungleich 0, entscheidend ist die Ausgabe.
+	output, err := cmd.CombinedOutput()
+	if ctx.Err() != nil {
+		return nil, fmt.Errorf("%s: Zeitlimit überschritten", a.Name)
+	}
+	var exitErr *exec.ExitError
+	if err != nil && !errors.As(err, &exitErr) {
+		return nil, fmt.Errorf("%s: %w", a.Name, err)
+	}
+
+	var diagnostics []models.Diagnostic
+	for _, line := range strings.Split(string(output), "\n") {
+		m := diagnosticLine.FindStringSubmatch(strings.TrimSpace(line))
+		if m == nil {
+			continue
+		}
+
+		file := strings.TrimPrefix(strings.TrimPrefix(filepath.ToSlash(m[2]), filepath.ToSlash(dir)+"/"), "./")
+		if !written[file] {
+			continue
+		}
+		if files[0].Path == "" {
+			file = ""
+		}
+
+		d := models.Diagnostic{Tool: a.Name, File: file, Severity: severityWarning, Message: m[5]}
+		d.Line, _ = strconv.Atoi(m[3])
+		d.Column, _ = strconv.Atoi(m[4])
+		if m[1] != "" || m[6] == "Error" {
+			d.Severity = severityError
+		}
+		diagnostics = append(diagnostics, d)
+	}
+	return diagnostics, nil
+}
+
+// measureCode ermittelt sprachunabhängige Metriken aus den normalisierten Tokens:
+// Codezeilen, eine Schätzung der zyklomatischen Komplexität und die Schachtelungstiefe,
+// bei Python über die Einrückung, sonst über geschweifte Klammern.
+func measureCode(code, language string) (models.CodeMetrics, []models.Diagnostic) {
+	var metrics models.CodeMetrics
+	var diagnostics []models.Diagnostic
+
+	tokens := tokenizeCode(code, language)
+	lines := map[int]bool{}
+	metrics.Complexity = 1
+	depth := 0
+	for i, t := range tokens {
+		lines[t.Line] = true
+
+		switch t.Text {
+		case "if", "elif", "for", "while", "case", "catch", "except", "and", "or", "?":
+			metrics.Complexity++
+		case "&", "|":
+			if i > 0 && tokens[i-1].Text == t.Text && tokens[i-1].Line == t.Line {
+				metrics.Complexity++
+			}
+		case "{":
+			depth++
+			if depth > metrics.MaxNesting {
+				metrics.MaxNesting = depth
+				metrics.MaxNestingLine = t.Line
+			}
+		case "}":
+			depth = max(depth-1, 0)
+		}
+	}
+	metrics.CodeLines = len(lines)
+
+	python := analysisLanguage(language) == "python"
+	sourceLines := strings.Split(code, "\n")
+	indentUnit := 0
+	for _, line := range sourceLines {
+		indent := len(line) - len(strings.TrimLeft(line, " "))
+		if indent > 0 && strings.TrimSpace(line) != "" && (indentUnit == 0 || indent < indentUnit) {
+			indentUnit = indent
+		}
+	}
+
+	for i, line := range sourceLines {
+		if n := utf8.RuneCountInString(line); n > maxLineLength {
+			metrics.LongLines++
+			diagnostics = append(diagnostics, models.Diagnostic{Tool: builtinAnalyzer, Line: i + 1, Severity: severityInfo,
+				Message: fmt.Sprintf("Zeile ist %d Zeichen lang (empfohlen höchstens %d)", n, maxLineLength)})
+		}
+
+		if python && lines[i+1] {
+			level := len(line) - len(strings.TrimLeft(line, "\t"))
+			if level == 0 && indentUnit > 0 {
+				level = (len(line) - len(strings.TrimLeft(line, " "))) / indentUnit
+			}
+			if level > metrics.MaxNesting {
+				metrics.MaxNesting = level
+				metrics.MaxNestingLine = i + 1
+			}
+		}
+	}
+
+	if metrics.MaxNesting > maxNestingDepth {
+		diagnostics = append(diagnostics, models.Diagnostic{Tool: builtinAnalyzer, Line: metrics.MaxNestingLine, Severity: severityWarning,
+			Message: fmt.Sprintf("Schachtelungstiefe %d (empfohlen höchstens %d)", metrics.MaxNesting, maxNestingDepth)})
+	}
+	if metrics.Complexity > maxComplexity {
+		diagnostics = append(diagnostics, models.Diagnostic{Tool: builtinAnalyzer, Line: 1, Severity: severityWarning,
+			Message: fmt.Sprintf("Geschätzte zyklomatische Komplexität %d (empfohlen höchstens %d)", metrics.Complexity, maxComplexity)})
+	}
+	if metrics.CodeLines > maxCodeLines {
+		diagnostics = append(diagnostics, models.Diagnostic{Tool: builtinAnalyzer, Line: 1, Severity: severityInfo,
+			Message: fmt.Sprintf("%d Codezeilen (empfohlen höchstens %d)", metrics.CodeLines, maxCodeLines)})
+	}
+	return metrics, diagnostics
+}
+
+func analyzeCode(code, language string) models.CodeAnalysis {
+	return analyzeFiles([]models.CodeFile{{Content: code}}, language)
+}
+
+// analyzeFiles führt die eingebauten Metriken und alle installierten Werkzeuge der Sprache
+// aus. Fehler einzelner Werkzeuge werden protokolliert und verhindern die Bewertung nicht.
+// Bei mehreren Dateien werden die Codezeilen summiert, Komplexität und Schachtelungstiefe
+// gelten für die ungünstigste Datei.
+func analyzeFiles(files []models.CodeFile, language string) models.CodeAnalysis {
+	analysis := models.CodeAnalysis{Tools: []string{builtinAnalyzer}}
+	for _, f := range files {
+		metrics, diagnostics := measureCode(f.Content, language)
+		for i := range diagnostics {
+			diagnostics[i].File = f.Path
+		}
+		analysis.Diagnostics = append(analysis.Diagnostics, diagnostics...)
+
+		analysis.Metrics.CodeLines += metrics.CodeLines
+		analysis.Metrics.LongLines += metrics.LongLines
+		analysis.Metrics.Complexity = max(analysis.Metrics.Complexity, metrics.Complexity)
+		if metrics.MaxNesting > analysis.Metrics.MaxNesting {
+			analysis.Metrics.MaxNesting = metrics.MaxNesting
+			analysis.Metrics.MaxNestingLine = metrics.MaxNestingLine
+		}
+	}
+
+	for _, a := range analyzers[analysisLanguage(language)] {
+		if _, err := exec.LookPath(a.Command); err != nil {
+			continue
+		}
+
+		diagnostics, err := a.run(files)
+		if err != nil {
+			log.Printf("analyzeCode: %s failed: %v", a.Name, err)
+			continue
+		}
+		analysis.Tools = append(analysis.Tools, a.Name)
+		analysis.Diagnostics = append(analysis.Diagnostics, diagnostics...)
+	}
+
+	if len(analysis.Diagnostics) > maxDiagnostics {
+		analysis.Diagnostics = analysis.Diagnostics[:maxDiagnostics]
+	}
+	if analysis.Diagnostics == nil {
+		analysis.Diagnostics = []models.Diagnostic{}
+	}
+	return analysis
+}
+
+// analysisFacts beschreibt die Befunde für den Bewertungsprompt.
+func analysisFacts(analysis models.CodeAnalysis) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "\nStatische Analyse (serverseitig ermittelt, verbindlich; Werkzeuge: %s):\n", strings.Join(analysis.Tools, ", "))
+	fmt.Fprintf(&b, "- Codezeilen: %d; geschätzte zyklomatische Komplexität: %d; maximale Schachtelungstiefe: %d\n",
+		analysis.Metrics.CodeLines, analysis.Metrics.Complexity, analysis.Metrics.MaxNesting)
+	if len(analysis.Diagnostics) == 0 {
+		b.WriteString("- Keine Befunde\n")
+	}
+	for _, d := range analysis.Diagnostics {
+		location := fmt.Sprintf("Zeile %d", d.Line)
+		if d.File != "" {
+			location = fmt.Sprintf("Datei %s, Zeile %d", d.File, d.Line)
+		}
+		fmt.Fprintf(&b, "- %s (%s, %s): %s\n", location, d.Tool, d.Severity, d.Message)
+	}
+	return b.String()
+}
+
+func saveDiagnostics(tx *sqlx.Tx, solutionID int64, analysis *models.CodeAnalysis) error {
+	if analysis == nil {
+		return nil
+	}
+
+	_, err := tx.Exec(`
+		UPDATE solutions SET code_lines = ?, complexity = ?, max_nesting = ?, analysis_tools = ?
+		WHERE id = ?
+	`, analysis.Metrics.CodeLines, analysis.Metrics.Complexity, analysis.Metrics.MaxNesting,
+		strings.Join(analysis.Tools, ","), solutionID)
+	if err != nil {
+		return err
+	}
+
+	for _, d := range analysis.Diagnostics {
+		_, err := tx.Exec(`
+			INSERT INTO solution_diagnostics (solution_id, tool, file, line, col, severity, message)
+			VALUES (?, ?, ?, ?, ?, ?, ?)
+		`, solutionID, d.Tool, d.File, d.Line, d.Column, d.Severity, d.Message)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func GetSolutionDiagnostics(c *gin.Context) {
+	var stored struct {
+		models.CodeMetrics
+		Tools *string `db:"analysis_tools"`
+	}
+	err := database.DB.Get(&stored, `
+		SELECT COALESCE(code_lines, 0) AS code_lines, COALESCE(complexity, 0) AS complexity,
+			COALESCE(max_nesting, 0) AS max_nesting, analysis_tools
+		FROM solutions
+		WHERE id = ?`, c.Param("solution_id"))
+	if err != nil {
+		log.Printf("DB Error (solution metrics): %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Fehler beim Abrufen der Metriken"})
+		return
+	}
+
+	if stored.Tools == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Für diese Lösung liegt keine Analyse vor"})
+		return
+	}
+
+	analysis := models.CodeAnalysis{
+		Tools:       strings.Split(*stored.Tools, ","),
+		Metrics:     stored.CodeMetrics,
+		Diagnostics: []models.Diagnostic{},
+	}
+	err = database.DB.Select(&analysis.Diagnostics, `
+		SELECT tool, file, line, col, severity, message
+		FROM solution_diagnostics
+		WHERE solution_id = ?
+		ORDER BY file, line, id`, c.Param("solution_id"))
+	if err != nil {
+		log.Printf("DB Error (solution diagnostics): %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Fehler beim Abrufen der Befunde"})
+		return
+	}
+
+	c.JSON(http.StatusOK, analysis)
+}
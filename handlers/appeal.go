@@ -0,0 +1,476 @@
+package handlers
+
+import (
+	"api-test/database"
+	"api-test/models"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sashabaranov/go-openai"
+)
+
+const (
+	appealRegrading = "regrading"
+	appealEscalated = "escalated"
+	appealRevised   = "revised"
+	appealUpheld    = "upheld"
+)
+
+// Die Neubewertung nutzt mehrere Stichproben eines anderen Modells. Sie ändert die Note
+// nur, wenn die Stichproben sich einig sind und deutlich besser ausfallen.
+const (
+	regradeSamples        = 3
+	regradeTemperature    = 0.7
+	regradeMinImprovement = 0.5
+	regradeMaxSpread      = 1.0
+)
+
+// Ein Einspruch, der so lange in "regrading" steht, gilt als liegen geblieben.
+const regradeTimeout = 15 * time.Minute
+
+const notificationAppeal = "appeal"
+
+func regradeModel() string {
+	if model := os.Getenv("REGRADE_MODEL"); model != "" {
+		return model
+	}
+	return openai.GPT4o
+}
+
+func median(values []float64) float64 {
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+
+	n := len(sorted)
+	if n%2 == 1 {
+		return sorted[n/2]
+	}
+	return (sorted[n/2-1] + sorted[n/2]) / 2
+}
+
+const appealColumns = `
+	appeals.id, appeals.solution_id, appeals.user_id, tasks.id AS task_id, solutions.mark,
+	COALESCE(solutions.ai_mark, solutions.raw_mark, solutions.mark) AS ai_mark,
+	appeals.justification, appeals.status, appeals.previous_mark, appeals.regrade_mark,
+	appeals.regrade_spread, appeals.regrade_samples, appeals.response, appeals.resolved_by,
+	appeals.resolved_mark, appeals.created_at, appeals.updated_at`
+
+func loadAppeal(appealID int) (models.Appeal, error) {
+	var appeal models.Appeal
+	err := database.DB.Get(&appeal, `
+		SELECT `+appealColumns+`
+		FROM appeals
+			JOIN solutions ON solutions.id = appeals.solution_id
+			JOIN tasks ON tasks.id = solutions.task_id
+		WHERE appeals.id = ?`, appealID)
+	return appeal, err
+}
+
+// escalateAppeal gibt einen Einspruch an eine Lehrkraft weiter, sofern er noch neu bewertet
+// wird. Hat eine parallele Neubewertung ihn schon abgeschlossen, bleibt er unverändert.
+func escalateAppeal(appeal models.Appeal, regradeMark, spread *float64, samples int) {
+	res, err := database.DB.Exec(`
+		UPDATE appeals
+		SET status = ?, regrade_mark = ?, regrade_spread = ?, regrade_samples = ?, updated_at = ?
+		WHERE id = ? AND status = ?
+	`, appealEscalated, regradeMark, spread, samples, time.Now().UnixMilli(), appeal.ID, appealRegrading)
+	if err != nil {
+		log.Printf("escalateAppeal(%d): %v", appeal.ID, err)
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		log.Printf("escalateAppeal(%d): Einspruch wird nicht mehr neu bewertet", appeal.ID)
+		return
+	}
+
+	notify(appeal.UserID, notificationAppeal, appeal.ID,
+		"Dein Einspruch wurde an eine Lehrkraft weitergeleitet.")
+}
+
+// runRegrade bewertet die Lösung eines Einspruchs unabhängig neu. Die Begründung des
+// Users geht bewusst nicht in den Prompt ein, damit sie die Bewertung nicht steuern kann.
+// Von einer Lehrkraft vergebene Noten werden nicht automatisch überstimmt.
+func runRegrade(appealID int) error {
+	appeal, err := loadAppeal(appealID)
+	if err != nil {
+		return err
+	}
+
+	var solution struct {
+		Description   string   `db:"description"`
+		Language      string   `db:"language"`
+		Level         string   `db:"level"`
+		TimeEstimated int      `db:"time_estimated"`
+		MultiFile     bool     `db:"multi_file"`
+		Code          string   `db:"code"`
+		AIUsage       bool     `db:"ai_usage"`
+		TimeSpent     int      `db:"time_spent"`
+		LatePenalty   float64  `db:"late_penalty"`
+		GradedBy      *int     `db:"graded_by"`
+		Mark          *float64 `db:"mark"`
+		AIReliance    *float64 `db:"ai_reliance"`
+		taskTypeInfo
+	}
+	err = database.DB.Get(&solution, `
+		SELECT tasks.description, COALESCE(tasks.language, '') AS language, COALESCE(tasks.level, '') AS level,
+			COALESCE(tasks.time_estimated, 0) AS time_estimated, tasks.multi_file, COALESCE(solutions.code, '') AS code,
+			COALESCE(solutions.ai_usage, 0) AS ai_usage, COALESCE(solutions.time_spent, 0) AS time_spent,
+			COALESCE(solutions.late_penalty, 0) AS late_penalty, solutions.graded_by, solutions.mark,
+			solutions.ai_reliance, `+taskTypeColumns+`
+		FROM solutions
+			JOIN tasks ON tasks.id = solutions.task_id
+		WHERE solutions.id = ?`, appeal.SolutionID)
+	if err != nil {
+		return fmt.Errorf("solution fetch failed: %w", err)
+	}
+
+	if solution.GradedBy != nil || solution.Mark == nil {
+		escalateAppeal(appeal, nil, nil, 0)
+		return nil
+	}
+
+	// Wie bei der ersten Bewertung wird ein Dateibaum nur analysiert, wenn er mit abgegeben wurde.
+	var files []models.CodeFile
+	if solution.MultiFile {
+		files, err = loadSolutionFiles(appeal.SolutionID)
+		if err != nil {
+			return fmt.Errorf("solution files fetch failed: %w", err)
+		}
+		if len(files) == 0 {
+			files = nil
+		}
+	}
+
+	analysis := analyzeSubmission(solution.Code, files, solution.Language, solution.Type)
+	samples := sampleEvaluations(evaluationInput{
+		Task:          solution.Description,
+		Code:          solution.Code,
+		Level:         solution.Level,
+		Language:      solution.Language,
+		UseAI:         solution.AIUsage,
+		TimeEstimated: solution.TimeEstimated,
+		TimeSpent:     solution.TimeSpent,
+		Temperature:   regradeTemperature,
+		AIReliance:    solution.AIReliance,
+		Analysis:      analysis,
+		Type:          solution.Type,
+		Starter:       solution.Starter,
+		AnswerKey:     solution.AnswerKey,
+		EntryPoints:   solution.entryPoints(),
+		Tests:         solution.Tests,
+	}, []string{regradeModel()}, regradeSamples)
+	marks := sampleMarks(samples)
+
+	if len(marks) < 2 {
+		escalateAppeal(appeal, nil, nil, len(marks))
+		return nil
+	}
+
+	regradeMark := median(marks)
+	spread := markSpread(marks)
+
+	proposed := math.Min(6, math.Round((regradeMark+solution.LatePenalty)*10)/10)
+	if spread > regradeMaxSpread || proposed > *solution.Mark-regradeMinImprovement {
+		escalateAppeal(appeal, &regradeMark, &spread, len(marks))
+		return nil
+	}
+
+	tx, err := database.DB.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec(`
+		UPDATE appeals
+		SET status = ?, regrade_mark = ?, regrade_spread = ?, regrade_samples = ?, resolved_mark = ?, updated_at = ?
+		WHERE id = ? AND status = ?
+	`, appealRevised, regradeMark, spread, len(marks), proposed, time.Now().UnixMilli(), appeal.ID, appealRegrading)
+	if err != nil {
+		return fmt.Errorf("appeal update failed: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		// Eine parallele Neubewertung oder eine Lehrkraft war schneller.
+		log.Printf("runRegrade(%d): Einspruch wird nicht mehr neu bewertet", appeal.ID)
+		return nil
+	}
+
+	reason := fmt.Sprintf("Einspruch %d: Median aus %d Neubewertungen (%s)", appeal.ID, len(marks), regradeModel())
+	if err := changeMark(tx, appeal.SolutionID, gradeSourceRegrade, nil, proposed, reason); err != nil {
+		return fmt.Errorf("changeMark failed: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit failed: %w", err)
+	}
+
+	notify(appeal.UserID, notificationAppeal, appeal.ID,
+		fmt.Sprintf("Dein Einspruch war erfolgreich: Die Note wurde auf %s geändert.", formatMark(proposed)))
+	return nil
+}
+
+// startRegrade führt runRegrade im Hintergrund aus. Scheitert die Neubewertung oder bricht
+// sie mit einem Panic ab, geht der Einspruch an eine Lehrkraft, statt in "regrading" zu hängen.
+func startRegrade(appealID int) {
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				log.Printf("runRegrade(%d): panic: %v", appealID, r)
+				failRegrade(appealID)
+			}
+		}()
+
+		if err := runRegrade(appealID); err != nil {
+			log.Printf("runRegrade(%d): %v", appealID, err)
+			failRegrade(appealID)
+		}
+	}()
+}
+
+func failRegrade(appealID int) {
+	appeal, err := loadAppeal(appealID)
+	if err != nil {
+		// Bleibt der Einspruch in "regrading", nimmt RunAppealSweeper ihn später wieder auf.
+		log.Printf("failRegrade(%d): %v", appealID, err)
+		return
+	}
+	if appeal.Status == appealRegrading {
+		escalateAppeal(appeal, nil, nil, 0)
+	}
+}
+
+// RunAppealSweeper nimmt Einsprüche wieder auf, deren Neubewertung nicht abgeschlossen
+// wurde, etwa weil der Server währenddessen neu gestartet ist. Der erste Durchlauf
+// erfolgt gleich beim Start.
+func RunAppealSweeper(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		var appealIDs []int
+		now := time.Now()
+		err := database.DB.Select(&appealIDs, `
+			UPDATE appeals SET updated_at = ?
+			WHERE status = ? AND updated_at < ?
+			RETURNING id`, now.UnixMilli(), appealRegrading, now.Add(-regradeTimeout).UnixMilli())
+		if err != nil {
+			log.Printf("RunAppealSweeper: query failed: %v", err)
+		}
+
+		for _, appealID := range appealIDs {
+			log.Printf("RunAppealSweeper: Einspruch %d wird erneut bewertet", appealID)
+			startRegrade(appealID)
+		}
+
+		<-ticker.C
+	}
+}
+
+func FileAppeal(c *gin.Context) {
+	solutionID, err := strconv.Atoi(c.Param("solution_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Ungültige Lösungs-ID"})
+		return
+	}
+
+	userID, _ := currentUser(c)
+	if c.GetInt("solution_owner") != userID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Nur eigene Lösungen können angefochten werden"})
+		return
+	}
+
+	var req models.AppealRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if strings.TrimSpace(req.Justification) == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Eine Begründung ist erforderlich"})
+		return
+	}
+
+	var open int
+	err = database.DB.Get(&open, "SELECT COUNT(*) FROM appeals WHERE solution_id = ? AND status IN (?, ?)",
+		solutionID, appealRegrading, appealEscalated)
+	if err != nil {
+		log.Printf("DB Error (appeal check): %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Fehler beim Prüfen der Einsprüche"})
+		return
+	}
+	if open > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Zu dieser Lösung läuft bereits ein Einspruch"})
+		return
+	}
+
+	now := time.Now().UnixMilli()
+	res, err := database.DB.Exec(`
+		INSERT INTO appeals (solution_id, user_id, justification, status, previous_mark, created_at, updated_at)
+		VALUES (?, ?, ?, ?, (SELECT mark FROM solutions WHERE id = ?), ?, ?)
+	`, solutionID, userID, req.Justification, appealRegrading, solutionID, now, now)
+	if err != nil {
+		log.Printf("DB Error (appeal insert): %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Fehler beim Speichern des Einspruchs"})
+		return
+	}
+
+	appealID, err := res.LastInsertId()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Fehler beim Abrufen der Einspruchs-ID"})
+		return
+	}
+
+	startRegrade(int(appealID))
+
+	c.JSON(http.StatusAccepted, gin.H{"appeal_id": appealID, "status": appealRegrading, "message": "Einspruch eingereicht"})
+}
+
+func GetUserAppeals(c *gin.Context) {
+	appeals := []models.Appeal{}
+	err := database.DB.Select(&appeals, `
+		SELECT `+appealColumns+`
+		FROM appeals
+			JOIN solutions ON solutions.id = appeals.solution_id
+			JOIN tasks ON tasks.id = solutions.task_id
+		WHERE appeals.user_id = ?
+		ORDER BY appeals.id DESC`, c.Query("user_id"))
+	if err != nil {
+		log.Printf("DB Error (appeals): %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Fehler beim Abrufen der Einsprüche"})
+		return
+	}
+
+	c.JSON(http.StatusOK, appeals)
+}
+
+// GetAppealQueue liefert die weitergeleiteten Einsprüche der Studierenden aus den
+// Kursen der Lehrkraft, für Admins alle.
+func GetAppealQueue(c *gin.Context) {
+	userID, role := currentUser(c)
+
+	appeals := []models.Appeal{}
+	err := database.DB.Select(&appeals, `
+		SELECT `+appealColumns+`, users.username, tasks.description AS task, COALESCE(solutions.code, '') AS code
+		FROM appeals
+			JOIN solutions ON solutions.id = appeals.solution_id
+			JOIN tasks ON tasks.id = solutions.task_id
+			JOIN users ON users.id = appeals.user_id
+		WHERE appeals.status = ? AND appeals.user_id != ? AND (? OR appeals.user_id IN (`+teacherStudents+`))
+		ORDER BY appeals.created_at`,
+		appealEscalated, userID, role == roleAdmin, userID)
+	if err != nil {
+		log.Printf("DB Error (appeal queue): %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Fehler beim Abrufen der Einsprüche"})
+		return
+	}
+
+	c.JSON(http.StatusOK, appeals)
+}
+
+func ResolveAppeal(c *gin.Context) {
+	appealID, err := strconv.Atoi(c.Param("appeal_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Ungültige Einspruchs-ID"})
+		return
+	}
+
+	var req models.AppealResolution
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if strings.TrimSpace(req.Response) == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Eine Antwort ist erforderlich"})
+		return
+	}
+	if req.Mark != nil && (*req.Mark < 1 || *req.Mark > 6) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Die Note muss zwischen 1,0 und 6,0 liegen"})
+		return
+	}
+
+	appeal, err := loadAppeal(appealID)
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Einspruch nicht gefunden"})
+		return
+	}
+	if err != nil {
+		log.Printf("DB Error (appeal): %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Fehler beim Abrufen des Einspruchs"})
+		return
+	}
+
+	teacherID, role := currentUser(c)
+	allowed, err := canViewUser(teacherID, role, appeal.UserID)
+	if err != nil {
+		log.Printf("DB Error (authorization): %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Fehler bei der Berechtigungsprüfung"})
+		return
+	}
+	if !allowed || appeal.UserID == teacherID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Keine Berechtigung"})
+		return
+	}
+	tx, err := database.DB.Beginx()
+	if err != nil {
+		log.Printf("Transaction start error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Fehler beim Starten der Transaktion"})
+		return
+	}
+	defer tx.Rollback()
+
+	status, resolved := appealUpheld, appeal.Mark
+	changed := req.Mark != nil && (appeal.Mark == nil || math.Abs(*req.Mark-*appeal.Mark) >= 0.05)
+	if changed {
+		mark := math.Round(*req.Mark*10) / 10
+		status, resolved = appealRevised, &mark
+	}
+
+	// Die Bedingung auf den Status verhindert, dass zwei Lehrkräfte denselben Einspruch
+	// entscheiden und die Note doppelt geändert wird.
+	res, err := tx.Exec(`
+		UPDATE appeals
+		SET status = ?, response = ?, resolved_by = ?, resolved_mark = ?, updated_at = ?
+		WHERE id = ? AND status = ?
+	`, status, req.Response, teacherID, resolved, time.Now().UnixMilli(), appeal.ID, appealEscalated)
+	if err != nil {
+		log.Printf("DB Error (appeal update): %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Fehler beim Speichern des Einspruchs"})
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Der Einspruch wartet nicht auf eine Lehrkraft"})
+		return
+	}
+
+	if changed {
+		reason := fmt.Sprintf("Einspruch %d: %s", appeal.ID, req.Response)
+		if err := changeMark(tx, appeal.SolutionID, gradeSourceAppeal, &teacherID, *resolved, reason); err != nil {
+			log.Printf("DB Error (appeal mark): %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Fehler beim Ändern der Note"})
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Printf("Transaction commit error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Fehler beim Abschließen der Transaktion"})
+		return
+	}
+
+	message := "Dein Einspruch wurde geprüft, die Note bleibt bestehen."
+	if status == appealRevised {
+		message = fmt.Sprintf("Dein Einspruch war erfolgreich: Die Note wurde auf %s geändert.", formatMark(*resolved))
+	}
+	notify(appeal.UserID, notificationAppeal, appeal.ID, message)
+
+	c.JSON(http.StatusOK, gin.H{"appeal_id": appeal.ID, "status": status, "mark": resolved})
+}
@@ -0,0 +1,462 @@
+package handlers
+
+import (
+	"api-test/database"
+	"api-test/models"
+	"database/sql"
+	"errors"
+	"log"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	aiAllowed   = "allowed"
+	aiForbidden = "forbidden"
+)
+
+const (
+	submissionNotStarted = "not_started"
+	submissionInProgress = "in_progress"
+	submissionSubmitted  = "submitted"
+	submissionLate       = "late"
+)
+
+var aiPolicies = []string{aiAllowed, aiForbidden}
+
+var (
+	errAssignmentNotOpen = errors.New("Die Aufgabe ist noch nicht freigegeben")
+	errAssignmentClosed  = errors.New("Die Abgabefrist ist abgelaufen")
+	errAttemptsExhausted = errors.New("Keine Abgabeversuche mehr übrig")
+	errAIForbidden       = errors.New("KI-Nutzung ist für diese Aufgabe nicht erlaubt")
+	errSubmissionPending = errors.New("Die Abgabe wird bereits bewertet")
+)
+
+// Eine Vormerkung gilt nur so lange; danach zählt sie nicht mehr, falls der Prozess
+// während der Bewertung abgebrochen ist.
+const submissionReservation = 10 * time.Minute
+
+const assignmentColumns = `
+	id, course_id, catalog_task_id, title, description, language, level,
+	COALESCE(time_estimated, 0) AS time_estimated, time_limit, open_at, due_at,
+	ai_policy, max_attempts, late_penalty, late_days, created_at`
+
+// loadTaskAssignment liefert die Kursaufgabe, zu der eine Aufgabe gehört, oder nil.
+func loadTaskAssignment(taskID int) (*models.Assignment, error) {
+	var assignment models.Assignment
+	err := database.DB.Get(&assignment, `
+		SELECT `+assignmentColumns+`
+		FROM assignments
+		WHERE id = (SELECT assignment_id FROM tasks WHERE id = ?)`, taskID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &assignment, nil
+}
+
+func assignmentAttempts(assignmentID, userID int) (int, error) {
+	var attempts int
+	err := database.DB.Get(&attempts, `
+		SELECT COUNT(*)
+		FROM solutions
+			JOIN tasks ON tasks.id = solutions.task_id
+		WHERE tasks.assignment_id = ? AND tasks.user_id = ?`, assignmentID, userID)
+	return attempts, err
+}
+
+// checkWindow prüft Freigabe, Abgabefrist samt Nachfrist und verbleibende Versuche.
+// Zurückgegeben wird der Notenabzug je angefangenem Tag nach der Frist.
+func checkWindow(a models.Assignment, userID int, at int64) (float64, error) {
+	if at < a.OpenAt {
+		return 0, errAssignmentNotOpen
+	}
+
+	day := int64(24 * time.Hour / time.Millisecond)
+	if at > a.DueAt+int64(a.LateDays)*day {
+		return 0, errAssignmentClosed
+	}
+
+	if a.MaxAttempts > 0 {
+		attempts, err := assignmentAttempts(a.ID, userID)
+		if err != nil {
+			return 0, err
+		}
+		if attempts >= a.MaxAttempts {
+			return 0, errAttemptsExhausted
+		}
+	}
+
+	if at <= a.DueAt {
+		return 0, nil
+	}
+
+	daysLate := math.Ceil(float64(at-a.DueAt) / float64(day))
+	return daysLate * a.LatePenalty, nil
+}
+
+// checkSubmission prüft eine Abgabe gegen die Regeln der Kursaufgabe.
+func checkSubmission(a models.Assignment, taskID int, useAI bool, at int64) (float64, error) {
+	if useAI && a.AIPolicy == aiForbidden {
+		return 0, errAIForbidden
+	}
+
+	var userID int
+	if err := database.DB.Get(&userID, "SELECT user_id FROM tasks WHERE id = ?", taskID); err != nil {
+		return 0, err
+	}
+
+	return checkWindow(a, userID, at)
+}
+
+// reserveSubmission merkt die Abgabe einer Aufgabe für die Dauer der Bewertung vor. Die
+// Prüfung der Versuche und die Vormerkung sind eine einzige Anweisung, damit parallele
+// Abgaben zur selben Kursaufgabe nicht alle noch einen freien Versuch sehen. Vorgemerkte
+// Abgaben zählen wie gespeicherte Lösungen.
+func reserveSubmission(a models.Assignment, taskID int) error {
+	now := time.Now()
+	stale := now.Add(-submissionReservation).UnixMilli()
+	res, err := database.DB.Exec(`
+		UPDATE tasks SET evaluating_since = ?
+		WHERE id = ? AND COALESCE(evaluating_since, 0) <= ?
+			AND (? = 0 OR (
+				SELECT COUNT(*)
+				FROM solutions
+					JOIN tasks t ON t.id = solutions.task_id
+				WHERE t.assignment_id = ? AND t.user_id = tasks.user_id
+			) + (
+				SELECT COUNT(*)
+				FROM tasks t
+				WHERE t.assignment_id = ? AND t.user_id = tasks.user_id AND t.id != tasks.id AND t.evaluating_since > ?
+			) < ?)`,
+		now.UnixMilli(), taskID, stale, a.MaxAttempts, a.ID, a.ID, stale, a.MaxAttempts)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 1 {
+		return nil
+	}
+
+	var pending bool
+	err = database.DB.Get(&pending, "SELECT COALESCE(evaluating_since, 0) > ? FROM tasks WHERE id = ?", stale, taskID)
+	if err != nil {
+		return err
+	}
+	if pending {
+		return errSubmissionPending
+	}
+	return errAttemptsExhausted
+}
+
+func releaseSubmission(taskID int) {
+	if _, err := database.DB.Exec("UPDATE tasks SET evaluating_since = NULL WHERE id = ?", taskID); err != nil {
+		log.Printf("DB Error (release submission): %v", err)
+	}
+}
+
+func respondSubmissionError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, errAssignmentNotOpen), errors.Is(err, errAIForbidden):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	case errors.Is(err, errAssignmentClosed), errors.Is(err, errAttemptsExhausted), errors.Is(err, errSubmissionPending):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		log.Printf("DB Error (assignment check): %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Fehler beim Prüfen der Abgabe"})
+	}
+}
+
+// courseMember prüft, ob der angemeldete User zum Kurs aus :course_id gehört, und
+// liefert seine Rolle darin. Admins werden wie Lehrkräfte behandelt.
+func courseMember(c *gin.Context) (int, string, bool) {
+	courseID, err := strconv.Atoi(c.Param("course_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Ungültige Kurs-ID"})
+		return 0, "", false
+	}
+
+	userID, role := currentUser(c)
+	member, err := courseRole(courseID, userID)
+	if err != nil {
+		log.Printf("DB Error (course role): %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Fehler beim Abrufen des Kurses"})
+		return 0, "", false
+	}
+
+	if role == roleAdmin {
+		member = roleTeacher
+	}
+	if member == "" {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Keine Berechtigung"})
+		return 0, "", false
+	}
+
+	return courseID, member, true
+}
+
+func getAssignment(c *gin.Context, courseID int) (models.Assignment, bool) {
+	var assignment models.Assignment
+
+	id, err := strconv.Atoi(c.Param("assignment_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Ungültige Aufgaben-ID"})
+		return assignment, false
+	}
+
+	err = database.DB.Get(&assignment, `
+		SELECT `+assignmentColumns+`
+		FROM assignments
+		WHERE id = ? AND course_id = ?`, id, courseID)
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Kursaufgabe nicht gefunden"})
+		return assignment, false
+	}
+	if err != nil {
+		log.Printf("DB Error (assignment): %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Fehler beim Abrufen der Kursaufgabe"})
+		return assignment, false
+	}
+
+	return assignment, true
+}
+
+func CreateAssignment(c *gin.Context) {
+	courseID, ok := courseTeacher(c)
+	if !ok {
+		return
+	}
+
+	var req models.AssignmentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if req.CatalogTaskID != nil {
+		task, err := getCatalogTask(*req.CatalogTaskID)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Katalogaufgabe nicht gefunden"})
+			return
+		}
+		req.Description, req.Language, req.Level = task.Description, task.Language, task.Level
+		if req.TimeEstimated == 0 {
+			req.TimeEstimated = task.TimeEstimated
+		}
+	}
+
+	if req.AIPolicy == "" {
+		req.AIPolicy = aiAllowed
+	}
+	if req.OpenAt == 0 {
+		req.OpenAt = time.Now().UnixMilli()
+	}
+
+	switch {
+	case strings.TrimSpace(req.Title) == "" || strings.TrimSpace(req.Description) == "" || req.Language == "":
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Titel, Beschreibung und Sprache sind erforderlich"})
+		return
+	case !slices.Contains(taskLevels, req.Level):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Ungültiges Level"})
+		return
+	case !slices.Contains(aiPolicies, req.AIPolicy):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Ungültige KI-Regel"})
+		return
+	case req.DueAt <= req.OpenAt:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Die Abgabefrist muss nach der Freigabe liegen"})
+		return
+	case req.MaxAttempts < 0 || req.LatePenalty < 0 || req.LateDays < 0 || req.TimeLimit < 0:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Negative Werte sind nicht erlaubt"})
+		return
+	}
+
+	res, err := database.DB.Exec(`
+		INSERT INTO assignments (course_id, catalog_task_id, title, description, language, level, time_estimated,
+			time_limit, open_at, due_at, ai_policy, max_attempts, late_penalty, late_days, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, NULLIF(?, 0), ?, ?, ?, ?, ?, ?, ?)
+	`, courseID, req.CatalogTaskID, req.Title, req.Description, strings.ToLower(req.Language), req.Level, req.TimeEstimated,
+		req.TimeLimit, req.OpenAt, req.DueAt, req.AIPolicy, req.MaxAttempts, req.LatePenalty, req.LateDays, time.Now().UnixMilli())
+	if err != nil {
+		log.Printf("DB Error (assignment insert): %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Fehler beim Speichern der Kursaufgabe"})
+		return
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Fehler beim Abrufen der Aufgaben-ID"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"assignment_id": id, "message": "Kursaufgabe erfolgreich erstellt"})
+}
+
+func GetAssignments(c *gin.Context) {
+	courseID, member, ok := courseMember(c)
+	if !ok {
+		return
+	}
+
+	query := `
+		SELECT ` + assignmentColumns + `
+		FROM assignments
+		WHERE course_id = ?`
+	args := []any{courseID}
+
+	// Studierende sehen Kursaufgaben erst ab ihrer Freigabe.
+	if member != roleTeacher {
+		query += " AND open_at <= ?"
+		args = append(args, time.Now().UnixMilli())
+	}
+	query += " ORDER BY due_at"
+
+	assignments := []models.Assignment{}
+	if err := database.DB.Select(&assignments, query, args...); err != nil {
+		log.Printf("DB Error (assignments): %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Fehler beim Abrufen der Kursaufgaben"})
+		return
+	}
+
+	c.JSON(http.StatusOK, assignments)
+}
+
+func StartAssignment(c *gin.Context) {
+	courseID, _, ok := courseMember(c)
+	if !ok {
+		return
+	}
+
+	assignment, ok := getAssignment(c, courseID)
+	if !ok {
+		return
+	}
+
+	userID, _ := currentUser(c)
+	if _, err := checkWindow(assignment, userID, time.Now().UnixMilli()); err != nil {
+		respondSubmissionError(c, err)
+		return
+	}
+
+	// Eine begonnene, noch nicht bewertete Aufgabe wird weitergeführt statt neu angelegt.
+	var taskID int64
+	err := database.DB.Get(&taskID, `
+		SELECT tasks.id FROM tasks
+		WHERE tasks.assignment_id = ? AND tasks.user_id = ?
+			AND NOT EXISTS (SELECT 1 FROM solutions WHERE solutions.task_id = tasks.id)
+		ORDER BY tasks.id DESC
+		LIMIT 1`, assignment.ID, userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		var res sql.Result
+		res, err = database.DB.Exec(`
+			INSERT INTO tasks (user_id, description, language, level, time_estimated, time_limit, catalog_task_id, assignment_id)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		`, userID, assignment.Description, assignment.Language, assignment.Level, assignment.TimeEstimated,
+			assignment.TimeLimit, assignment.CatalogTaskID, assignment.ID)
+		if err == nil {
+			taskID, err = res.LastInsertId()
+		}
+	}
+	if err != nil {
+		log.Printf("DB Error (assignment start): %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Fehler beim Speichern der Aufgabe"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"task_id":        taskID,
+		"assignment_id":  assignment.ID,
+		"description":    assignment.Description,
+		"language":       assignment.Language,
+		"level":          assignment.Level,
+		"time_estimated": assignment.TimeEstimated,
+		"time_limit":     assignment.TimeLimit,
+		"due_at":         assignment.DueAt,
+		"ai_policy":      assignment.AIPolicy,
+	})
+}
+
+func GetAssignmentSubmissions(c *gin.Context) {
+	courseID, ok := courseTeacher(c)
+	if !ok {
+		return
+	}
+
+	assignment, ok := getAssignment(c, courseID)
+	if !ok {
+		return
+	}
+
+	overview := models.AssignmentOverview{
+		Assignment:  assignment,
+		Submissions: []models.AssignmentSubmission{},
+	}
+
+	err := database.DB.Select(&overview.Submissions, `
+		SELECT
+			cm.user_id, users.username,
+			(SELECT MAX(id) FROM tasks WHERE assignment_id = ? AND user_id = cm.user_id) AS task_id,
+			COALESCE(agg.attempts, 0) AS attempts, agg.best_mark,
+			last.mark AS last_mark, last.raw_mark AS last_raw_mark, last.late_penalty,
+			last.created_at AS submitted_at, COALESCE(last.ai_usage, 0) AS ai_usage, last.ai_reliance
+		FROM course_members cm
+			JOIN users ON users.id = cm.user_id
+			LEFT JOIN (
+				SELECT tasks.user_id, COUNT(*) AS attempts, MIN(solutions.mark) AS best_mark
+				FROM solutions
+					JOIN tasks ON tasks.id = solutions.task_id
+				WHERE tasks.assignment_id = ?
+				GROUP BY tasks.user_id
+			) agg ON agg.user_id = cm.user_id
+			LEFT JOIN (
+				SELECT tasks.user_id, solutions.mark, solutions.raw_mark, solutions.late_penalty,
+					solutions.created_at, solutions.ai_usage, solutions.ai_reliance,
+					ROW_NUMBER() OVER (PARTITION BY tasks.user_id ORDER BY solutions.id DESC) AS rn
+				FROM solutions
+					JOIN tasks ON tasks.id = solutions.task_id
+				WHERE tasks.assignment_id = ?
+			) last ON last.user_id = cm.user_id AND last.rn = 1
+		WHERE cm.course_id = ? AND cm.role = ?
+		ORDER BY users.username`, assignment.ID, assignment.ID, assignment.ID, courseID, roleStudent)
+	if err != nil {
+		log.Printf("DB Error (assignment submissions): %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Fehler beim Abrufen der Abgaben"})
+		return
+	}
+
+	var markSum float64
+	for i := range overview.Submissions {
+		s := &overview.Submissions[i]
+		switch {
+		case s.Attempts > 0 && s.SubmittedAt != nil && *s.SubmittedAt > assignment.DueAt:
+			s.Status = submissionLate
+			overview.Late++
+		case s.Attempts > 0:
+			s.Status = submissionSubmitted
+		case s.TaskID != nil:
+			s.Status = submissionInProgress
+		default:
+			s.Status = submissionNotStarted
+		}
+
+		if s.Attempts > 0 {
+			overview.Submitted++
+			if s.BestMark != nil {
+				markSum += *s.BestMark
+			}
+		}
+	}
+
+	if overview.Submitted > 0 {
+		avg := math.Round(markSum/float64(overview.Submitted)*100) / 100
+		overview.AvgMark = &avg
+	}
+
+	c.JSON(http.StatusOK, overview)
+}
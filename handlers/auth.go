@@ -0,0 +1,306 @@
+package handlers
+
+import (
+	"api-test/database"
+	"api-test/models"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	roleStudent = "student"
+	roleTeacher = "teacher"
+	roleAdmin   = "admin"
+)
+
+const tokenLifetime = 30 * 24 * time.Hour
+
+var userRoles = []string{roleStudent, roleTeacher, roleAdmin}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// issueToken erzeugt ein zufälliges Zugriffstoken. In der Datenbank liegt nur dessen Hash.
+func issueToken(userID int) (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	token := hex.EncodeToString(buf)
+
+	now := time.Now()
+	_, err := database.DB.Exec(`
+		INSERT INTO auth_tokens (token_hash, user_id, created_at, expires_at)
+		VALUES (?, ?, ?, ?)
+	`, hashToken(token), userID, now.UnixMilli(), now.Add(tokenLifetime).UnixMilli())
+	if err != nil {
+		return "", err
+	}
+
+	return token, nil
+}
+
+func bearerToken(c *gin.Context) string {
+	header := c.GetHeader("Authorization")
+	if len(header) > 7 && strings.EqualFold(header[:7], "Bearer ") {
+		return strings.TrimSpace(header[7:])
+	}
+	return ""
+}
+
+// authResult ist das Ergebnis von authenticate, das im gin-Kontext für die weiteren
+// Middlewares derselben Anfrage zwischengespeichert wird.
+type authResult struct {
+	userID int
+	role   string
+	err    error
+}
+
+const authContextKey = "auth"
+
+// authenticate liefert User-ID und Rolle zum Token der Anfrage. Das Token wird je Anfrage
+// nur einmal nachgeschlagen, auch wenn mehrere Rate-Limits und AuthRequired es brauchen.
+func authenticate(c *gin.Context) (int, string, error) {
+	if cached, ok := c.Get(authContextKey); ok {
+		a := cached.(authResult)
+		return a.userID, a.role, a.err
+	}
+
+	token := bearerToken(c)
+	if token == "" {
+		c.Set(authContextKey, authResult{err: sql.ErrNoRows})
+		return 0, "", sql.ErrNoRows
+	}
+
+	var user struct {
+		ID   int    `db:"id"`
+		Role string `db:"role"`
+	}
+	err := database.DB.Get(&user, `
+		SELECT users.id, users.role
+		FROM auth_tokens
+			JOIN users ON users.id = auth_tokens.user_id
+		WHERE auth_tokens.token_hash = ? AND auth_tokens.expires_at > ?`,
+		hashToken(token), time.Now().UnixMilli())
+
+	c.Set(authContextKey, authResult{userID: user.ID, role: user.Role, err: err})
+	return user.ID, user.Role, err
+}
+
+func currentUser(c *gin.Context) (int, string) {
+	return c.GetInt("user_id"), c.GetString("role")
+}
+
+func AuthRequired(c *gin.Context) {
+	userID, role, err := authenticate(c)
+	if errors.Is(err, sql.ErrNoRows) {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Anmeldung erforderlich"})
+		return
+	}
+	if err != nil {
+		log.Printf("DB Error (auth): %v", err)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Fehler bei der Anmeldung"})
+		return
+	}
+
+	c.Set("user_id", userID)
+	c.Set("role", role)
+	c.Next()
+}
+
+func RequireRole(roles ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		_, role := currentUser(c)
+		for _, r := range roles {
+			if r == role {
+				c.Next()
+				return
+			}
+		}
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Keine Berechtigung"})
+	}
+}
+
+// AdminOnly lässt angemeldete Admins und Anfragen mit dem Admin-Schlüssel aus
+// ADMIN_API_KEY durch. Der Schlüssel bleibt nötig, um den ersten Admin zu ernennen.
+func AdminOnly(c *gin.Context) {
+	if _, role, err := authenticate(c); err == nil && role == roleAdmin {
+		c.Next()
+		return
+	}
+
+	key := os.Getenv("ADMIN_API_KEY")
+	given := c.GetHeader("X-Admin-Key")
+
+	if key == "" || subtle.ConstantTimeCompare([]byte(key), []byte(given)) != 1 {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Keine Berechtigung"})
+		return
+	}
+
+	c.Next()
+}
+
+// teacherStudents wählt die Studierenden aus allen Kursen einer Lehrkraft aus.
+const teacherStudents = `
+	SELECT student.user_id
+	FROM course_members teacher
+		JOIN course_members student ON student.course_id = teacher.course_id
+	WHERE teacher.user_id = ? AND teacher.role = 'teacher' AND student.role = 'student'`
+
+// canViewUser prüft, ob ein User die Daten eines anderen sehen darf: die eigenen,
+// als Admin alle und als Lehrkraft die der Studierenden in den eigenen Kursen.
+func canViewUser(viewerID int, role string, userID int) (bool, error) {
+	if viewerID == userID || role == roleAdmin {
+		return true, nil
+	}
+	if role != roleTeacher {
+		return false, nil
+	}
+
+	var count int
+	err := database.DB.Get(&count, `
+		SELECT COUNT(*)
+		FROM course_members teacher
+			JOIN course_members student ON student.course_id = teacher.course_id
+		WHERE teacher.user_id = ? AND teacher.role = ?
+			AND student.user_id = ? AND student.role = ?`,
+		viewerID, roleTeacher, userID, roleStudent)
+
+	return count > 0, err
+}
+
+func authorizeUser(c *gin.Context, userID int) {
+	viewerID, role := currentUser(c)
+
+	allowed, err := canViewUser(viewerID, role, userID)
+	if err != nil {
+		log.Printf("DB Error (authorization): %v", err)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Fehler bei der Berechtigungsprüfung"})
+		return
+	}
+	if !allowed {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Keine Berechtigung"})
+		return
+	}
+
+	c.Next()
+}
+
+// UserAccess schützt Endpunkte, die die Daten des Users aus ?user_id= liefern.
+func UserAccess(c *gin.Context) {
+	userID, err := strconv.Atoi(c.Query("user_id"))
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Ungültige User-ID"})
+		return
+	}
+
+	authorizeUser(c, userID)
+}
+
+// TaskAccess schützt Endpunkte zu einer einzelnen Aufgabe anhand ihres Besitzers.
+func TaskAccess(c *gin.Context) {
+	var userID int
+	err := database.DB.Get(&userID, "SELECT user_id FROM tasks WHERE id = ?", c.Param("task_id"))
+	if errors.Is(err, sql.ErrNoRows) {
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "Aufgabe nicht gefunden"})
+		return
+	}
+	if err != nil {
+		log.Printf("DB Error (task owner): %v", err)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Fehler beim Abrufen der Aufgabe"})
+		return
+	}
+
+	authorizeUser(c, userID)
+}
+
+// QuizAccess schützt Endpunkte zu einem Quiz anhand seines Besitzers.
+func QuizAccess(c *gin.Context) {
+	var userID int
+	err := database.DB.Get(&userID, "SELECT user_id FROM quizzes WHERE id = ?", c.Param("quiz_id"))
+	if errors.Is(err, sql.ErrNoRows) {
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "Quiz nicht gefunden"})
+		return
+	}
+	if err != nil {
+		log.Printf("DB Error (quiz owner): %v", err)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Fehler beim Abrufen des Quiz"})
+		return
+	}
+
+	authorizeUser(c, userID)
+}
+
+// ownTask prüft für Schreibzugriffe mit task_id im Body, dass die Aufgabe dem angemeldeten
+// User gehört. Anders als bei TaskAccess dürfen Lehrkräfte hier nicht mitarbeiten.
+func ownTask(c *gin.Context, taskID int) bool {
+	var ownerID int
+	err := database.DB.Get(&ownerID, "SELECT user_id FROM tasks WHERE id = ?", taskID)
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Aufgabe nicht gefunden"})
+		return false
+	}
+	if err != nil {
+		log.Printf("DB Error (task owner): %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Fehler beim Abrufen der Aufgabe"})
+		return false
+	}
+
+	if userID, _ := currentUser(c); userID != ownerID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Keine Berechtigung"})
+		return false
+	}
+	return true
+}
+
+func LogoutUser(c *gin.Context) {
+	_, err := database.DB.Exec("DELETE FROM auth_tokens WHERE token_hash = ?", hashToken(bearerToken(c)))
+	if err != nil {
+		log.Printf("DB Error (logout): %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Fehler beim Abmelden"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Logout erfolgreich"})
+}
+
+func SetUserRole(c *gin.Context) {
+	var req models.RoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !slices.Contains(userRoles, req.Role) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Ungültige Rolle"})
+		return
+	}
+
+	res, err := database.DB.Exec("UPDATE users SET role = ? WHERE id = ?", req.Role, req.UserID)
+	if err != nil {
+		log.Printf("DB Error (role update): %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Fehler beim Ändern der Rolle"})
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Benutzer nicht gefunden"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Rolle erfolgreich geändert"})
+}
@@ -0,0 +1,174 @@
+package handlers
+
+import (
+	"api-test/models"
+	"fmt"
+	"log"
+	"math"
+	"slices"
+)
+
+// calibrationError ist der Abstand einer Note zum erwarteten Bereich. Positive Werte
+// bedeuten eine zu strenge, negative eine zu milde Bewertung.
+func calibrationError(mark, min, max float64) float64 {
+	switch {
+	case mark > max:
+		return mark - max
+	case mark < min:
+		return mark - min
+	default:
+		return 0
+	}
+}
+
+func meanStdDev(values []float64) (float64, float64) {
+	if len(values) == 0 {
+		return 0, 0
+	}
+
+	var sum float64
+	for _, v := range values {
+		sum += v
+	}
+	mean := sum / float64(len(values))
+
+	var sq float64
+	for _, v := range values {
+		sq += (v - mean) * (v - mean)
+	}
+	return mean, math.Sqrt(sq / float64(len(values)))
+}
+
+func calibrationStats(results []models.CalibrationCaseResult) models.CalibrationStats {
+	stats := models.CalibrationStats{Cases: len(results)}
+
+	var graded int
+	var absErr, bias, stdDev float64
+	var hits int
+	for _, r := range results {
+		stats.Failures += r.Failures
+		if len(r.Marks) == 0 {
+			continue
+		}
+
+		graded++
+		absErr += math.Abs(r.Error)
+		bias += r.Error
+		stdDev += r.StdDev
+		if r.Within {
+			hits++
+		}
+	}
+
+	if graded > 0 {
+		stats.MAE = math.Round(absErr/float64(graded)*100) / 100
+		stats.Bias = math.Round(bias/float64(graded)*100) / 100
+		stats.StdDev = math.Round(stdDev/float64(graded)*100) / 100
+		stats.HitRate = math.Round(float64(hits)/float64(graded)*100) / 100
+	}
+	return stats
+}
+
+func validateCorpus(corpus models.CalibrationCorpus) error {
+	if len(corpus.Cases) == 0 {
+		return fmt.Errorf("Korpus enthält keine Fälle")
+	}
+
+	seen := map[string]bool{}
+	for _, c := range corpus.Cases {
+		switch {
+		case c.ID == "" || seen[c.ID]:
+			return fmt.Errorf("Fall %q: ID fehlt oder ist doppelt", c.ID)
+		case !slices.Contains(taskLevels, c.Level):
+			return fmt.Errorf("Fall %q: ungültiges Level %q", c.ID, c.Level)
+		case c.ExpectedMin < 1 || c.ExpectedMax > 6 || c.ExpectedMin > c.ExpectedMax:
+			return fmt.Errorf("Fall %q: ungültiger Notenbereich %.1f–%.1f", c.ID, c.ExpectedMin, c.ExpectedMax)
+		}
+		seen[c.ID] = true
+	}
+	return nil
+}
+
+// RunCalibration bewertet jeden Fall des Korpus mehrfach mit der Bewertungspipeline und
+// vergleicht die Noten mit den erwarteten Bereichen. Die Streuung über die Durchläufe
+// zeigt, wie reproduzierbar die Bewertung ist.
+func RunCalibration(corpus models.CalibrationCorpus, cfg models.CalibrationConfig) (models.CalibrationReport, error) {
+	report := models.CalibrationReport{CorpusVersion: corpus.Version, Levels: map[string]models.CalibrationStats{}}
+
+	if err := validateCorpus(corpus); err != nil {
+		return report, err
+	}
+
+	if cfg.Runs < 1 {
+		cfg.Runs = 1
+	}
+	if cfg.Samples < 1 {
+		cfg.Samples = defaultEvaluationSettings.Samples
+	}
+	if len(cfg.Models) == 0 {
+		cfg.Models = defaultEvaluationSettings.Models
+	}
+	if cfg.Aggregate == "" {
+		cfg.Aggregate = defaultEvaluationSettings.Aggregate
+	}
+	if cfg.PromptName == "" {
+		cfg.PromptName = "aktuell"
+	}
+	report.Config = cfg
+
+	settings := models.EvaluationSettings{
+		Samples:         cfg.Samples,
+		Models:          cfg.Models,
+		Aggregate:       cfg.Aggregate,
+		ReviewThreshold: defaultEvaluationSettings.ReviewThreshold,
+	}
+
+	byLevel := map[string][]models.CalibrationCaseResult{}
+	for _, c := range corpus.Cases {
+		result := models.CalibrationCaseResult{
+			ID:       c.ID,
+			Level:    c.Level,
+			Expected: []float64{c.ExpectedMin, c.ExpectedMax},
+			Marks:    []float64{},
+		}
+
+		analysis := analyzeCode(c.Code, c.Language)
+		for run := 0; run < cfg.Runs; run++ {
+			consensus, err := consensusEvaluate(evaluationInput{
+				Task:          c.Task,
+				Code:          c.Code,
+				Level:         c.Level,
+				Language:      c.Language,
+				UseAI:         c.UseAI,
+				TimeEstimated: c.TimeEstimated,
+				TimeSpent:     c.TimeSpent,
+				Temperature:   cfg.Temperature,
+				Prompt:        cfg.Prompt,
+				Analysis:      &analysis,
+			}, settings)
+			if err != nil {
+				log.Printf("RunCalibration: %s Durchlauf %d: %v", c.ID, run+1, err)
+				result.Failures++
+				continue
+			}
+			result.Marks = append(result.Marks, consensus.Mark)
+		}
+
+		if len(result.Marks) > 0 {
+			mean, stdDev := meanStdDev(result.Marks)
+			result.Mean = math.Round(mean*100) / 100
+			result.StdDev = math.Round(stdDev*100) / 100
+			result.Error = math.Round(calibrationError(mean, c.ExpectedMin, c.ExpectedMax)*100) / 100
+			result.Within = result.Error == 0
+		}
+
+		report.Cases = append(report.Cases, result)
+		byLevel[c.Level] = append(byLevel[c.Level], result)
+	}
+
+	report.Overall = calibrationStats(report.Cases)
+	for level, results := range byLevel {
+		report.Levels[level] = calibrationStats(results)
+	}
+	return report, nil
+}
@@ -0,0 +1,363 @@
+package handlers
+
+import (
+	"api-test/database"
+	"api-test/models"
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jmoiron/sqlx"
+)
+
+func normalizeTopics(topics []string) []string {
+	seen := make(map[string]bool)
+	var normalized []string
+	for _, t := range topics {
+		t = strings.ToLower(strings.TrimSpace(t))
+		if t == "" || seen[t] {
+			continue
+		}
+		seen[t] = true
+		normalized = append(normalized, t)
+	}
+	return normalized
+}
+
+func setCatalogTopics(tx *sqlx.Tx, catalogTaskID int64, topics []string) error {
+	for _, topic := range normalizeTopics(topics) {
+		if _, err := tx.Exec("INSERT OR IGNORE INTO topics (name) VALUES (?)", topic); err != nil {
+			return err
+		}
+
+		_, err := tx.Exec(`
+			INSERT OR IGNORE INTO catalog_task_topics (catalog_task_id, topic_id)
+			SELECT ?, id FROM topics WHERE name = ?
+		`, catalogTaskID, topic)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func insertCatalogTask(task models.CatalogTask, topics []string) (int64, error) {
+	tx, err := database.DB.Beginx()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec(`
+		INSERT INTO catalog_tasks (description, language, level, time_estimated, source, source_task_id, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`, task.Description, strings.ToLower(task.Language), task.Level, task.TimeEstimated, task.Source, task.SourceTaskID, time.Now().UnixMilli())
+	if err != nil {
+		return 0, err
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	// Übernommene Aufgaben behalten Typ, Ausgangscode, Lösungsschlüssel, Musterlösung und Tests.
+	if task.SourceTaskID != nil {
+		_, err := tx.Exec(`
+			UPDATE catalog_tasks
+			SET (task_type, starter_code, answer_key, entry_points, tests, multi_file, reference_solution) = (
+				SELECT task_type, starter_code, answer_key, entry_points, tests, multi_file, reference_solution
+				FROM tasks WHERE id = ?
+			)
+			WHERE id = ?`, *task.SourceTaskID, id)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	if err := setCatalogTopics(tx, id, topics); err != nil {
+		return 0, err
+	}
+
+	return id, tx.Commit()
+}
+
+func loadCatalogTopics(tasks []models.CatalogTask) error {
+	if len(tasks) == 0 {
+		return nil
+	}
+
+	ids := make([]int, len(tasks))
+	index := make(map[int]int, len(tasks))
+	for i := range tasks {
+		ids[i] = tasks[i].ID
+		index[tasks[i].ID] = i
+		tasks[i].Topics = []string{}
+	}
+
+	query, args, err := sqlx.In(`
+		SELECT ctt.catalog_task_id, topics.name
+		FROM catalog_task_topics ctt
+			JOIN topics ON topics.id = ctt.topic_id
+		WHERE ctt.catalog_task_id IN (?)
+		ORDER BY topics.name`, ids)
+	if err != nil {
+		return err
+	}
+
+	rows, err := database.DB.Query(query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id int
+		var name string
+		if err := rows.Scan(&id, &name); err != nil {
+			return err
+		}
+		tasks[index[id]].Topics = append(tasks[index[id]].Topics, name)
+	}
+
+	return rows.Err()
+}
+
+func SearchCatalog(c *gin.Context) {
+	query := `
+		SELECT id, description, language, level, COALESCE(time_estimated, 0) AS time_estimated,
+			source, source_task_id, created_at, task_type, COALESCE(starter_code, '') AS starter_code
+		FROM catalog_tasks
+		WHERE 1 = 1`
+	var args []any
+
+	if language := c.Query("language"); language != "" {
+		query += " AND language = ?"
+		args = append(args, strings.ToLower(language))
+	}
+	if level := c.Query("level"); level != "" {
+		query += " AND level = ?"
+		args = append(args, level)
+	}
+	for _, topic := range normalizeTopics(c.QueryArray("topic")) {
+		query += `
+			AND EXISTS (
+				SELECT 1 FROM catalog_task_topics ctt
+					JOIN topics ON topics.id = ctt.topic_id
+				WHERE ctt.catalog_task_id = catalog_tasks.id AND topics.name = ?
+			)`
+		args = append(args, topic)
+	}
+	if q := strings.TrimSpace(c.Query("q")); q != "" {
+		query += " AND description LIKE ?"
+		args = append(args, "%"+q+"%")
+	}
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if err != nil || limit <= 0 || limit > 100 {
+		limit = 20
+	}
+	offset, err := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if err != nil || offset < 0 {
+		offset = 0
+	}
+	query += " ORDER BY id DESC LIMIT ? OFFSET ?"
+	args = append(args, limit, offset)
+
+	tasks := []models.CatalogTask{}
+	if err := database.DB.Select(&tasks, query, args...); err != nil {
+		log.Printf("DB Error (catalog search): %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Fehler beim Durchsuchen des Katalogs"})
+		return
+	}
+
+	if err := loadCatalogTopics(tasks); err != nil {
+		log.Printf("DB Error (catalog topics): %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Fehler beim Laden der Themen"})
+		return
+	}
+
+	c.JSON(http.StatusOK, tasks)
+}
+
+func getCatalogTask(id int) (models.CatalogTask, error) {
+	var task models.CatalogTask
+	err := database.DB.Get(&task, `
+		SELECT id, description, language, level, COALESCE(time_estimated, 0) AS time_estimated,
+			source, source_task_id, created_at, task_type, COALESCE(starter_code, '') AS starter_code
+		FROM catalog_tasks
+		WHERE id = ?`, id)
+	if err != nil {
+		return task, err
+	}
+
+	tasks := []models.CatalogTask{task}
+	err = loadCatalogTopics(tasks)
+	return tasks[0], err
+}
+
+func GetCatalogTask(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("catalog_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Ungültige Katalog-ID"})
+		return
+	}
+
+	task, err := getCatalogTask(id)
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Katalogaufgabe nicht gefunden"})
+		return
+	}
+	if err != nil {
+		log.Printf("DB Error (catalog task): %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Fehler beim Abrufen der Katalogaufgabe"})
+		return
+	}
+
+	c.JSON(http.StatusOK, task)
+}
+
+func GetCatalogTopics(c *gin.Context) {
+	topics := []models.Topic{}
+	err := database.DB.Select(&topics, `
+		SELECT topics.id, topics.name, COUNT(ctt.catalog_task_id) AS task_count
+		FROM topics
+			LEFT JOIN catalog_task_topics ctt ON ctt.topic_id = topics.id
+		GROUP BY topics.id
+		ORDER BY topics.name`)
+	if err != nil {
+		log.Printf("DB Error (topics): %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Fehler beim Abrufen der Themen"})
+		return
+	}
+
+	c.JSON(http.StatusOK, topics)
+}
+
+func CreateCatalogTask(c *gin.Context) {
+	var req models.CatalogTaskRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if strings.TrimSpace(req.Description) == "" || req.Language == "" || req.Level == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Beschreibung, Sprache und Level sind erforderlich"})
+		return
+	}
+
+	id, err := insertCatalogTask(models.CatalogTask{
+		Description:   req.Description,
+		Language:      req.Language,
+		Level:         req.Level,
+		TimeEstimated: req.TimeEstimated,
+		Source:        "curated",
+	}, req.Topics)
+	if err != nil {
+		log.Printf("DB Error (catalog insert): %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Fehler beim Speichern der Katalogaufgabe"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"catalog_id": id, "message": "Katalogaufgabe erfolgreich gespeichert"})
+}
+
+func PromoteTask(c *gin.Context) {
+	var req models.CatalogPromoteRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var task models.CatalogTask
+	err := database.DB.Get(&task, `
+		SELECT description, COALESCE(language, '') AS language, COALESCE(level, '') AS level,
+			COALESCE(time_estimated, 0) AS time_estimated
+		FROM tasks
+		WHERE id = ?`, req.TaskID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Aufgabe nicht gefunden"})
+		return
+	}
+
+	task.Source = "promoted"
+	task.SourceTaskID = &req.TaskID
+
+	id, err := insertCatalogTask(task, req.Topics)
+	if err != nil {
+		log.Printf("DB Error (catalog promote): %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Fehler beim Übernehmen der Aufgabe"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"catalog_id": id, "message": "Aufgabe in den Katalog übernommen"})
+}
+
+func StartCatalogTask(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("catalog_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Ungültige Katalog-ID"})
+		return
+	}
+
+	var req models.CatalogStartRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	req.UserID, _ = currentUser(c)
+
+	task, err := getCatalogTask(id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Katalogaufgabe nicht gefunden"})
+		return
+	}
+
+	similarity, _, err := mostSimilarTask(req.UserID, task.Language, task.Description, false)
+	if err != nil {
+		log.Printf("StartCatalogTask: similarity check failed: %v", err)
+	}
+
+	// Von mehreren Themen wird das erste für Ratings und Wiederholungen übernommen.
+	topic := ""
+	if len(task.Topics) > 0 {
+		topic = task.Topics[0]
+	}
+
+	res, err := database.DB.Exec(`
+		INSERT INTO tasks (user_id, description, language, level, time_estimated, time_limit, catalog_task_id, similarity,
+			topic, task_type, starter_code, answer_key, entry_points, tests, multi_file, reference_solution)
+		SELECT ?, description, language, level, time_estimated, NULLIF(?, 0), id, ?,
+			NULLIF(?, ''), task_type, starter_code, answer_key, entry_points, tests, multi_file, reference_solution
+		FROM catalog_tasks
+		WHERE id = ?
+	`, req.UserID, req.TimeLimit, similarity, topic, task.ID)
+	if err != nil {
+		log.Printf("DB Error (catalog start): %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Fehler beim Speichern der Aufgabe"})
+		return
+	}
+
+	taskID, err := res.LastInsertId()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Fehler beim Abrufen der Task-ID"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"task_id":        taskID,
+		"description":    task.Description,
+		"language":       task.Language,
+		"level":          task.Level,
+		"time_estimated": task.TimeEstimated,
+		"topics":         task.Topics,
+		"topic":          topic,
+		"task_type":      task.TaskType,
+		"starter_code":   task.StarterCode,
+	})
+}
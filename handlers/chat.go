@@ -7,6 +7,9 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
 
 	"github.com/gin-gonic/gin"
 )
@@ -16,6 +19,49 @@ func escapeJSON(s string) string {
 	return string(b[1 : len(b)-1]) // entfernt Anführungszeichen
 }
 
+const maxRunOutputLength = 4000
+
+// truncate kürzt auf höchstens max Bytes, ohne ein UTF-8-Zeichen zu zerschneiden.
+func truncate(s string, max int) string {
+	if len(s) <= max {
+		return s
+	}
+	for max > 0 && !utf8.RuneStart(s[max]) {
+		max--
+	}
+	return s[:max] + "\n[... gekürzt]"
+}
+
+func codeContext(req models.TaskChatRequest) string {
+	if strings.TrimSpace(req.Code) == "" {
+		return "- Aktueller Code: (noch kein Code vorhanden)\n"
+	}
+
+	context := fmt.Sprintf("- Aktueller Code des Studierenden:\n%s\n", req.Code)
+	if len(req.Files) > 0 {
+		context = fmt.Sprintf("- Aktueller Code des Studierenden (%d Dateien, je mit Kopfzeile \"%s<Pfad>%s\"):\n%s\n",
+			len(req.Files), fileHeaderStart, fileHeaderEnd, req.Code)
+	}
+
+	if req.Selection != nil {
+		if req.Selection.File != "" {
+			context += fmt.Sprintf("- Geöffnete Datei: %s\n", req.Selection.File)
+		}
+		if req.Selection.StartLine == req.Selection.EndLine && req.Selection.StartColumn == req.Selection.EndColumn {
+			context += fmt.Sprintf("- Cursorposition: Zeile %d, Spalte %d\n", req.Selection.StartLine, req.Selection.StartColumn)
+		} else {
+			context += fmt.Sprintf("- Markierter Bereich: Zeile %d, Spalte %d bis Zeile %d, Spalte %d\n",
+				req.Selection.StartLine, req.Selection.StartColumn, req.Selection.EndLine, req.Selection.EndColumn)
+		}
+	}
+
+	if strings.TrimSpace(req.RunOutput) != "" {
+		context += fmt.Sprintf("- Letzte Programmausgabe:\n%s\n", truncate(req.RunOutput, maxRunOutputLength))
+	}
+
+	return context
+}
+
 func TaskSendChat(c *gin.Context) {
 	var req models.TaskChatRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -23,10 +69,43 @@ func TaskSendChat(c *gin.Context) {
 		log.Printf("TaskSendChat: ShouldBindJSON error: %v", err)
 		return
 	}
+	req.UserId, _ = currentUser(c)
+	if !ownTask(c, req.TaskId) {
+		return
+	}
 
-	_, err := database.DB.Exec(`
-		INSERT INTO interactions (user_id, task_id, role, content, time_remaining, time_spent)
-		VALUES (?, ?, ?, ?, ?, ?)
+	code, files, err := submittedCode(req.Code, req.Files)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	req.Code, req.Files = code, files
+
+	closed, err := sessionClosed(req.TaskId)
+	if err != nil {
+		log.Printf("TaskSendChat: sessionClosed failed: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Fehler beim Laden der Sitzung"})
+		return
+	}
+	if closed {
+		c.JSON(http.StatusConflict, gin.H{"error": "Aufgabe wurde bereits abgegeben"})
+		return
+	}
+
+	assignment, err := loadTaskAssignment(req.TaskId)
+	if err != nil {
+		log.Printf("TaskSendChat: loadTaskAssignment failed: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Fehler beim Abrufen der Aufgabe"})
+		return
+	}
+	if assignment != nil && assignment.AIPolicy == aiForbidden {
+		c.JSON(http.StatusForbidden, gin.H{"error": errAIForbidden.Error()})
+		return
+	}
+
+	_, err = database.DB.Exec(`
+		INSERT INTO interactions (user_id, task_id, role, content, time_remaining, time_spent, code, selection, run_output, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 	`,
 		req.UserId,
 		req.TaskId,
@@ -34,6 +113,10 @@ func TaskSendChat(c *gin.Context) {
 		req.Message,
 		req.TimeRemaining,
 		req.TimeSpent,
+		req.Code,
+		req.Selection,
+		truncate(req.RunOutput, maxRunOutputLength),
+		time.Now().UnixMilli(),
 	)
 
 	if err != nil {
@@ -83,6 +166,7 @@ Return Format:
 Warnings:
 - Stelle sicher, dass deine Antwort dem Level der Aufgabe entspricht.
 - Stelle sicher, dass deine Antwort zur Aufgabenstellung passt.
+- Beziehe dich bei Fragen zum Code auf den aktuellen Code des Studierenden, insbesondere auf den markierten Bereich und die letzte Programmausgabe.
 - Stelle sicher, dass deine Antwort nicht die Lösung enthält, das darf nur ignoriert werden wenn EXPLIZIT nach der Lösung gefragt wird.
 - Sollte die Nachricht nicht zum Thema Programmieren passen, antworte bitte mit "Diese Nachricht passt nicht zum Thema. Ich kann nur themenbezogene Nachrichten beantworten.". Sei hierbei aber nicht zu streng!
 
@@ -91,7 +175,7 @@ Context Dump:
 - Aktuelle Nachricht: "%s"
 - Schwierigkeitsgrad: "%s"
 - Aufgabe: "%s"
-`, historyJSON, req.Message, req.Level, req.Task)
+%s`, historyJSON, req.Message, req.Level, req.Task, codeContext(req))
 
 	response, err := GetAIResponse(prompt)
 	log.Printf("TaskSendChat: Prompt: %v", prompt)
@@ -116,13 +200,14 @@ Context Dump:
 	}
 
 	_, err = database.DB.Exec(`
-		INSERT INTO interactions (user_id, task_id, role, content)
-		VALUES (?, ?, ?, ?)
+		INSERT INTO interactions (user_id, task_id, role, content, created_at)
+		VALUES (?, ?, ?, ?, ?)
 	`,
 		req.UserId,
 		req.TaskId,
 		"assistant",
 		taskChatResponse.Message,
+		time.Now().UnixMilli(),
 	)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Fehler beim Speichern der KI-Antwort"})
@@ -0,0 +1,319 @@
+package handlers
+
+import (
+	"api-test/database"
+	"api-test/models"
+	"database/sql"
+	"errors"
+	"log"
+	"math"
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	aggregateMedian      = "median"
+	aggregateTrimmedMean = "trimmed_mean"
+	maxEvaluationSamples = 7
+)
+
+var aggregates = []string{aggregateMedian, aggregateTrimmedMean}
+
+// defaultEvaluationSettings entspricht der bisherigen Einzelbewertung.
+var defaultEvaluationSettings = models.EvaluationSettings{
+	Samples:         1,
+	Models:          []string{defaultModel},
+	Aggregate:       aggregateMedian,
+	ReviewThreshold: 1.0,
+}
+
+type evaluationSample struct {
+	Model string
+	Mark  float64
+	Eval  models.TaskEvaluation
+}
+
+type evaluationConsensus struct {
+	Eval    models.TaskEvaluation
+	Mark    float64
+	Samples []evaluationSample
+}
+
+// sampleEvaluations führt n Bewertungen parallel aus und verteilt sie reihum auf die
+// Modelle. Fehlgeschlagene Stichproben fallen weg.
+func sampleEvaluations(in evaluationInput, models []string, n int) []evaluationSample {
+	results := make([]*evaluationSample, n)
+
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			sampleIn := in
+			sampleIn.Model = models[i%len(models)]
+			if sampleIn.Temperature == 0 {
+				sampleIn.Temperature = defaultTemperature
+			}
+
+			eval, mark, err := evaluateSolution(sampleIn)
+			if err != nil {
+				log.Printf("sampleEvaluations: sample %d (%s) failed: %v", i, sampleIn.Model, err)
+				return
+			}
+			results[i] = &evaluationSample{Model: sampleIn.Model, Mark: mark, Eval: eval}
+		}()
+	}
+	wg.Wait()
+
+	var samples []evaluationSample
+	for _, r := range results {
+		if r != nil {
+			samples = append(samples, *r)
+		}
+	}
+	return samples
+}
+
+func sampleMarks(samples []evaluationSample) []float64 {
+	marks := make([]float64, len(samples))
+	for i, s := range samples {
+		marks[i] = s.Mark
+	}
+	return marks
+}
+
+func markSpread(marks []float64) float64 {
+	if len(marks) == 0 {
+		return 0
+	}
+	return slices.Max(marks) - slices.Min(marks)
+}
+
+// aggregateMarks fasst die Noten per Median oder per getrimmtem Mittel zusammen. Beim
+// getrimmten Mittel fallen je Seite 20 % der Noten weg, ab drei Noten mindestens eine.
+func aggregateMarks(marks []float64, method string) float64 {
+	if method != aggregateTrimmedMean {
+		return median(marks)
+	}
+
+	sorted := append([]float64(nil), marks...)
+	sort.Float64s(sorted)
+
+	trim := len(sorted) / 5
+	if trim == 0 && len(sorted) >= 3 {
+		trim = 1
+	}
+	sorted = sorted[trim : len(sorted)-trim]
+
+	var sum float64
+	for _, m := range sorted {
+		sum += m
+	}
+	return sum / float64(len(sorted))
+}
+
+// consensusEvaluate bewertet eine Lösung nach den Einstellungen mehrfach. Als Text wird
+// die Bewertung übernommen, deren Note dem Ergebnis am nächsten liegt. Die Konfidenz sinkt
+// mit der Spannweite der Noten; liegt diese über der Schwelle, wird die Bewertung zur
+// Prüfung durch eine Lehrkraft markiert.
+func consensusEvaluate(in evaluationInput, settings models.EvaluationSettings) (evaluationConsensus, error) {
+	var result evaluationConsensus
+
+	result.Samples = sampleEvaluations(in, settings.Models, settings.Samples)
+	if len(result.Samples) == 0 {
+		return result, errors.New("keine Bewertung erfolgreich")
+	}
+
+	marks := sampleMarks(result.Samples)
+	result.Mark = math.Round(aggregateMarks(marks, settings.Aggregate)*10) / 10
+
+	closest := result.Samples[0]
+	for _, s := range result.Samples[1:] {
+		if math.Abs(s.Mark-result.Mark) < math.Abs(closest.Mark-result.Mark) {
+			closest = s
+		}
+	}
+
+	result.Eval = closest.Eval
+	result.Eval.Mark = formatMark(result.Mark)
+	result.Eval.Samples = len(result.Samples)
+
+	if settings.Samples > 1 {
+		spread := markSpread(marks)
+		confidence := math.Round((1-spread/5)*100) / 100
+		result.Eval.Spread = &spread
+		result.Eval.Confidence = &confidence
+		result.Eval.NeedsReview = len(result.Samples) < 2 || spread > settings.ReviewThreshold
+	}
+
+	return result, nil
+}
+
+func splitModels(list string) []string {
+	var models []string
+	for _, m := range strings.Split(list, ",") {
+		if m = strings.TrimSpace(m); m != "" {
+			models = append(models, m)
+		}
+	}
+	return models
+}
+
+// evaluationSettingsFor sucht die Einstellungen für eine Aufgabe. Einstellungen des Kurses
+// gehen vor globalen, innerhalb davon solche für das Level vor denen für alle Level.
+func evaluationSettingsFor(taskID int) (models.EvaluationSettings, error) {
+	var settings models.EvaluationSettings
+	err := database.DB.Get(&settings, `
+		SELECT id, course_id, level, samples, models, aggregate, review_threshold, updated_at
+		FROM evaluation_settings
+		WHERE course_id IN (0, COALESCE((
+				SELECT assignments.course_id
+				FROM tasks
+					JOIN assignments ON assignments.id = tasks.assignment_id
+				WHERE tasks.id = ?), 0))
+			AND level IN ('', (SELECT COALESCE(level, '') FROM tasks WHERE id = ?))
+		ORDER BY course_id DESC, level DESC
+		LIMIT 1`, taskID, taskID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return defaultEvaluationSettings, nil
+	}
+	if err != nil {
+		return settings, err
+	}
+
+	settings.Models = splitModels(settings.ModelList)
+	if len(settings.Models) == 0 {
+		settings.Models = defaultEvaluationSettings.Models
+	}
+	return settings, nil
+}
+
+func GetEvaluationSettings(c *gin.Context) {
+	userID, role := currentUser(c)
+
+	settings := []models.EvaluationSettings{}
+	err := database.DB.Select(&settings, `
+		SELECT id, course_id, level, samples, models, aggregate, review_threshold, updated_at
+		FROM evaluation_settings
+		WHERE course_id = 0 OR ? OR course_id IN (
+			SELECT course_id FROM course_members WHERE user_id = ? AND role = ?
+		)
+		ORDER BY course_id, level`, role == roleAdmin, userID, roleTeacher)
+	if err != nil {
+		log.Printf("DB Error (evaluation settings): %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Fehler beim Abrufen der Bewertungseinstellungen"})
+		return
+	}
+
+	for i := range settings {
+		settings[i].Models = splitModels(settings[i].ModelList)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"default": defaultEvaluationSettings, "settings": settings})
+}
+
+func SaveEvaluationSettings(c *gin.Context) {
+	var req models.EvaluationSettingsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID, role := currentUser(c)
+	if role != roleAdmin {
+		member, err := courseRole(req.CourseID, userID)
+		if err != nil {
+			log.Printf("DB Error (course role): %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Fehler beim Abrufen des Kurses"})
+			return
+		}
+		if req.CourseID == 0 || member != roleTeacher {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Keine Berechtigung"})
+			return
+		}
+	}
+
+	if req.Aggregate == "" {
+		req.Aggregate = aggregateMedian
+	}
+	if len(req.Models) == 0 {
+		req.Models = defaultEvaluationSettings.Models
+	}
+
+	switch {
+	case req.Samples < 1 || req.Samples > maxEvaluationSamples:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Die Anzahl der Bewertungen muss zwischen 1 und 7 liegen"})
+		return
+	case req.Level != "" && !slices.Contains(taskLevels, req.Level):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Ungültiges Level"})
+		return
+	case !slices.Contains(aggregates, req.Aggregate):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Ungültiges Aggregationsverfahren"})
+		return
+	case req.ReviewThreshold <= 0:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Die Prüfschwelle muss größer als 0 sein"})
+		return
+	}
+
+	_, err := database.DB.Exec(`
+		INSERT INTO evaluation_settings (course_id, level, samples, models, aggregate, review_threshold, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (course_id, level) DO UPDATE SET
+			samples = excluded.samples,
+			models = excluded.models,
+			aggregate = excluded.aggregate,
+			review_threshold = excluded.review_threshold,
+			updated_at = excluded.updated_at
+	`, req.CourseID, req.Level, req.Samples, strings.Join(splitModels(strings.Join(req.Models, ",")), ","),
+		req.Aggregate, req.ReviewThreshold, time.Now().UnixMilli())
+	if err != nil {
+		log.Printf("DB Error (evaluation settings save): %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Fehler beim Speichern der Bewertungseinstellungen"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Bewertungseinstellungen gespeichert"})
+}
+
+// GetFlaggedEvaluations liefert uneinige Bewertungen der Studierenden aus den Kursen
+// der Lehrkraft, für Admins alle.
+func GetFlaggedEvaluations(c *gin.Context) {
+	userID, role := currentUser(c)
+
+	flagged := []models.FlaggedSolution{}
+	err := database.DB.Select(&flagged, `
+		SELECT solutions.id AS solution_id, tasks.id AS task_id, tasks.user_id, users.username,
+			tasks.description AS task, solutions.mark, solutions.mark_spread, solutions.confidence
+		FROM solutions
+			JOIN tasks ON tasks.id = solutions.task_id
+			JOIN users ON users.id = tasks.user_id
+		WHERE solutions.needs_review = 1 AND tasks.user_id != ? AND (? OR tasks.user_id IN (`+teacherStudents+`))
+		ORDER BY solutions.id`, userID, role == roleAdmin, userID)
+	if err != nil {
+		log.Printf("DB Error (flagged evaluations): %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Fehler beim Abrufen der markierten Bewertungen"})
+		return
+	}
+
+	for i := range flagged {
+		flagged[i].Samples = []models.EvaluationSample{}
+		err := database.DB.Select(&flagged[i].Samples, `
+			SELECT model, mark FROM evaluation_samples
+			WHERE solution_id = ?
+			ORDER BY id`, flagged[i].SolutionID)
+		if err != nil {
+			log.Printf("DB Error (evaluation samples): %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Fehler beim Abrufen der Einzelbewertungen"})
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, flagged)
+}
@@ -0,0 +1,266 @@
+package handlers
+
+import (
+	"api-test/database"
+	"api-test/models"
+	"crypto/rand"
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const inviteAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+
+// newInviteCode erzeugt einen achtstelligen Einladungscode ohne leicht verwechselbare Zeichen.
+func newInviteCode() (string, error) {
+	buf := make([]byte, 8)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	for i, b := range buf {
+		buf[i] = inviteAlphabet[int(b)%len(inviteAlphabet)]
+	}
+	return string(buf), nil
+}
+
+// courseRole liefert die Rolle eines Users in einem Kurs oder "" ohne Mitgliedschaft.
+func courseRole(courseID, userID int) (string, error) {
+	var role string
+	err := database.DB.Get(&role, "SELECT role FROM course_members WHERE course_id = ? AND user_id = ?", courseID, userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+	return role, err
+}
+
+// courseTeacher prüft, ob der angemeldete User den Kurs aus :course_id verwalten darf.
+func courseTeacher(c *gin.Context) (int, bool) {
+	courseID, err := strconv.Atoi(c.Param("course_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Ungültige Kurs-ID"})
+		return 0, false
+	}
+
+	userID, role := currentUser(c)
+	member, err := courseRole(courseID, userID)
+	if err != nil {
+		log.Printf("DB Error (course role): %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Fehler beim Abrufen des Kurses"})
+		return 0, false
+	}
+
+	if member != roleTeacher && role != roleAdmin {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Keine Berechtigung"})
+		return 0, false
+	}
+
+	return courseID, true
+}
+
+func CreateCourse(c *gin.Context) {
+	var req models.CourseRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if strings.TrimSpace(req.Name) == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Kursname ist erforderlich"})
+		return
+	}
+
+	code, err := newInviteCode()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Fehler beim Erstellen des Einladungscodes"})
+		return
+	}
+
+	userID, _ := currentUser(c)
+	now := time.Now().UnixMilli()
+
+	tx, err := database.DB.Beginx()
+	if err != nil {
+		log.Printf("Transaction start error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Fehler beim Starten der Transaktion"})
+		return
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec(`
+		INSERT INTO courses (name, description, teacher_id, invite_code, created_at)
+		VALUES (?, ?, ?, ?, ?)
+	`, req.Name, req.Description, userID, code, now)
+	if err != nil {
+		log.Printf("DB Error (course insert): %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Fehler beim Speichern des Kurses"})
+		return
+	}
+
+	courseID, err := res.LastInsertId()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Fehler beim Abrufen der Kurs-ID"})
+		return
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO course_members (course_id, user_id, role, joined_at)
+		VALUES (?, ?, ?, ?)
+	`, courseID, userID, roleTeacher, now)
+	if err != nil {
+		log.Printf("DB Error (course member insert): %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Fehler beim Speichern des Kurses"})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Printf("Transaction commit error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Fehler beim Abschließen der Transaktion"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"course_id":   courseID,
+		"invite_code": code,
+		"message":     "Kurs erfolgreich erstellt",
+	})
+}
+
+func GetCourses(c *gin.Context) {
+	userID, _ := currentUser(c)
+
+	courses := []models.Course{}
+	err := database.DB.Select(&courses, `
+		SELECT
+			courses.id, courses.name, COALESCE(courses.description, '') AS description,
+			courses.teacher_id, users.username AS teacher,
+			CASE WHEN cm.role = ? THEN courses.invite_code END AS invite_code,
+			cm.role,
+			(SELECT COUNT(*) FROM course_members WHERE course_id = courses.id AND role = ?) AS members,
+			courses.created_at
+		FROM course_members cm
+			JOIN courses ON courses.id = cm.course_id
+			JOIN users ON users.id = courses.teacher_id
+		WHERE cm.user_id = ?
+		ORDER BY courses.created_at DESC`, roleTeacher, roleStudent, userID)
+	if err != nil {
+		log.Printf("DB Error (courses): %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Fehler beim Abrufen der Kurse"})
+		return
+	}
+
+	c.JSON(http.StatusOK, courses)
+}
+
+func JoinCourse(c *gin.Context) {
+	var req models.CourseJoinRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var courseID int
+	err := database.DB.Get(&courseID, "SELECT id FROM courses WHERE invite_code = ?", strings.ToUpper(strings.TrimSpace(req.InviteCode)))
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Ungültiger Einladungscode"})
+		return
+	}
+	if err != nil {
+		log.Printf("DB Error (course lookup): %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Fehler beim Abrufen des Kurses"})
+		return
+	}
+
+	userID, _ := currentUser(c)
+	res, err := database.DB.Exec(`
+		INSERT OR IGNORE INTO course_members (course_id, user_id, role, joined_at)
+		VALUES (?, ?, ?, ?)
+	`, courseID, userID, roleStudent, time.Now().UnixMilli())
+	if err != nil {
+		log.Printf("DB Error (course join): %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Fehler beim Beitreten"})
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Bereits Mitglied des Kurses", "course_id": courseID})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"course_id": courseID, "message": "Kurs erfolgreich beigetreten"})
+}
+
+func GetCourseMembers(c *gin.Context) {
+	courseID, ok := courseTeacher(c)
+	if !ok {
+		return
+	}
+
+	members := []models.CourseMember{}
+	err := database.DB.Select(&members, `
+		SELECT
+			cm.user_id, users.username, cm.role, cm.joined_at,
+			COUNT(DISTINCT tasks.id) AS total_tasks,
+			COUNT(DISTINCT solutions.task_id) AS completed_tasks,
+			AVG(solutions.mark) AS avg_mark
+		FROM course_members cm
+			JOIN users ON users.id = cm.user_id
+			LEFT JOIN tasks ON tasks.user_id = cm.user_id
+			LEFT JOIN solutions ON solutions.task_id = tasks.id
+		WHERE cm.course_id = ?
+		GROUP BY cm.user_id
+		ORDER BY cm.role DESC, users.username`, courseID)
+	if err != nil {
+		log.Printf("DB Error (course members): %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Fehler beim Abrufen der Kursmitglieder"})
+		return
+	}
+
+	c.JSON(http.StatusOK, members)
+}
+
+func RemoveCourseMember(c *gin.Context) {
+	courseID, ok := courseTeacher(c)
+	if !ok {
+		return
+	}
+
+	res, err := database.DB.Exec("DELETE FROM course_members WHERE course_id = ? AND user_id = ? AND role = ?",
+		courseID, c.Param("user_id"), roleStudent)
+	if err != nil {
+		log.Printf("DB Error (course member delete): %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Fehler beim Entfernen des Mitglieds"})
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Mitglied nicht gefunden"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Mitglied erfolgreich entfernt"})
+}
+
+func RenewInviteCode(c *gin.Context) {
+	courseID, ok := courseTeacher(c)
+	if !ok {
+		return
+	}
+
+	code, err := newInviteCode()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Fehler beim Erstellen des Einladungscodes"})
+		return
+	}
+
+	if _, err := database.DB.Exec("UPDATE courses SET invite_code = ? WHERE id = ?", code, courseID); err != nil {
+		log.Printf("DB Error (invite code): %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Fehler beim Speichern des Einladungscodes"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"course_id": courseID, "invite_code": code})
+}
@@ -0,0 +1,314 @@
+package handlers
+
+import (
+	"api-test/database"
+	"api-test/models"
+	"archive/zip"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jmoiron/sqlx"
+)
+
+// Die Grenzen gelten für den ganzen Dateibaum einer Abgabe. Die Gesamtgröße entspricht
+// der maximalen Länge eines Snapshots, da dieser den Baum als Text enthält.
+const (
+	maxTaskFiles      = 30
+	maxGeneratedFiles = 5
+	maxFileSize       = 100000
+	maxTreeSize       = maxSnapshotLength
+	maxZipSize        = 2 << 20
+	fileHeaderStart   = "=== Datei: "
+	fileHeaderEnd     = " ==="
+)
+
+var fileHeader = regexp.MustCompile(`(?m)^` + fileHeaderStart + `(.+)` + fileHeaderEnd + `$`)
+
+// normalizeFiles prüft einen Dateibaum und bringt die Pfade in eine einheitliche Form:
+// relativ, mit Schrägstrichen und ohne "..". Die Dateien werden nach Pfad sortiert.
+func normalizeFiles(files []models.CodeFile) ([]models.CodeFile, error) {
+	if len(files) > maxTaskFiles {
+		return nil, fmt.Errorf("Höchstens %d Dateien erlaubt", maxTaskFiles)
+	}
+
+	seen := map[string]bool{}
+	total := 0
+	normalized := make([]models.CodeFile, 0, len(files))
+	for _, f := range files {
+		p := path.Clean(strings.ReplaceAll(strings.TrimSpace(f.Path), "\\", "/"))
+		switch {
+		case p == "." || p == "" || strings.HasPrefix(p, "/") || p == ".." || strings.HasPrefix(p, "../"):
+			return nil, fmt.Errorf("Ungültiger Dateipfad %q", f.Path)
+		case strings.ContainsAny(p, "\n\r") || strings.Contains(p, fileHeaderEnd):
+			return nil, fmt.Errorf("Ungültiger Dateipfad %q", f.Path)
+		case reservedAnalysisFile(p):
+			return nil, fmt.Errorf("Dateiname %q ist nicht erlaubt", path.Base(p))
+		case seen[p]:
+			return nil, fmt.Errorf("Datei %q ist doppelt", p)
+		case len(f.Content) > maxFileSize:
+			return nil, fmt.Errorf("Datei %q ist größer als %d Bytes", p, maxFileSize)
+		case !utf8.ValidString(f.Content):
+			return nil, fmt.Errorf("Datei %q ist keine Textdatei", p)
+		}
+
+		seen[p] = true
+		total += len(f.Content)
+		normalized = append(normalized, models.CodeFile{Path: p, Content: f.Content})
+	}
+
+	if total > maxTreeSize {
+		return nil, fmt.Errorf("Die Dateien sind zusammen größer als %d Bytes", maxTreeSize)
+	}
+
+	sort.Slice(normalized, func(i, j int) bool { return normalized[i].Path < normalized[j].Path })
+	return normalized, nil
+}
+
+// flattenFiles fasst einen Dateibaum zu einem Text mit Kopfzeilen je Datei zusammen.
+// In dieser Form landet er in solutions.code, in Snapshots und im Prompt.
+func flattenFiles(files []models.CodeFile) string {
+	var b strings.Builder
+	for i, f := range files {
+		if i > 0 {
+			b.WriteString("\n")
+		}
+		b.WriteString(fileHeaderStart + f.Path + fileHeaderEnd + "\n")
+		b.WriteString(strings.TrimSuffix(f.Content, "\n"))
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+// unflattenFiles ist die Umkehrung von flattenFiles. Code ohne Kopfzeile am Anfang ist
+// eine einzelne Datei, dann wird nil zurückgegeben.
+func unflattenFiles(code string) []models.CodeFile {
+	matches := fileHeader.FindAllStringSubmatchIndex(code, -1)
+	if len(matches) == 0 || matches[0][0] != 0 {
+		return nil
+	}
+
+	var files []models.CodeFile
+	for i, m := range matches {
+		end := len(code)
+		if i+1 < len(matches) {
+			end = matches[i+1][0] - 1
+		}
+		content := code[min(m[1]+1, end):end]
+		files = append(files, models.CodeFile{Path: code[m[2]:m[3]], Content: content})
+	}
+	return files
+}
+
+// submittedCode bestimmt aus Code und Dateibaum einer Anfrage den Text für Bewertung und
+// Speicherung. Ein übergebener Dateibaum hat Vorrang.
+func submittedCode(code string, files []models.CodeFile) (string, []models.CodeFile, error) {
+	if len(files) == 0 {
+		return code, nil, nil
+	}
+
+	files, err := normalizeFiles(files)
+	if err != nil {
+		return "", nil, err
+	}
+	return flattenFiles(files), files, nil
+}
+
+func saveSolutionFiles(tx *sqlx.Tx, solutionID int64, files []models.CodeFile) error {
+	for _, f := range files {
+		_, err := tx.Exec(`
+			INSERT INTO solution_files (solution_id, path, content, size)
+			VALUES (?, ?, ?, ?)
+		`, solutionID, f.Path, f.Content, len(f.Content))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func loadSolutionFiles(solutionID int) ([]models.CodeFile, error) {
+	files := []models.CodeFile{}
+	err := database.DB.Select(&files, "SELECT path, content FROM solution_files WHERE solution_id = ? ORDER BY path", solutionID)
+	return files, err
+}
+
+var errZipTooLarge = errors.New("ZIP-Archiv ist zu groß")
+
+// filesFromZip liest die Textdateien eines ZIP-Archivs. Verzeichnisse, versteckte Dateien
+// und macOS-Metadaten werden übersprungen, ein gemeinsames oberstes Verzeichnis entfernt.
+func filesFromZip(data []byte) ([]models.CodeFile, error) {
+	reader, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("Ungültiges ZIP-Archiv")
+	}
+
+	var files []models.CodeFile
+	total := 0
+	for _, f := range reader.File {
+		name := strings.ReplaceAll(f.Name, "\\", "/")
+		if f.FileInfo().IsDir() || strings.HasPrefix(name, "__MACOSX/") || strings.HasPrefix(path.Base(name), ".") ||
+			strings.Contains(name, "/.") {
+			continue
+		}
+		if f.UncompressedSize64 > maxFileSize {
+			return nil, fmt.Errorf("Datei %q ist größer als %d Bytes", name, maxFileSize)
+		}
+
+		rc, err := f.Open()
+		if err != nil {
+			return nil, fmt.Errorf("Datei %q nicht lesbar", name)
+		}
+		content, err := io.ReadAll(io.LimitReader(rc, maxFileSize+1))
+		rc.Close()
+		if err != nil {
+			return nil, fmt.Errorf("Datei %q nicht lesbar", name)
+		}
+
+		total += len(content)
+		if total > maxTreeSize {
+			return nil, errZipTooLarge
+		}
+		files = append(files, models.CodeFile{Path: name, Content: string(content)})
+	}
+
+	if len(files) == 0 {
+		return nil, fmt.Errorf("ZIP-Archiv enthält keine Dateien")
+	}
+
+	if prefix, _, found := strings.Cut(files[0].Path, "/"); found {
+		shared := true
+		for _, f := range files {
+			if !strings.HasPrefix(f.Path, prefix+"/") {
+				shared = false
+				break
+			}
+		}
+		if shared {
+			for i := range files {
+				files[i].Path = strings.TrimPrefix(files[i].Path, prefix+"/")
+			}
+		}
+	}
+
+	return normalizeFiles(files)
+}
+
+func zipFiles(files []models.CodeFile) ([]byte, error) {
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	for _, f := range files {
+		fw, err := w.Create(f.Path)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := io.WriteString(fw, f.Content); err != nil {
+			return nil, err
+		}
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+var languageExtensions = map[string]string{
+	"go": ".go", "python": ".py", "javascript": ".js", "typescript": ".ts", "java": ".java",
+	"c": ".c", "c++": ".cpp", "c#": ".cs", "rust": ".rs", "php": ".php", "ruby": ".rb",
+	"kotlin": ".kt", "swift": ".swift", "sql": ".sql",
+}
+
+// UploadTaskZip liest ein hochgeladenes ZIP-Archiv als Dateibaum für eine Aufgabe ein.
+// Die Dateien werden nicht gespeichert, sondern wie im Editor erst mit der Abgabe.
+func UploadTaskZip(c *gin.Context) {
+	header, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Keine Datei hochgeladen"})
+		return
+	}
+	if header.Size > maxZipSize {
+		c.JSON(http.StatusBadRequest, gin.H{"error": errZipTooLarge.Error()})
+		return
+	}
+
+	f, err := header.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Datei nicht lesbar"})
+		return
+	}
+	defer f.Close()
+
+	data, err := io.ReadAll(io.LimitReader(f, maxZipSize+1))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Datei nicht lesbar"})
+		return
+	}
+
+	files, err := filesFromZip(data)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"task_id": c.Param("task_id"), "files": files})
+}
+
+// DownloadSolutionZip liefert die Dateien einer Lösung als ZIP-Archiv. Lösungen aus
+// einer einzelnen Datei werden als main mit der Endung der Sprache verpackt.
+func DownloadSolutionZip(c *gin.Context) {
+	solutionID, err := strconv.Atoi(c.Param("solution_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Ungültige Lösungs-ID"})
+		return
+	}
+
+	files, err := loadSolutionFiles(solutionID)
+	if err != nil {
+		log.Printf("DB Error (solution files): %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Fehler beim Abrufen der Dateien"})
+		return
+	}
+
+	if len(files) == 0 {
+		var solution struct {
+			Code     string `db:"code"`
+			Language string `db:"language"`
+		}
+		err := database.DB.Get(&solution, `
+			SELECT COALESCE(solutions.code, '') AS code, COALESCE(tasks.language, '') AS language
+			FROM solutions
+				JOIN tasks ON tasks.id = solutions.task_id
+			WHERE solutions.id = ?`, solutionID)
+		if err != nil {
+			log.Printf("DB Error (solution code): %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Fehler beim Abrufen der Lösung"})
+			return
+		}
+
+		ext, ok := languageExtensions[analysisLanguage(solution.Language)]
+		if !ok {
+			ext = ".txt"
+		}
+		files = []models.CodeFile{{Path: analysisFileName + ext, Content: solution.Code}}
+	}
+
+	data, err := zipFiles(files)
+	if err != nil {
+		log.Printf("DownloadSolutionZip: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Fehler beim Erstellen des ZIP-Archivs"})
+		return
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="loesung-%d.zip"`, solutionID))
+	c.Data(http.StatusOK, "application/zip", data)
+}
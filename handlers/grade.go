@@ -0,0 +1,246 @@
+package handlers
+
+import (
+	"api-test/database"
+	"api-test/models"
+	"database/sql"
+	"errors"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jmoiron/sqlx"
+)
+
+const (
+	gradeSourceTeacher = "teacher"
+	gradeSourceRegrade = "regrade"
+	gradeSourceAppeal  = "appeal"
+)
+
+// SolutionAccess schützt Endpunkte zu einer Lösung anhand des Besitzers der Aufgabe.
+func SolutionAccess(c *gin.Context) {
+	var userID int
+	err := database.DB.Get(&userID, `
+		SELECT tasks.user_id
+		FROM solutions
+			JOIN tasks ON tasks.id = solutions.task_id
+		WHERE solutions.id = ?`, c.Param("solution_id"))
+	if errors.Is(err, sql.ErrNoRows) {
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "Lösung nicht gefunden"})
+		return
+	}
+	if err != nil {
+		log.Printf("DB Error (solution owner): %v", err)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Fehler beim Abrufen der Lösung"})
+		return
+	}
+
+	c.Set("solution_owner", userID)
+	authorizeUser(c, userID)
+}
+
+// solutionReviewer stellt sicher, dass eine Lehrkraft nicht ihre eigene Lösung bewertet.
+func solutionReviewer(c *gin.Context) (int, int, bool) {
+	solutionID, err := strconv.Atoi(c.Param("solution_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Ungültige Lösungs-ID"})
+		return 0, 0, false
+	}
+
+	userID, _ := currentUser(c)
+	if c.GetInt("solution_owner") == userID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Eigene Lösungen können nicht bewertet werden"})
+		return 0, 0, false
+	}
+
+	return solutionID, userID, true
+}
+
+// changeMark setzt die gültige Note einer Lösung, protokolliert die Änderung und korrigiert
+// die Wertungen. Die ursprüngliche Note der KI bleibt in ai_mark erhalten, raw_mark behält
+// die Note vor dem Verspätungsabzug.
+func changeMark(tx *sqlx.Tx, solutionID int, source string, changedBy *int, mark float64, reason string) error {
+	var previous *float64
+	if err := tx.Get(&previous, "SELECT mark FROM solutions WHERE id = ?", solutionID); err != nil {
+		return err
+	}
+
+	now := time.Now().UnixMilli()
+	_, err := tx.Exec(`
+		UPDATE solutions
+		SET ai_mark = COALESCE(ai_mark, raw_mark, mark), mark = ?, graded_by = ?, graded_at = ?, needs_review = 0
+		WHERE id = ?
+	`, mark, changedBy, now, solutionID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO grade_changes (solution_id, source, changed_by, previous_mark, mark, reason, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`, solutionID, source, changedBy, previous, mark, reason, now)
+	if err != nil {
+		return err
+	}
+
+	return correctSkillRatings(tx, int64(solutionID))
+}
+
+func OverrideGrade(c *gin.Context) {
+	solutionID, teacherID, ok := solutionReviewer(c)
+	if !ok {
+		return
+	}
+
+	var req models.GradeOverrideRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if req.Mark < 1 || req.Mark > 6 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Die Note muss zwischen 1,0 und 6,0 liegen"})
+		return
+	}
+	if strings.TrimSpace(req.Reason) == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Eine Begründung ist erforderlich"})
+		return
+	}
+
+	tx, err := database.DB.Beginx()
+	if err != nil {
+		log.Printf("Transaction start error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Fehler beim Starten der Transaktion"})
+		return
+	}
+	defer tx.Rollback()
+
+	mark := math.Round(req.Mark*10) / 10
+	if err := changeMark(tx, solutionID, gradeSourceTeacher, &teacherID, mark, req.Reason); err != nil {
+		log.Printf("DB Error (grade override): %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Fehler beim Ändern der Note"})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Printf("Transaction commit error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Fehler beim Abschließen der Transaktion"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"solution_id": solutionID, "mark": mark, "message": "Note erfolgreich geändert"})
+}
+
+func GetSolutionGrades(c *gin.Context) {
+	var grades models.SolutionGrades
+	err := database.DB.Get(&grades, `
+		SELECT id, COALESCE(ai_mark, raw_mark, mark) AS ai_mark, mark, late_penalty, graded_by, graded_at
+		FROM solutions
+		WHERE id = ?`, c.Param("solution_id"))
+	if err != nil {
+		log.Printf("DB Error (solution grades): %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Fehler beim Abrufen der Note"})
+		return
+	}
+
+	grades.Changes = []models.GradeChange{}
+	err = database.DB.Select(&grades.Changes, `
+		SELECT grade_changes.id, source, changed_by, users.username AS changed_by_name,
+			previous_mark, mark, reason, created_at
+		FROM grade_changes
+			LEFT JOIN users ON users.id = grade_changes.changed_by
+		WHERE solution_id = ?
+		ORDER BY grade_changes.id`, grades.SolutionID)
+	if err != nil {
+		log.Printf("DB Error (grade changes): %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Fehler beim Abrufen des Notenverlaufs"})
+		return
+	}
+
+	c.JSON(http.StatusOK, grades)
+}
+
+func loadSolutionComments(solutionID int) ([]models.SolutionComment, error) {
+	comments := []models.SolutionComment{}
+	err := database.DB.Select(&comments, `
+		SELECT solution_comments.id, author_id, users.username AS author,
+			start_line, end_line, body, created_at
+		FROM solution_comments
+			JOIN users ON users.id = solution_comments.author_id
+		WHERE solution_id = ?
+		ORDER BY start_line, solution_comments.id`, solutionID)
+	return comments, err
+}
+
+func AddSolutionComment(c *gin.Context) {
+	solutionID, teacherID, ok := solutionReviewer(c)
+	if !ok {
+		return
+	}
+
+	var req models.SolutionCommentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var code string
+	if err := database.DB.Get(&code, "SELECT COALESCE(code, '') FROM solutions WHERE id = ?", solutionID); err != nil {
+		log.Printf("DB Error (solution code): %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Fehler beim Abrufen der Lösung"})
+		return
+	}
+
+	if req.EndLine == 0 {
+		req.EndLine = req.StartLine
+	}
+	lines := strings.Count(code, "\n") + 1
+	if req.StartLine < 1 || req.EndLine < req.StartLine || req.EndLine > lines {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Ungültiger Zeilenbereich", "lines": lines})
+		return
+	}
+	if strings.TrimSpace(req.Body) == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Kommentar darf nicht leer sein"})
+		return
+	}
+
+	res, err := database.DB.Exec(`
+		INSERT INTO solution_comments (solution_id, author_id, start_line, end_line, body, created_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`, solutionID, teacherID, req.StartLine, req.EndLine, req.Body, time.Now().UnixMilli())
+	if err != nil {
+		log.Printf("DB Error (comment insert): %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Fehler beim Speichern des Kommentars"})
+		return
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Fehler beim Abrufen der Kommentar-ID"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"comment_id": id, "message": "Kommentar erfolgreich gespeichert"})
+}
+
+func GetSolutionComments(c *gin.Context) {
+	solutionID, err := strconv.Atoi(c.Param("solution_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Ungültige Lösungs-ID"})
+		return
+	}
+
+	comments, err := loadSolutionComments(solutionID)
+	if err != nil {
+		log.Printf("DB Error (comments): %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Fehler beim Abrufen der Kommentare"})
+		return
+	}
+
+	c.JSON(http.StatusOK, comments)
+}
@@ -0,0 +1,174 @@
+package handlers
+
+import (
+	"api-test/database"
+	"api-test/models"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const maxImportLength = 5000
+
+// normalizeImportedTask bringt eine mitgebrachte Aufgabe mit der KI in das Format der
+// generierten Aufgaben: Level, Zeitschätzung, Signaturen und, falls keine mitgegeben
+// wurden, Tests. Die Anforderungen selbst bleiben unverändert.
+func normalizeImportedTask(req models.TaskImportRequest) (models.TaskResponse, error) {
+	var taskResponse models.TaskResponse
+
+	testInstruction := `- Schreibe 3 bis 6 Tests mit dem Standard-Testframework der Sprache (z. B. unittest, testing, JUnit), die die Signaturen aus "entry_points" aufrufen und auch Randfälle prüfen.`
+	if req.Tests != "" {
+		testInstruction = `- Es wurden Tests mitgegeben. Gib für "tests" einen leeren String zurück.`
+	}
+
+	entryPointInstruction := `- Lege die Signaturen fest, über die die Aufgabe gelöst wird, passend zur Aufgabenstellung.`
+	if req.StarterCode != "" {
+		entryPointInstruction = `- Übernimm die Signaturen genau so, wie sie im mitgegebenen Code stehen.`
+	}
+
+	prompt := fmt.Sprintf(`
+Goal:
+Bringe eine Programmieraufgabe, die Studierende aus einer anderen Lehrveranstaltung mitgebracht haben, in unser Aufgabenformat.
+
+Return Format:
+- Gib keine Code-Fences an.
+- Exaktes JSON-Format (zwingend im JSON-Format, keine illegalen Zeichen, keinerlei zusätzlichen Text!):
+{
+  "task": "<klar formulierte Aufgabenstellung>",
+  "level": "<%s>",
+  "time_estimation_minutes": <geschätzte Zeit als Zahl>,
+  "entry_points": ["<Signatur>", ...],
+  "tests": "<Testcode>"
+}
+
+Instructions:
+- Übernimm alle Anforderungen der Aufgabe. Formuliere sie klarer, ergänze Angaben zu Ein- und Ausgabe nur, wenn sie sich eindeutig ergeben, und erfinde keine zusätzlichen Anforderungen.
+- Schätze den Schwierigkeitsgrad für Studierende ein.
+- Gib realistische und nicht überzogene Zeitschätzungen an. Die Zeitschätzung darf auf keinen Fall 0 sein!
+%s
+%s
+
+Context Dump:
+- Programmiersprache: "%s";
+- Mitgebrachte Aufgabe: %q;
+- Mitgegebener Code: %q;
+- Mitgegebene Tests: %q;
+- Zusätzliche Anmerkungen: %q
+`, strings.Join(taskLevels, "|"), entryPointInstruction, testInstruction, req.Language, req.Description,
+		req.StarterCode, req.Tests, req.Comment)
+
+	response, err := GetAIResponse(prompt)
+	if err != nil {
+		return taskResponse, err
+	}
+
+	jsonString, err := CleanAndExtractJSON(response)
+	if err != nil {
+		log.Printf("Fehler beim Extrahieren von JSON: %v\nOriginal: %s\n", err, response)
+		return taskResponse, fmt.Errorf("%w: %v", errAIResponseFormat, err)
+	}
+
+	if err := json.Unmarshal([]byte(jsonString), &taskResponse); err != nil {
+		log.Printf("json.Unmarshal-Fehler: %v\nBereinigtes JSON: %s\n", err, jsonString)
+		return taskResponse, fmt.Errorf("%w: %v", errAIResponseFormat, err)
+	}
+
+	switch {
+	case strings.TrimSpace(taskResponse.Task) == "":
+		return taskResponse, fmt.Errorf("%w: Aufgabenstellung fehlt", errAIResponseFormat)
+	case !slices.Contains(taskLevels, taskResponse.Level):
+		return taskResponse, fmt.Errorf("%w: ungültiges Level %q", errAIResponseFormat, taskResponse.Level)
+	case taskResponse.TimeEstimation <= 0:
+		return taskResponse, fmt.Errorf("%w: Zeitschätzung fehlt", errAIResponseFormat)
+	}
+
+	if req.Tests != "" {
+		taskResponse.Tests = req.Tests
+	}
+	taskResponse.StarterCode = req.StarterCode
+	if req.StarterCode != "" {
+		if err := validateScaffold(req.StarterCode, taskResponse.EntryPoints); err != nil {
+			log.Printf("normalizeImportedTask: Signaturen verworfen: %v", err)
+			taskResponse.EntryPoints = nil
+		}
+	}
+	if len(taskResponse.EntryPoints) > maxEntryPoints {
+		taskResponse.EntryPoints = taskResponse.EntryPoints[:maxEntryPoints]
+	}
+	taskResponse.TaskType = taskTypeWrite
+
+	return taskResponse, nil
+}
+
+// ImportTask legt eine mitgebrachte Aufgabe an. Sie wird als vom User eingebracht
+// markiert; Chat und Bewertung funktionieren wie bei generierten Aufgaben.
+func ImportTask(c *gin.Context) {
+	var req models.TaskImportRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	req.Language = strings.ToLower(strings.TrimSpace(req.Language))
+	req.Description = strings.TrimSpace(req.Description)
+
+	switch {
+	case req.Language == "":
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Programmiersprache fehlt"})
+		return
+	case req.Description == "":
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Aufgabenstellung fehlt"})
+		return
+	case len(req.Description) > maxImportLength || len(req.Comment) > maxImportLength:
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Aufgabenstellung ist länger als %d Zeichen", maxImportLength)})
+		return
+	case len(req.StarterCode) > maxFileSize || len(req.Tests) > maxFileSize:
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Code oder Tests sind größer als %d Bytes", maxFileSize)})
+		return
+	}
+
+	taskResponse, err := normalizeImportedTask(req)
+	if err != nil {
+		log.Printf("ImportTask: %v", err)
+		respondGenerationError(c, err)
+		return
+	}
+
+	userID, _ := currentUser(c)
+
+	similarity, _, err := mostSimilarTask(userID, req.Language, taskResponse.Task, true)
+	if err != nil {
+		log.Printf("ImportTask: similarity check failed: %v", err)
+	}
+	taskResponse.Similarity = similarity
+
+	entryPoints, _ := json.Marshal(taskResponse.EntryPoints)
+	res, err := database.DB.Exec(`
+		INSERT INTO tasks (user_id, description, language, level, time_estimated, similarity, task_type, starter_code,
+			entry_points, tests, user_provided, source_text)
+		VALUES (?, ?, ?, ?, ?, ?, ?, NULLIF(?, ''), NULLIF(?, 'null'), NULLIF(?, ''), 1, ?)
+	`, userID, taskResponse.Task, req.Language, taskResponse.Level, taskResponse.TimeEstimation, similarity, taskTypeWrite,
+		taskResponse.StarterCode, string(entryPoints), taskResponse.Tests, req.Description)
+	if err != nil {
+		log.Printf("DB Error (task import): %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Fehler beim Speichern der Aufgabe"})
+		return
+	}
+
+	taskID, err := res.LastInsertId()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Fehler beim Abrufen der Task-ID"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"task_id": taskID,
+		"task":    taskResponse,
+		"message": "Aufgabe erfolgreich importiert",
+	})
+}
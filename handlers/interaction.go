@@ -15,6 +15,7 @@ func CreateInteraction(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	interaction.UserID, _ = currentUser(c)
 
 	start := time.Now()
 	response, err := GetAIResponse(interaction.Input)
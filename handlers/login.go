@@ -0,0 +1,295 @@
+package handlers
+
+import (
+	"api-test/database"
+	"api-test/models"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"log"
+	"math/bits"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// Fehlversuche zählen so lange mit; eine Sperre endet spätestens so lange nach dem letzten.
+	loginWindow = 15 * time.Minute
+	// So lange bleiben Anmeldeversuche für die Übersicht der Admins erhalten.
+	loginAttemptRetention = 30 * 24 * time.Hour
+
+	loginDelayAfter       = 3
+	loginMaxDelay         = time.Minute
+	loginLockAfter        = 10
+	loginIPChallengeAfter = 10
+	loginIPLockAfter      = 50
+
+	challengeDifficulty = 16
+	challengeLifetime   = 5 * time.Minute
+)
+
+const (
+	loginReasonOK          = "ok"
+	loginReasonCredentials = "credentials"
+	loginReasonLocked      = "locked"
+	loginReasonDelayed     = "delayed"
+	loginReasonChallenge   = "challenge"
+	// Ein Versuch, dessen Passwort gerade geprüft wird. Er zählt bis zum Ergebnis als
+	// Fehlversuch, damit parallele Versuche Wartezeit und Sperre nicht umgehen.
+	loginReasonPending = "pending"
+)
+
+// loginMu hält Prüfen der Fehlversuche und Vormerken des neuen Versuchs zusammen. Die
+// Passwortprüfung selbst läuft außerhalb, damit Logins sich nicht gegenseitig ausbremsen.
+var loginMu sync.Mutex
+
+type loginFailures struct {
+	Count int   `db:"count"`
+	Last  int64 `db:"last"`
+}
+
+// loginGuard fasst die Fehlversuche für Username und IP zusammen. Beim Username zählt
+// nur, was nach dem letzten erfolgreichen Login kam; bei der IP nicht, damit ein
+// Angreifer den Zähler nicht mit dem eigenen Konto zurücksetzen kann.
+type loginGuard struct {
+	user loginFailures
+	ip   loginFailures
+}
+
+func loadLoginGuard(username, ip string, now time.Time) (loginGuard, error) {
+	var guard loginGuard
+	since := now.Add(-loginWindow).UnixMilli()
+
+	err := database.DB.Get(&guard.user, `
+		SELECT COUNT(*) AS count, COALESCE(MAX(created_at), 0) AS last
+		FROM login_attempts
+		WHERE username = ? AND reason IN (?, ?)
+			AND created_at > MAX(?, COALESCE((SELECT MAX(created_at) FROM login_attempts WHERE username = ? AND success = 1), 0))`,
+		username, loginReasonCredentials, loginReasonPending, since, username)
+	if err != nil {
+		return guard, err
+	}
+
+	err = database.DB.Get(&guard.ip, `
+		SELECT COUNT(*) AS count, COALESCE(MAX(created_at), 0) AS last
+		FROM login_attempts
+		WHERE ip = ? AND reason IN (?, ?) AND created_at > ?`,
+		ip, loginReasonCredentials, loginReasonPending, since)
+
+	return guard, err
+}
+
+func (g loginGuard) lockedUntil() time.Time {
+	var until time.Time
+	if g.user.Count >= loginLockAfter {
+		until = time.UnixMilli(g.user.Last).Add(loginWindow)
+	}
+	if g.ip.Count >= loginIPLockAfter {
+		if ipUntil := time.UnixMilli(g.ip.Last).Add(loginWindow); ipUntil.After(until) {
+			until = ipUntil
+		}
+	}
+	return until
+}
+
+// nextAttempt liefert den frühesten Zeitpunkt für den nächsten Versuch; die Wartezeit
+// verdoppelt sich mit jedem Fehlversuch ab loginDelayAfter.
+func (g loginGuard) nextAttempt() time.Time {
+	if g.user.Count < loginDelayAfter {
+		return time.Time{}
+	}
+	delay := min(time.Second<<(g.user.Count-loginDelayAfter), loginMaxDelay)
+	return time.UnixMilli(g.user.Last).Add(delay)
+}
+
+func (g loginGuard) challengeRequired() bool {
+	return g.user.Count >= loginDelayAfter || g.ip.Count >= loginIPChallengeAfter
+}
+
+func recordLoginAttempt(username string, userID *int, ip string, success bool, reason string) {
+	_, err := database.DB.Exec(`
+		INSERT INTO login_attempts (username, user_id, ip, success, reason, created_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`, username, userID, ip, success, reason, time.Now().UnixMilli())
+	if err != nil {
+		log.Printf("DB Error (login attempt): %v", err)
+	}
+}
+
+// admitLogin prüft Sperre, Wartezeit und Challenge und merkt den Versuch als offen vor,
+// bevor ein paralleler Versuch den Zählerstand liest. Bei false ist die Antwort geschrieben.
+func admitLogin(c *gin.Context, creds models.LoginRequest, ip string) (int64, loginGuard, bool) {
+	loginMu.Lock()
+	defer loginMu.Unlock()
+
+	now := time.Now()
+	guard, err := loadLoginGuard(creds.Username, ip, now)
+	if err != nil {
+		log.Printf("DB Error (login guard): %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Fehler bei der Anmeldung"})
+		return 0, guard, false
+	}
+
+	if until := guard.lockedUntil(); until.After(now) {
+		recordLoginAttempt(creds.Username, nil, ip, false, loginReasonLocked)
+		c.JSON(http.StatusTooManyRequests, gin.H{
+			"error":        "Zu viele fehlgeschlagene Anmeldeversuche, die Anmeldung ist vorübergehend gesperrt",
+			"locked_until": until.UnixMilli(),
+			"retry_after":  retryAfter(c, until),
+		})
+		return 0, guard, false
+	}
+
+	if next := guard.nextAttempt(); next.After(now) {
+		recordLoginAttempt(creds.Username, nil, ip, false, loginReasonDelayed)
+		c.JSON(http.StatusTooManyRequests, gin.H{
+			"error":       "Bitte warte vor dem nächsten Anmeldeversuch",
+			"retry_after": retryAfter(c, next),
+		})
+		return 0, guard, false
+	}
+
+	if guard.challengeRequired() && !verifyLoginChallenge(creds.Challenge, creds.Nonce) {
+		recordLoginAttempt(creds.Username, nil, ip, false, loginReasonChallenge)
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error":              "Bitte zuerst die Challenge lösen",
+			"challenge_required": true,
+		})
+		return 0, guard, false
+	}
+
+	var attemptID int64
+	err = database.DB.Get(&attemptID, `
+		INSERT INTO login_attempts (username, ip, success, reason, created_at)
+		VALUES (?, ?, 0, ?, ?)
+		RETURNING id
+	`, creds.Username, ip, loginReasonPending, now.UnixMilli())
+	if err != nil {
+		log.Printf("DB Error (login attempt): %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Fehler bei der Anmeldung"})
+		return 0, guard, false
+	}
+
+	return attemptID, guard, true
+}
+
+// finishLoginAttempt trägt das Ergebnis in den vorgemerkten Versuch ein.
+func finishLoginAttempt(attemptID int64, userID *int, success bool, reason string) {
+	_, err := database.DB.Exec("UPDATE login_attempts SET user_id = ?, success = ?, reason = ? WHERE id = ?",
+		userID, success, reason, attemptID)
+	if err != nil {
+		log.Printf("DB Error (login attempt): %v", err)
+	}
+}
+
+// RunLoginAttemptSweeper löscht Anmeldeversuche, die älter als loginAttemptRetention sind.
+func RunLoginAttemptSweeper(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		before := time.Now().Add(-loginAttemptRetention).UnixMilli()
+		if _, err := database.DB.Exec("DELETE FROM login_attempts WHERE created_at < ?", before); err != nil {
+			log.Printf("RunLoginAttemptSweeper: delete failed: %v", err)
+		}
+	}
+}
+
+func retryAfter(c *gin.Context, until time.Time) int64 {
+	seconds := int64(time.Until(until).Seconds()) + 1
+	c.Header("Retry-After", strconv.FormatInt(seconds, 10))
+	return seconds
+}
+
+// verifyLoginChallenge prüft den Proof of Work: SHA-256 von "<challenge>:<nonce>" muss mit
+// challengeDifficulty Null-Bits beginnen. Jede Challenge gilt nur einmal.
+func verifyLoginChallenge(challenge, nonce string) bool {
+	if challenge == "" || nonce == "" {
+		return false
+	}
+
+	sum := sha256.Sum256([]byte(challenge + ":" + nonce))
+	zeros := 0
+	for _, b := range sum {
+		zeros += bits.LeadingZeros8(b)
+		if b != 0 {
+			break
+		}
+	}
+	if zeros < challengeDifficulty {
+		return false
+	}
+
+	res, err := database.DB.Exec("DELETE FROM login_challenges WHERE challenge = ? AND expires_at > ?",
+		challenge, time.Now().UnixMilli())
+	if err != nil {
+		log.Printf("DB Error (challenge): %v", err)
+		return false
+	}
+	n, _ := res.RowsAffected()
+	return n == 1
+}
+
+// GetLoginChallenge gibt eine Challenge aus, die das Frontend nach wiederholten
+// Fehlversuchen lösen und mit dem Login mitschicken muss.
+func GetLoginChallenge(c *gin.Context) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Fehler beim Erstellen der Challenge"})
+		return
+	}
+	challenge := hex.EncodeToString(buf)
+
+	now := time.Now()
+	if _, err := database.DB.Exec("DELETE FROM login_challenges WHERE expires_at <= ?", now.UnixMilli()); err != nil {
+		log.Printf("DB Error (challenge cleanup): %v", err)
+	}
+
+	expiresAt := now.Add(challengeLifetime).UnixMilli()
+	_, err := database.DB.Exec("INSERT INTO login_challenges (challenge, expires_at) VALUES (?, ?)", challenge, expiresAt)
+	if err != nil {
+		log.Printf("DB Error (challenge): %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Fehler beim Erstellen der Challenge"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"challenge":  challenge,
+		"algorithm":  "sha256",
+		"difficulty": challengeDifficulty,
+		"expires_at": expiresAt,
+	})
+}
+
+// GetLoginAttempts listet die letzten Anmeldeversuche, optional gefiltert nach
+// Username, IP oder nur Fehlversuchen.
+func GetLoginAttempts(c *gin.Context) {
+	query := "SELECT * FROM login_attempts WHERE 1 = 1"
+	var args []any
+
+	if username := c.Query("username"); username != "" {
+		query += " AND username = ?"
+		args = append(args, username)
+	}
+	if ip := c.Query("ip"); ip != "" {
+		query += " AND ip = ?"
+		args = append(args, ip)
+	}
+	if c.Query("failed") == "true" {
+		query += " AND success = 0"
+	}
+	query += " ORDER BY id DESC LIMIT 200"
+
+	attempts := []models.LoginAttempt{}
+	if err := database.DB.Select(&attempts, query, args...); err != nil {
+		log.Printf("DB Error (login attempts): %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Fehler beim Abrufen der Anmeldeversuche"})
+		return
+	}
+
+	c.JSON(http.StatusOK, attempts)
+}
@@ -0,0 +1,55 @@
+package handlers
+
+import (
+	"api-test/database"
+	"api-test/models"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func notify(userID int, kind string, referenceID int, message string) {
+	_, err := database.DB.Exec(`
+		INSERT INTO notifications (user_id, kind, reference_id, message, created_at)
+		VALUES (?, ?, ?, ?, ?)
+	`, userID, kind, referenceID, message, time.Now().UnixMilli())
+	if err != nil {
+		log.Printf("notify(%d, %s): %v", userID, kind, err)
+	}
+}
+
+func GetNotifications(c *gin.Context) {
+	query := `
+		SELECT id, kind, reference_id, message, created_at, read_at
+		FROM notifications
+		WHERE user_id = ?`
+	if c.Query("unread") == "true" {
+		query += " AND read_at IS NULL"
+	}
+	query += " ORDER BY id DESC LIMIT 100"
+
+	notifications := []models.Notification{}
+	if err := database.DB.Select(&notifications, query, c.Query("user_id")); err != nil {
+		log.Printf("DB Error (notifications): %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Fehler beim Abrufen der Benachrichtigungen"})
+		return
+	}
+
+	c.JSON(http.StatusOK, notifications)
+}
+
+func MarkNotificationsRead(c *gin.Context) {
+	userID, _ := currentUser(c)
+
+	_, err := database.DB.Exec("UPDATE notifications SET read_at = ? WHERE user_id = ? AND read_at IS NULL",
+		time.Now().UnixMilli(), userID)
+	if err != nil {
+		log.Printf("DB Error (notifications read): %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Fehler beim Aktualisieren der Benachrichtigungen"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Benachrichtigungen als gelesen markiert"})
+}
@@ -11,18 +11,33 @@ import (
 	"github.com/sashabaranov/go-openai"
 )
 
+const (
+	defaultModel       = openai.GPT4Turbo
+	defaultTemperature = 0.2
+)
+
 func GetAIResponse(prompt string) (string, error) {
-	client := openai.NewClient(os.Getenv("OPENAI_API_KEY"))
+	return GetAIResponseWith(defaultModel, defaultTemperature, prompt)
+}
+
+// GetAIResponseWith stellt die Anfrage mit einem bestimmten Modell und einer bestimmten Temperatur.
+func GetAIResponseWith(model string, temperature float32, prompt string) (string, error) {
+	config := openai.DefaultConfig(os.Getenv("OPENAI_API_KEY"))
+	if baseURL := os.Getenv("OPENAI_BASE_URL"); baseURL != "" {
+		config.BaseURL = baseURL
+	}
+
+	client := openai.NewClientWithConfig(config)
 	resp, err := client.CreateChatCompletion(
 		context.Background(),
 		openai.ChatCompletionRequest{
-			Model: openai.GPT4Turbo,
+			Model: model,
 			Messages: []openai.ChatCompletionMessage{
 				{Role: "developer", Content: "You are a helpful coding tutor."},
 				{Role: "user", Content: prompt},
 			},
 			MaxTokens:   1000,
-			Temperature: 0.2,
+			Temperature: temperature,
 		},
 	)
 
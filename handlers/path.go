@@ -0,0 +1,373 @@
+package handlers
+
+import (
+	"api-test/database"
+	"api-test/models"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jmoiron/sqlx"
+)
+
+const passingMark = 4.0
+
+const (
+	moduleLocked    = "locked"
+	moduleUnlocked  = "unlocked"
+	moduleCompleted = "completed"
+)
+
+func CreateLearningPath(c *gin.Context) {
+	var req models.LearningPathRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if req.Language == "" || strings.TrimSpace(req.Title) == "" || len(req.Modules) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Sprache, Titel und mindestens ein Modul sind erforderlich"})
+		return
+	}
+
+	for i, m := range req.Modules {
+		if strings.TrimSpace(m.Title) == "" || !slices.Contains(taskLevels, m.TargetLevel) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Jedes Modul braucht einen Titel und ein gültiges Ziel-Level", "module": i})
+			return
+		}
+		for _, p := range m.Prerequisites {
+			// Voraussetzungen verweisen nur auf frühere Module, dadurch bleibt der Graph azyklisch.
+			if p < 0 || p >= i {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Voraussetzungen müssen auf frühere Module verweisen", "module": i})
+				return
+			}
+		}
+	}
+
+	var catalogIDs []int
+	for _, m := range req.Modules {
+		catalogIDs = append(catalogIDs, m.CatalogTasks...)
+	}
+	if len(catalogIDs) > 0 {
+		query, args, err := sqlx.In("SELECT id FROM catalog_tasks WHERE id IN (?)", catalogIDs)
+		var known []int
+		if err == nil {
+			err = database.DB.Select(&known, query, args...)
+		}
+		if err != nil {
+			log.Printf("DB Error (path catalog tasks): %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Fehler beim Prüfen der Katalogaufgaben"})
+			return
+		}
+		for i, m := range req.Modules {
+			for _, id := range m.CatalogTasks {
+				if !slices.Contains(known, id) {
+					c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Katalogaufgabe %d existiert nicht", id), "module": i})
+					return
+				}
+			}
+		}
+	}
+
+	tx, err := database.DB.Beginx()
+	if err != nil {
+		log.Printf("Transaction start error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Fehler beim Starten der Transaktion"})
+		return
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec(`
+		INSERT INTO learning_paths (language, title, description, created_at)
+		VALUES (?, ?, ?, ?)
+	`, strings.ToLower(req.Language), req.Title, req.Description, time.Now().UnixMilli())
+	if err != nil {
+		log.Printf("DB Error (path insert): %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Fehler beim Speichern des Lernpfads"})
+		return
+	}
+
+	pathID, err := res.LastInsertId()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Fehler beim Abrufen der Lernpfad-ID"})
+		return
+	}
+
+	moduleIDs := make([]int64, len(req.Modules))
+	for i, m := range req.Modules {
+		res, err := tx.Exec(`
+			INSERT INTO path_modules (path_id, position, title, description, target_level)
+			VALUES (?, ?, ?, ?, ?)
+		`, pathID, i, m.Title, m.Description, m.TargetLevel)
+		if err == nil {
+			moduleIDs[i], err = res.LastInsertId()
+		}
+
+		for _, topic := range normalizeTopics(m.Topics) {
+			if err != nil {
+				break
+			}
+			if _, err = tx.Exec("INSERT OR IGNORE INTO topics (name) VALUES (?)", topic); err != nil {
+				break
+			}
+			_, err = tx.Exec(`
+				INSERT OR IGNORE INTO path_module_topics (module_id, topic_id)
+				SELECT ?, id FROM topics WHERE name = ?
+			`, moduleIDs[i], topic)
+		}
+
+		for _, catalogTaskID := range m.CatalogTasks {
+			if err != nil {
+				break
+			}
+			_, err = tx.Exec(`
+				INSERT OR IGNORE INTO path_module_tasks (module_id, catalog_task_id)
+				VALUES (?, ?)
+			`, moduleIDs[i], catalogTaskID)
+		}
+
+		for _, p := range m.Prerequisites {
+			if err != nil {
+				break
+			}
+			_, err = tx.Exec(`
+				INSERT OR IGNORE INTO path_module_prerequisites (module_id, prerequisite_id)
+				VALUES (?, ?)
+			`, moduleIDs[i], moduleIDs[p])
+		}
+
+		if err != nil {
+			log.Printf("DB Error (path module insert): %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Fehler beim Speichern der Module"})
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Printf("Transaction commit error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Fehler beim Abschließen der Transaktion"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"path_id": pathID, "message": "Lernpfad erfolgreich gespeichert"})
+}
+
+func loadLearningPath(pathID int) (models.LearningPath, error) {
+	var path models.LearningPath
+	err := database.DB.Get(&path, `
+		SELECT id, language, title, COALESCE(description, '') AS description, created_at
+		FROM learning_paths
+		WHERE id = ?`, pathID)
+	if err != nil {
+		return path, err
+	}
+
+	err = database.DB.Select(&path.Modules, `
+		SELECT id, position, title, COALESCE(description, '') AS description, target_level
+		FROM path_modules
+		WHERE path_id = ?
+		ORDER BY position`, pathID)
+	if err != nil {
+		return path, err
+	}
+
+	for i := range path.Modules {
+		m := &path.Modules[i]
+		m.Topics, m.CatalogTasks, m.Prerequisites = []string{}, []int{}, []int{}
+
+		err = database.DB.Select(&m.Topics, `
+			SELECT topics.name
+			FROM path_module_topics pmt
+				JOIN topics ON topics.id = pmt.topic_id
+			WHERE pmt.module_id = ?
+			ORDER BY topics.name`, m.ID)
+		if err == nil {
+			err = database.DB.Select(&m.CatalogTasks, `
+				SELECT catalog_task_id FROM path_module_tasks
+				WHERE module_id = ?
+				ORDER BY catalog_task_id`, m.ID)
+		}
+		if err == nil {
+			err = database.DB.Select(&m.Prerequisites, `
+				SELECT prerequisite_id FROM path_module_prerequisites
+				WHERE module_id = ?
+				ORDER BY prerequisite_id`, m.ID)
+		}
+		if err != nil {
+			return path, err
+		}
+	}
+
+	return path, nil
+}
+
+func GetLearningPaths(c *gin.Context) {
+	query := `
+		SELECT id, language, title, COALESCE(description, '') AS description, created_at
+		FROM learning_paths`
+	var args []any
+
+	if language := c.Query("language"); language != "" {
+		query += " WHERE language = ?"
+		args = append(args, strings.ToLower(language))
+	}
+	query += " ORDER BY id"
+
+	paths := []models.LearningPath{}
+	if err := database.DB.Select(&paths, query, args...); err != nil {
+		log.Printf("DB Error (paths): %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Fehler beim Abrufen der Lernpfade"})
+		return
+	}
+
+	c.JSON(http.StatusOK, paths)
+}
+
+func GetLearningPath(c *gin.Context) {
+	pathID, err := strconv.Atoi(c.Param("path_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Ungültige Lernpfad-ID"})
+		return
+	}
+
+	path, err := loadLearningPath(pathID)
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Lernpfad nicht gefunden"})
+		return
+	}
+	if err != nil {
+		log.Printf("DB Error (path): %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Fehler beim Abrufen des Lernpfads"})
+		return
+	}
+
+	c.JSON(http.StatusOK, path)
+}
+
+// pathProgress ermittelt aus den bestandenen Lösungen eines Users, welche Anforderungen
+// der Module erfüllt sind. Ein Thema gilt als erfüllt, wenn eine Aufgabe dazu mindestens
+// auf dem Ziel-Level des Moduls bestanden wurde.
+func pathProgress(path models.LearningPath, userID int) (models.PathProgress, error) {
+	progress := models.PathProgress{
+		PathID:   path.ID,
+		Title:    path.Title,
+		Language: path.Language,
+		Modules:  []models.ModuleProgress{},
+	}
+
+	outcomes, err := loadSolutionOutcomes(userID)
+	if err != nil {
+		return progress, err
+	}
+
+	passedTasks := make(map[int]bool)
+	passedTopicLevel := make(map[string]int)
+	for _, o := range outcomes {
+		if o.Language != path.Language || o.Mark > passingMark {
+			continue
+		}
+		if o.CatalogTaskID > 0 {
+			passedTasks[o.CatalogTaskID] = true
+		}
+		for _, topic := range normalizeTopics(o.Topics) {
+			if level, ok := passedTopicLevel[topic]; !ok || levelIndex(o.Level) > level {
+				passedTopicLevel[topic] = levelIndex(o.Level)
+			}
+		}
+	}
+
+	completed := make(map[int]bool)
+	var total float64
+
+	for _, m := range path.Modules {
+		mp := models.ModuleProgress{
+			PathModule:      m,
+			CompletedTasks:  []int{},
+			CompletedTopics: []string{},
+		}
+
+		for _, id := range m.CatalogTasks {
+			if passedTasks[id] {
+				mp.CompletedTasks = append(mp.CompletedTasks, id)
+			}
+		}
+		for _, topic := range m.Topics {
+			if level, ok := passedTopicLevel[topic]; ok && level >= levelIndex(m.TargetLevel) {
+				mp.CompletedTopics = append(mp.CompletedTopics, topic)
+			}
+		}
+
+		requirements := len(m.CatalogTasks) + len(m.Topics)
+		if requirements > 0 {
+			mp.Progress = float64(len(mp.CompletedTasks)+len(mp.CompletedTopics)) / float64(requirements)
+		}
+
+		unlocked := true
+		for _, p := range m.Prerequisites {
+			unlocked = unlocked && completed[p]
+		}
+
+		switch {
+		case !unlocked:
+			mp.Status = moduleLocked
+		case requirements == 0 || mp.Progress == 1:
+			mp.Status = moduleCompleted
+			mp.Progress = 1
+			completed[m.ID] = true
+		default:
+			mp.Status = moduleUnlocked
+		}
+
+		mp.Progress = math.Round(mp.Progress*1000) / 10
+		total += mp.Progress
+		progress.Modules = append(progress.Modules, mp)
+	}
+
+	if len(progress.Modules) > 0 {
+		progress.Completion = math.Round(total/float64(len(progress.Modules))*10) / 10
+	}
+
+	return progress, nil
+}
+
+func GetLearningPathProgress(c *gin.Context) {
+	pathID, err := strconv.Atoi(c.Param("path_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Ungültige Lernpfad-ID"})
+		return
+	}
+
+	userID, err := strconv.Atoi(c.Query("user_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Ungültige User-ID"})
+		return
+	}
+
+	path, err := loadLearningPath(pathID)
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Lernpfad nicht gefunden"})
+		return
+	}
+	if err != nil {
+		log.Printf("DB Error (path): %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Fehler beim Abrufen des Lernpfads"})
+		return
+	}
+
+	progress, err := pathProgress(path, userID)
+	if err != nil {
+		log.Printf("DB Error (path progress): %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Fehler beim Berechnen des Fortschritts"})
+		return
+	}
+
+	c.JSON(http.StatusOK, progress)
+}
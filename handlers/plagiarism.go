@@ -0,0 +1,417 @@
+package handlers
+
+import (
+	"api-test/database"
+	"api-test/models"
+	"database/sql"
+	"errors"
+	"hash/fnv"
+	"log"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Die Fingerabdrücke folgen dem Winnowing-Verfahren von MOSS: Aus den Hashes aller
+// k-Gramme normalisierter Tokens wird je Fenster der kleinste ausgewählt.
+const (
+	kgramSize                    = 8
+	winnowWindow                 = 4
+	minFingerprints              = 6
+	peerSimilarityThreshold      = 0.7
+	referenceSimilarityThreshold = 0.9
+)
+
+// Treffer gegen die Musterlösung der Aufgabe heißen "task_reference". Ältere Treffer der
+// Art "reference" verglichen mit der Musterlösung aus der Bewertung und bleiben ausgeblendet.
+const (
+	similarityPeer      = "peer"
+	similarityReference = "task_reference"
+)
+
+// codeKeywords bleiben beim Normalisieren erhalten, alle anderen Bezeichner werden zu
+// einem Platzhalter, damit Umbenennungen die Ähnlichkeit nicht verdecken.
+var codeKeywords = map[string]bool{
+	"if": true, "else": true, "elif": true, "for": true, "while": true, "do": true, "switch": true,
+	"case": true, "default": true, "break": true, "continue": true, "return": true, "yield": true,
+	"def": true, "func": true, "function": true, "fn": true, "lambda": true, "class": true,
+	"struct": true, "interface": true, "enum": true, "type": true, "new": true, "try": true,
+	"catch": true, "except": true, "finally": true, "throw": true, "raise": true, "in": true,
+	"not": true, "and": true, "or": true, "is": true, "import": true, "from": true, "package": true,
+	"var": true, "let": true, "const": true, "static": true, "public": true, "private": true,
+	"range": true, "go": true, "defer": true, "select": true, "map": true, "with": true, "as": true,
+	"true": true, "false": true, "none": true, "null": true, "nil": true, "this": true, "self": true,
+}
+
+type codeToken struct {
+	Text string
+	Line int
+}
+
+func commentStyle(language string) (lineComments []string, blockComments bool) {
+	switch strings.ToLower(strings.TrimSpace(language)) {
+	case "python", "ruby", "r", "bash", "shell", "perl":
+		return []string{"#"}, false
+	case "sql", "lua", "haskell":
+		return []string{"--"}, false
+	case "php":
+		return []string{"//", "#"}, true
+	default:
+		return []string{"//"}, true
+	}
+}
+
+// tokenizeCode zerlegt Code in normalisierte Tokens. Kommentare und Leerraum fallen weg,
+// Bezeichner werden zu V, Zahlen zu N und Zeichenketten zu S.
+func tokenizeCode(code, language string) []codeToken {
+	lineComments, blockComments := commentStyle(language)
+	src := []rune(code)
+	line := 1
+
+	var tokens []codeToken
+	for i := 0; i < len(src); {
+		r := src[i]
+		rest := string(src[i:min(i+2, len(src))])
+
+		switch {
+		case r == '\n':
+			line++
+			i++
+		case unicode.IsSpace(r):
+			i++
+		case blockComments && rest == "/*":
+			for i += 2; i < len(src) && !(src[i] == '*' && i+1 < len(src) && src[i+1] == '/'); i++ {
+				if src[i] == '\n' {
+					line++
+				}
+			}
+			i += 2
+		case hasAnyPrefix(src[i:], lineComments):
+			for i < len(src) && src[i] != '\n' {
+				i++
+			}
+		case r == '"' || r == '\'' || r == '`':
+			start := line
+			for i++; i < len(src) && src[i] != r; i++ {
+				if src[i] == '\\' {
+					i++
+				} else if src[i] == '\n' {
+					line++
+				}
+			}
+			i++
+			tokens = append(tokens, codeToken{Text: "S", Line: start})
+		case unicode.IsLetter(r) || r == '_':
+			j := i
+			for j < len(src) && (unicode.IsLetter(src[j]) || unicode.IsDigit(src[j]) || src[j] == '_') {
+				j++
+			}
+			word := strings.ToLower(string(src[i:j]))
+			if !codeKeywords[word] {
+				word = "V"
+			}
+			tokens = append(tokens, codeToken{Text: word, Line: line})
+			i = j
+		case unicode.IsDigit(r):
+			for i < len(src) && (unicode.IsDigit(src[i]) || unicode.IsLetter(src[i]) || src[i] == '.') {
+				i++
+			}
+			tokens = append(tokens, codeToken{Text: "N", Line: line})
+		default:
+			tokens = append(tokens, codeToken{Text: string(r), Line: line})
+			i++
+		}
+	}
+	return tokens
+}
+
+func hasAnyPrefix(src []rune, prefixes []string) bool {
+	for _, p := range prefixes {
+		if strings.HasPrefix(string(src[:min(len(p), len(src))]), p) {
+			return true
+		}
+	}
+	return false
+}
+
+type codeFingerprint struct {
+	tokens []codeToken
+	hashes map[uint64]int
+}
+
+// fingerprintCode wählt per Winnowing die Fingerabdrücke eines Codes aus und merkt sich
+// zu jedem die Position des ersten k-Gramms.
+func fingerprintCode(code, language string) codeFingerprint {
+	fp := codeFingerprint{tokens: tokenizeCode(code, language), hashes: map[uint64]int{}}
+	if len(fp.tokens) < kgramSize {
+		return fp
+	}
+
+	grams := make([]uint64, len(fp.tokens)-kgramSize+1)
+	for i := range grams {
+		h := fnv.New64a()
+		for _, t := range fp.tokens[i : i+kgramSize] {
+			h.Write([]byte(t.Text))
+			h.Write([]byte{0})
+		}
+		grams[i] = h.Sum64()
+	}
+
+	for start := 0; ; start++ {
+		end := min(start+winnowWindow, len(grams))
+		pick := start
+		for i := start; i < end; i++ {
+			if grams[i] <= grams[pick] {
+				pick = i
+			}
+		}
+		if _, ok := fp.hashes[grams[pick]]; !ok {
+			fp.hashes[grams[pick]] = pick
+		}
+		if end == len(grams) {
+			break
+		}
+	}
+	return fp
+}
+
+// similarity ist der Anteil gemeinsamer Fingerabdrücke am kürzeren der beiden Codes.
+// So fällt auch auf, wenn eine Lösung vollständig in einer längeren steckt.
+func (fp codeFingerprint) similarity(other codeFingerprint) float64 {
+	smaller := min(len(fp.hashes), len(other.hashes))
+	if smaller < minFingerprints {
+		return 0
+	}
+
+	var shared int
+	for h := range fp.hashes {
+		if _, ok := other.hashes[h]; ok {
+			shared++
+		}
+	}
+	return math.Round(float64(shared)/float64(smaller)*100) / 100
+}
+
+// without entfernt die Fingerabdrücke, die auch im vorgegebenen Ausgangscode vorkommen.
+func (fp codeFingerprint) without(starter codeFingerprint) codeFingerprint {
+	hashes := make(map[uint64]int, len(fp.hashes))
+	for h, pos := range fp.hashes {
+		if _, ok := starter.hashes[h]; !ok {
+			hashes[h] = pos
+		}
+	}
+	return codeFingerprint{tokens: fp.tokens, hashes: hashes}
+}
+
+func (fp codeFingerprint) lines(pos int) [2]int {
+	return [2]int{fp.tokens[pos].Line, fp.tokens[pos+kgramSize-1].Line}
+}
+
+// matches fasst die gemeinsamen Fingerabdrücke zu Zeilenbereichen in beiden Codes
+// zusammen.
+func (fp codeFingerprint) matches(other codeFingerprint) []models.SimilarityMatch {
+	var found []models.SimilarityMatch
+	for h, pos := range fp.hashes {
+		if otherPos, ok := other.hashes[h]; ok {
+			found = append(found, models.SimilarityMatch{Lines: fp.lines(pos), OtherLines: other.lines(otherPos)})
+		}
+	}
+	sort.Slice(found, func(i, j int) bool { return found[i].Lines[0] < found[j].Lines[0] })
+
+	merged := []models.SimilarityMatch{}
+	for _, m := range found {
+		if n := len(merged); n > 0 {
+			last := &merged[n-1]
+			if m.Lines[0] <= last.Lines[1]+1 && m.OtherLines[0] <= last.OtherLines[1]+1 &&
+				m.OtherLines[1] >= last.OtherLines[0]-1 {
+				last.Lines[1] = max(last.Lines[1], m.Lines[1])
+				last.OtherLines[0] = min(last.OtherLines[0], m.OtherLines[0])
+				last.OtherLines[1] = max(last.OtherLines[1], m.OtherLines[1])
+				continue
+			}
+		}
+		merged = append(merged, m)
+	}
+	return merged
+}
+
+func addSimilarityFlag(solutionID int64, otherSolutionID *int, kind string, similarity float64) error {
+	_, err := database.DB.Exec(`
+		INSERT INTO similarity_flags (solution_id, other_solution_id, kind, similarity, created_at)
+		VALUES (?, ?, ?, ?, ?)
+	`, solutionID, otherSolutionID, kind, similarity, time.Now().UnixMilli())
+	return err
+}
+
+// checkSimilarity vergleicht eine neue Lösung mit den aktuellen Lösungen anderer
+// Studierender aus gemeinsamen Kursen zu derselben Aufgabe: derselben Kursaufgabe,
+// derselben Katalogaufgabe oder, für frei erstellte Aufgaben, derselben Beschreibung.
+// Einen Vergleich über alle Aufgaben einer Sprache gibt es bewusst nicht, weil kurze
+// Lösungen verschiedener Aufgaben nach dem Normalisieren leicht ähnlich aussehen.
+// Außerdem wird mit der Musterlösung verglichen, die beim Generieren der Aufgabe entstand.
+// Die Musterlösung aus der Bewertung taugt dafür nicht: Die KI schreibt sie nach dem Lesen
+// der Abgabe und gleicht sie ihr deshalb ohnehin an.
+func checkSimilarity(solutionID int64) error {
+	var solution struct {
+		TaskID    int    `db:"task_id"`
+		UserID    int    `db:"user_id"`
+		Language  string `db:"language"`
+		Code      string `db:"code"`
+		TaskType  string `db:"task_type"`
+		Starter   string `db:"starter_code"`
+		Reference string `db:"reference_solution"`
+	}
+	err := database.DB.Get(&solution, `
+		SELECT tasks.id AS task_id, tasks.user_id, COALESCE(tasks.language, '') AS language,
+			COALESCE(solutions.code, '') AS code, tasks.task_type, COALESCE(tasks.starter_code, '') AS starter_code,
+			COALESCE(tasks.reference_solution, '') AS reference_solution
+		FROM solutions
+			JOIN tasks ON tasks.id = solutions.task_id
+		WHERE solutions.id = ?`, solutionID)
+	if err != nil {
+		return err
+	}
+
+	// Anmerkungen und vorhergesagte Ausgaben sind kein Code. Vorgegebener Ausgangscode
+	// zählt nicht als Übereinstimmung.
+	if t, ok := taskTypes[solution.TaskType]; ok && !t.Code {
+		return nil
+	}
+	fp := fingerprintCode(solution.Code, solution.Language)
+	if solution.Starter != "" {
+		fp = fp.without(fingerprintCode(solution.Starter, solution.Language))
+	}
+
+	if solution.Reference != "" {
+		score := fp.similarity(fingerprintCode(solution.Reference, solution.Language))
+		if score >= referenceSimilarityThreshold {
+			if err := addSimilarityFlag(solutionID, nil, similarityReference, score); err != nil {
+				return err
+			}
+		}
+	}
+
+	var others []struct {
+		ID   int    `db:"id"`
+		Code string `db:"code"`
+	}
+	err = database.DB.Select(&others, `
+		SELECT solutions.id, COALESCE(solutions.code, '') AS code
+		FROM tasks own_task
+			JOIN tasks ON tasks.user_id != own_task.user_id
+				AND (tasks.assignment_id = own_task.assignment_id
+					OR tasks.catalog_task_id = own_task.catalog_task_id
+					OR tasks.description = own_task.description)
+			JOIN solutions ON solutions.task_id = tasks.id
+		WHERE own_task.id = ? AND LOWER(COALESCE(tasks.language, '')) = LOWER(?)
+			AND solutions.id = (SELECT MAX(id) FROM solutions latest WHERE latest.task_id = solutions.task_id)
+			AND tasks.user_id IN (
+				SELECT other.user_id
+				FROM course_members own
+					JOIN course_members other ON other.course_id = own.course_id
+				WHERE own.user_id = ? AND other.role = ?
+			)`, solution.TaskID, solution.Language, solution.UserID, roleStudent)
+	if err != nil {
+		return err
+	}
+
+	for _, other := range others {
+		score := fp.similarity(fingerprintCode(other.Code, solution.Language))
+		if score >= peerSimilarityThreshold {
+			if err := addSimilarityFlag(solutionID, &other.ID, similarityPeer, score); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Ein Treffer gehört zum Kurs, wenn die Lösung und bei Treffern unter Studierenden auch die
+// andere Lösung von Studierenden dieses Kurses stammt.
+const similarityFlagColumns = `
+	SELECT similarity_flags.id, similarity_flags.kind, similarity_flags.similarity, similarity_flags.created_at,
+		similarity_flags.solution_id, tasks.id AS task_id, tasks.user_id, users.username,
+		similarity_flags.other_solution_id, other_tasks.id AS other_task_id, other_tasks.user_id AS other_user_id,
+		other_users.username AS other_username
+	FROM similarity_flags
+		JOIN solutions ON solutions.id = similarity_flags.solution_id
+		JOIN tasks ON tasks.id = solutions.task_id
+		JOIN users ON users.id = tasks.user_id
+		LEFT JOIN solutions other_solutions ON other_solutions.id = similarity_flags.other_solution_id
+		LEFT JOIN tasks other_tasks ON other_tasks.id = other_solutions.task_id
+		LEFT JOIN users other_users ON other_users.id = other_tasks.user_id
+	WHERE tasks.user_id IN (SELECT user_id FROM course_members WHERE course_id = ? AND role = 'student')
+		AND (similarity_flags.kind = 'task_reference'
+			OR similarity_flags.kind = 'peer'
+			AND other_tasks.user_id IN (SELECT user_id FROM course_members WHERE course_id = ? AND role = 'student'))`
+
+func GetSimilarityReport(c *gin.Context) {
+	courseID, ok := courseTeacher(c)
+	if !ok {
+		return
+	}
+
+	flags := []models.SimilarityFlag{}
+	err := database.DB.Select(&flags, similarityFlagColumns+`
+		ORDER BY similarity_flags.similarity DESC, similarity_flags.id`, courseID, courseID)
+	if err != nil {
+		log.Printf("DB Error (similarity report): %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Fehler beim Abrufen des Ähnlichkeitsberichts"})
+		return
+	}
+
+	c.JSON(http.StatusOK, flags)
+}
+
+// GetSimilarityMatch zeigt beide Lösungen eines Treffers, bei Treffern gegen die
+// Musterlösung diese, mit den übereinstimmenden Zeilenbereichen nebeneinander.
+func GetSimilarityMatch(c *gin.Context) {
+	courseID, ok := courseTeacher(c)
+	if !ok {
+		return
+	}
+
+	var detail models.SimilarityDetail
+	err := database.DB.Get(&detail.Flag, similarityFlagColumns+`
+		AND similarity_flags.id = ?`, courseID, courseID, c.Param("flag_id"))
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Treffer nicht gefunden"})
+		return
+	}
+	if err != nil {
+		log.Printf("DB Error (similarity flag): %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Fehler beim Abrufen des Treffers"})
+		return
+	}
+
+	var solution struct {
+		Language  string `db:"language"`
+		Code      string `db:"code"`
+		OtherCode string `db:"other_code"`
+	}
+	err = database.DB.Get(&solution, `
+		SELECT COALESCE(tasks.language, '') AS language, COALESCE(solutions.code, '') AS code,
+			COALESCE(other_solutions.code, tasks.reference_solution, '') AS other_code
+		FROM solutions
+			JOIN tasks ON tasks.id = solutions.task_id
+			LEFT JOIN solutions other_solutions ON other_solutions.id = ?
+		WHERE solutions.id = ?`, detail.Flag.OtherSolutionID, detail.Flag.SolutionID)
+	if err != nil {
+		log.Printf("DB Error (similarity solution): %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Fehler beim Abrufen der Lösung"})
+		return
+	}
+
+	detail.Code = solution.Code
+	detail.OtherCode = solution.OtherCode
+
+	fp := fingerprintCode(detail.Code, solution.Language)
+	detail.Matches = fp.matches(fingerprintCode(detail.OtherCode, solution.Language))
+
+	c.JSON(http.StatusOK, detail)
+}
@@ -0,0 +1,125 @@
+package handlers
+
+import "testing"
+
+const binarySearchPython = `
+def binary_search(items, target):
+    low = 0
+    high = len(items) - 1
+    while low <= high:
+        mid = (low + high) // 2
+        if items[mid] == target:
+            return mid
+        elif items[mid] < target:
+            low = mid + 1
+        else:
+            high = mid - 1
+    return -1
+`
+
+func TestFingerprintSimilarity(t *testing.T) {
+	tests := []struct {
+		name     string
+		a, b     string
+		language string
+		min, max float64
+	}{
+		{
+			name: "umbenannt und kommentiert",
+			a:    binarySearchPython,
+			b: `
+# Suche im sortierten Array
+def suche(liste, wert):
+    links = 0
+    rechts = len(liste) - 1
+    while links <= rechts:
+        m = (links + rechts) // 2  # Mitte
+        if liste[m] == wert:
+            return m
+        elif liste[m] < wert:
+            links = m + 1
+        else:
+            rechts = m - 1
+    return -1
+`,
+			language: "python",
+			min:      1,
+			max:      1,
+		},
+		{
+			name: "andere Aufgabe",
+			a:    binarySearchPython,
+			b: `
+class Stack:
+    def __init__(self):
+        self.items = []
+
+    def push(self, item):
+        self.items.append(item)
+
+    def pop(self):
+        if not self.items:
+            raise IndexError("leer")
+        return self.items.pop()
+`,
+			language: "python",
+			min:      0,
+			max:      peerSimilarityThreshold - 0.01,
+		},
+		{
+			name: "andere Aufgabe in Java",
+			a: `
+public static int sum(int[] values) {
+    int total = 0;
+    for (int i = 0; i < values.length; i++) {
+        total += values[i];
+    }
+    return total;
+}
+`,
+			b: `
+public static String reverse(String text) {
+    StringBuilder builder = new StringBuilder(text);
+    /* Zeichen umdrehen */
+    return builder.reverse().toString();
+}
+`,
+			language: "java",
+			min:      0,
+			max:      peerSimilarityThreshold - 0.01,
+		},
+		{
+			name:     "zu kurz",
+			a:        "x = 1\n",
+			b:        "y = 1\n",
+			language: "python",
+			min:      0,
+			max:      0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := fingerprintCode(tt.a, tt.language)
+			b := fingerprintCode(tt.b, tt.language)
+
+			score := a.similarity(b)
+			if score < tt.min || score > tt.max {
+				t.Errorf("similarity = %.2f, erwartet %.2f bis %.2f", score, tt.min, tt.max)
+			}
+			if reverse := b.similarity(a); reverse != score {
+				t.Errorf("similarity ist nicht symmetrisch: %.2f und %.2f", score, reverse)
+			}
+		})
+	}
+}
+
+func TestFingerprintWithoutStarter(t *testing.T) {
+	fp := fingerprintCode(binarySearchPython, "python")
+	if rest := fp.without(fp); len(rest.hashes) != 0 {
+		t.Errorf("without(selbst) lässt %d Fingerabdrücke übrig", len(rest.hashes))
+	}
+	if rest := fp.without(codeFingerprint{}); len(rest.hashes) != len(fp.hashes) {
+		t.Errorf("without(leer) = %d Fingerabdrücke, erwartet %d", len(rest.hashes), len(fp.hashes))
+	}
+}
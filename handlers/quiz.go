@@ -0,0 +1,530 @@
+package handlers
+
+import (
+	"api-test/database"
+	"api-test/models"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math/rand/v2"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jmoiron/sqlx"
+)
+
+const (
+	quizKindChoice       = "choice"
+	quizKindShort        = "short"
+	defaultQuizQuestions = 5
+	maxQuizQuestions     = 10
+	minQuizOptions       = 3
+	maxQuizOptions       = 5
+	maxShortAnswerLength = 60
+)
+
+type generatedQuestion struct {
+	Kind     string `json:"kind"`
+	Question string `json:"question"`
+	Options  []struct {
+		Text    string `json:"text"`
+		Correct bool   `json:"correct"`
+	} `json:"options"`
+	Answers     []string `json:"answers"`
+	Explanation string   `json:"explanation"`
+}
+
+// normalizeAnswer macht Kurzantworten vergleichbar: ohne Groß- und Kleinschreibung,
+// Leerzeichen, Anführungszeichen und abschließenden Punkt. So gilt "O(n log n)" wie "o(nlogn)".
+func normalizeAnswer(answer string) string {
+	answer = strings.ToLower(strings.Join(strings.Fields(answer), ""))
+	answer = strings.Trim(answer, "\"'`")
+	return strings.TrimSuffix(answer, ".")
+}
+
+// validateQuestion prüft eine generierte Frage. Multiple-Choice-Fragen brauchen
+// unterschiedliche Antwortmöglichkeiten und genau eine richtige; die Reihenfolge wird
+// gemischt, da die KI die richtige Antwort gern an den Anfang stellt.
+func validateQuestion(q generatedQuestion) (models.QuizQuestion, error) {
+	question := models.QuizQuestion{
+		Kind:        q.Kind,
+		Question:    strings.TrimSpace(q.Question),
+		Explanation: strings.TrimSpace(q.Explanation),
+	}
+	if question.Question == "" || question.Explanation == "" {
+		return question, fmt.Errorf("Frage oder Erklärung fehlt")
+	}
+
+	switch q.Kind {
+	case quizKindChoice:
+		if len(q.Options) < minQuizOptions || len(q.Options) > maxQuizOptions {
+			return question, fmt.Errorf("%d Antwortmöglichkeiten", len(q.Options))
+		}
+
+		options := slices.Clone(q.Options)
+		rand.Shuffle(len(options), func(i, j int) { options[i], options[j] = options[j], options[i] })
+
+		seen := map[string]bool{}
+		for i, o := range options {
+			text := strings.TrimSpace(o.Text)
+			if text == "" || seen[normalizeAnswer(text)] {
+				return question, fmt.Errorf("leere oder doppelte Antwortmöglichkeit %q", text)
+			}
+			seen[normalizeAnswer(text)] = true
+			question.Options = append(question.Options, text)
+
+			if o.Correct {
+				if question.CorrectOption != nil {
+					return question, fmt.Errorf("mehr als eine richtige Antwort")
+				}
+				question.CorrectOption = &i
+			}
+		}
+		if question.CorrectOption == nil {
+			return question, fmt.Errorf("keine richtige Antwort")
+		}
+
+	case quizKindShort:
+		seen := map[string]bool{}
+		for _, a := range q.Answers {
+			a = strings.TrimSpace(a)
+			if a == "" || len(a) > maxShortAnswerLength || seen[normalizeAnswer(a)] {
+				continue
+			}
+			seen[normalizeAnswer(a)] = true
+			question.Answers = append(question.Answers, a)
+		}
+		if len(question.Answers) == 0 {
+			return question, fmt.Errorf("keine gültige Kurzantwort")
+		}
+
+	default:
+		return question, fmt.Errorf("unbekannte Fragenart %q", q.Kind)
+	}
+
+	return question, nil
+}
+
+func generateQuizCandidates(req models.QuizRequest, n int, avoid []string) ([]generatedQuestion, error) {
+	kindInstruction := "- Mische Multiple-Choice-Fragen und Kurzantwortfragen."
+	switch req.Kind {
+	case quizKindChoice:
+		kindInstruction = `- Stelle ausschließlich Multiple-Choice-Fragen ("kind": "choice").`
+	case quizKindShort:
+		kindInstruction = `- Stelle ausschließlich Kurzantwortfragen ("kind": "short").`
+	}
+
+	avoidInstruction := ""
+	if len(avoid) > 0 {
+		avoidInstruction = "- Wiederhole keine dieser bereits gestellten Fragen:\n"
+		for _, a := range avoid {
+			avoidInstruction += fmt.Sprintf("  * %q\n", truncate(a, 200))
+		}
+	}
+
+	prompt := fmt.Sprintf(`
+Goal:
+Erstelle %d kurze Verständnisfragen zu Konzepten der Programmierung, mit denen Studierende ihr Wissen prüfen können.
+
+Return Format:
+- Gib keine Code-Fences an.
+- Exaktes JSON-Format (zwingend im JSON-Format, keine illegalen Zeichen, keinerlei zusätzlichen Text!):
+{
+  "questions": [
+    {
+      "kind": "choice",
+      "question": "<Frage>",
+      "options": [{"text": "<Antwort>", "correct": true}, {"text": "<Antwort>", "correct": false}],
+      "explanation": "<Erklärung>"
+    },
+    {
+      "kind": "short",
+      "question": "<Frage>",
+      "answers": ["<richtige Antwort>", "<gleichwertige Schreibweise>"],
+      "explanation": "<Erklärung>"
+    }
+  ]
+}
+
+Instructions:
+- Frage Konzepte ab (z. B. Laufzeitkomplexität in O-Notation, Semantik der Sprache, Datentypen, Gültigkeitsbereiche, Speicherverhalten), keine Programmieraufgaben.
+- Multiple Choice: %d bis %d Antwortmöglichkeiten, genau eine davon richtig, keine Antworten wie "alle genannten" oder "keine davon".
+- Kurzantwort: Die Antwort ist eindeutig und besteht aus wenigen Wörtern, einem Ausdruck oder einer Zahl (höchstens %d Zeichen). Gib alle gleichwertigen Schreibweisen an.
+- Die Erklärung begründet in ein bis zwei Sätzen, warum die richtige Antwort stimmt.
+- Ist ein Thema angegeben, müssen alle Fragen dieses Thema behandeln.
+%s
+%s
+Context Dump:
+- Programmiersprache: "%s";
+- Schwierigkeitsgrad: "%s";
+- Thema: "%s"
+`, n, minQuizOptions, maxQuizOptions, maxShortAnswerLength, kindInstruction, avoidInstruction, req.Language, req.Level, req.Topic)
+
+	response, err := GetAIResponse(prompt)
+	if err != nil {
+		return nil, err
+	}
+
+	jsonString, err := CleanAndExtractJSON(response)
+	if err != nil {
+		log.Printf("Fehler beim Extrahieren von JSON: %v\nOriginal: %s\n", err, response)
+		return nil, fmt.Errorf("%w: %v", errAIResponseFormat, err)
+	}
+
+	var generated struct {
+		Questions []generatedQuestion `json:"questions"`
+	}
+	if err := json.Unmarshal([]byte(jsonString), &generated); err != nil {
+		log.Printf("json.Unmarshal-Fehler: %v\nBereinigtes JSON: %s\n", err, jsonString)
+		return nil, fmt.Errorf("%w: %v", errAIResponseFormat, err)
+	}
+	return generated.Questions, nil
+}
+
+// generateQuizQuestions verwirft ungültige Fragen und fordert fehlende nach, höchstens
+// maxGenerationAttempts Mal. Reicht das nicht, besteht das Quiz aus weniger Fragen.
+func generateQuizQuestions(req models.QuizRequest) ([]models.QuizQuestion, error) {
+	var questions []models.QuizQuestion
+	var asked []string
+
+	for attempt := 1; attempt <= maxGenerationAttempts && len(questions) < req.Questions; attempt++ {
+		candidates, err := generateQuizCandidates(req, req.Questions-len(questions), asked)
+		if err != nil {
+			if len(questions) > 0 {
+				break
+			}
+			return nil, err
+		}
+
+		for _, candidate := range candidates {
+			if len(questions) == req.Questions {
+				break
+			}
+			if req.Kind != "" && candidate.Kind != req.Kind {
+				continue
+			}
+			if slices.Contains(asked, strings.TrimSpace(candidate.Question)) {
+				continue
+			}
+
+			question, err := validateQuestion(candidate)
+			if err != nil {
+				log.Printf("generateQuizQuestions: Frage verworfen (%v): %q", err, candidate.Question)
+				continue
+			}
+			question.Position = len(questions) + 1
+			questions = append(questions, question)
+			asked = append(asked, question.Question)
+		}
+	}
+
+	if len(questions) == 0 {
+		return nil, fmt.Errorf("%w: keine gültige Frage", errAIResponseFormat)
+	}
+	return questions, nil
+}
+
+func loadQuiz(quizID int) (models.Quiz, error) {
+	var quiz models.Quiz
+	err := database.DB.Get(&quiz, `
+		SELECT id, user_id, language, level, topic, created_at, submitted_at, correct, score, mark
+		FROM quizzes WHERE id = ?`, quizID)
+	if err != nil {
+		return quiz, err
+	}
+
+	err = database.DB.Select(&quiz.Questions, `
+		SELECT id, position, kind, question, options, correct_option, answers, explanation, answer, is_correct
+		FROM quiz_questions WHERE quiz_id = ?
+		ORDER BY position`, quizID)
+	if err != nil {
+		return quiz, err
+	}
+
+	for i := range quiz.Questions {
+		q := &quiz.Questions[i]
+		if err := json.Unmarshal([]byte(q.OptionsJSON), &q.Options); err != nil {
+			return quiz, err
+		}
+		if err := json.Unmarshal([]byte(q.AnswersJSON), &q.Answers); err != nil {
+			return quiz, err
+		}
+	}
+	return quiz, nil
+}
+
+// hideQuizKey entfernt Lösungen und Erklärungen, solange das Quiz nicht abgegeben ist.
+func hideQuizKey(quiz *models.Quiz) {
+	if quiz.SubmittedAt != nil {
+		return
+	}
+	for i := range quiz.Questions {
+		quiz.Questions[i].CorrectOption = nil
+		quiz.Questions[i].Answers = nil
+		quiz.Questions[i].Explanation = ""
+	}
+}
+
+// gradeQuestion bewertet eine Antwort ohne KI: bei Multiple Choice über den Index, bei
+// Kurzantworten über den Vergleich mit den zulässigen Schreibweisen.
+func gradeQuestion(q models.QuizQuestion, answer models.QuizAnswer) (string, bool) {
+	if q.Kind == quizKindChoice {
+		if answer.Option == nil {
+			return "", false
+		}
+		return strconv.Itoa(*answer.Option), q.CorrectOption != nil && *answer.Option == *q.CorrectOption
+	}
+
+	text := strings.TrimSpace(answer.Text)
+	for _, accepted := range q.Answers {
+		if text != "" && normalizeAnswer(text) == normalizeAnswer(accepted) {
+			return text, true
+		}
+	}
+	return text, false
+}
+
+// applyQuizRating wertet ein Quiz wie eine Lösung gegen eine Aufgabe des Levels. Das
+// Ergebnis ist der Anteil richtiger Antworten.
+func applyQuizRating(tx *sqlx.Tx, quiz models.Quiz, score float64, now int64) error {
+	src := ratingSource{QuizID: &quiz.ID}
+	opponent := taskRating(quiz.Level)
+
+	if err := applyRating(tx, quiz.UserID, quiz.Language, "", src, opponent, score, now); err != nil {
+		return err
+	}
+	if quiz.Topic != "" {
+		return applyRating(tx, quiz.UserID, quiz.Language, quiz.Topic, src, opponent, score, now)
+	}
+	return nil
+}
+
+func GenerateQuiz(c *gin.Context) {
+	var req models.QuizRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	req.Language = strings.ToLower(strings.TrimSpace(req.Language))
+	req.Topic = strings.ToLower(strings.TrimSpace(req.Topic))
+	if req.Questions == 0 {
+		req.Questions = defaultQuizQuestions
+	}
+
+	switch {
+	case req.Language == "":
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Programmiersprache fehlt"})
+		return
+	case !slices.Contains(taskLevels, req.Level):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Ungültiges Level"})
+		return
+	case req.Kind != "" && req.Kind != quizKindChoice && req.Kind != quizKindShort:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Ungültige Fragenart"})
+		return
+	case req.Questions < 1 || req.Questions > maxQuizQuestions:
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Ein Quiz hat 1 bis %d Fragen", maxQuizQuestions)})
+		return
+	}
+
+	questions, err := generateQuizQuestions(req)
+	if err != nil {
+		log.Printf("GenerateQuiz: %v", err)
+		respondGenerationError(c, err)
+		return
+	}
+
+	userID, _ := currentUser(c)
+
+	tx, err := database.DB.Beginx()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Fehler beim Speichern des Quiz"})
+		return
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec("INSERT INTO quizzes (user_id, language, level, topic, created_at) VALUES (?, ?, ?, ?, ?)",
+		userID, req.Language, req.Level, req.Topic, time.Now().UnixMilli())
+	if err != nil {
+		log.Printf("DB Error (quiz insert): %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Fehler beim Speichern des Quiz"})
+		return
+	}
+	quizID, err := res.LastInsertId()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Fehler beim Speichern des Quiz"})
+		return
+	}
+
+	for _, q := range questions {
+		options, _ := json.Marshal(q.Options)
+		answers, _ := json.Marshal(q.Answers)
+		_, err := tx.Exec(`
+			INSERT INTO quiz_questions (quiz_id, position, kind, question, options, correct_option, answers, explanation)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		`, quizID, q.Position, q.Kind, q.Question, string(options), q.CorrectOption, string(answers), q.Explanation)
+		if err != nil {
+			log.Printf("DB Error (quiz question insert): %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Fehler beim Speichern des Quiz"})
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Fehler beim Speichern des Quiz"})
+		return
+	}
+
+	quiz, err := loadQuiz(int(quizID))
+	if err != nil {
+		log.Printf("DB Error (quiz fetch): %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Fehler beim Abrufen des Quiz"})
+		return
+	}
+	hideQuizKey(&quiz)
+
+	c.JSON(http.StatusOK, quiz)
+}
+
+func GetQuiz(c *gin.Context) {
+	quizID, err := strconv.Atoi(c.Param("quiz_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Ungültige Quiz-ID"})
+		return
+	}
+
+	quiz, err := loadQuiz(quizID)
+	if err != nil {
+		log.Printf("DB Error (quiz fetch): %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Fehler beim Abrufen des Quiz"})
+		return
+	}
+	hideQuizKey(&quiz)
+
+	c.JSON(http.StatusOK, quiz)
+}
+
+func SubmitQuiz(c *gin.Context) {
+	quizID, err := strconv.Atoi(c.Param("quiz_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Ungültige Quiz-ID"})
+		return
+	}
+
+	var req models.QuizSubmitRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	quiz, err := loadQuiz(quizID)
+	if err != nil {
+		log.Printf("DB Error (quiz fetch): %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Fehler beim Abrufen des Quiz"})
+		return
+	}
+
+	userID, _ := currentUser(c)
+	if quiz.UserID != userID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Nur der Besitzer kann das Quiz abgeben"})
+		return
+	}
+	if quiz.SubmittedAt != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "Quiz wurde bereits abgegeben"})
+		return
+	}
+
+	answers := map[int]models.QuizAnswer{}
+	for _, a := range req.Answers {
+		answers[a.QuestionID] = a
+	}
+
+	now := time.Now().UnixMilli()
+
+	tx, err := database.DB.Beginx()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Fehler beim Speichern der Antworten"})
+		return
+	}
+	defer tx.Rollback()
+
+	correct := 0
+	for _, q := range quiz.Questions {
+		answer, isCorrect := gradeQuestion(q, answers[q.ID])
+		if isCorrect {
+			correct++
+		}
+		_, err := tx.Exec("UPDATE quiz_questions SET answer = NULLIF(?, ''), is_correct = ? WHERE id = ?", answer, isCorrect, q.ID)
+		if err != nil {
+			log.Printf("DB Error (quiz answer): %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Fehler beim Speichern der Antworten"})
+			return
+		}
+	}
+
+	score := 0.0
+	if len(quiz.Questions) > 0 {
+		score = float64(correct) / float64(len(quiz.Questions))
+	}
+
+	res, err := tx.Exec(`
+		UPDATE quizzes SET submitted_at = ?, correct = ?, score = ?, mark = ?
+		WHERE id = ? AND submitted_at IS NULL
+	`, now, correct, score, fractionMark(score), quizID)
+	if err != nil {
+		log.Printf("DB Error (quiz submit): %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Fehler beim Speichern der Antworten"})
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Quiz wurde bereits abgegeben"})
+		return
+	}
+
+	if err := applyQuizRating(tx, quiz, score, now); err != nil {
+		log.Printf("DB Error (quiz rating): %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Fehler beim Aktualisieren der Wertung"})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Fehler beim Speichern der Antworten"})
+		return
+	}
+
+	quiz, err = loadQuiz(quizID)
+	if err != nil {
+		log.Printf("DB Error (quiz fetch): %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Fehler beim Abrufen des Quiz"})
+		return
+	}
+
+	c.JSON(http.StatusOK, quiz)
+}
+
+func GetUserQuizzes(c *gin.Context) {
+	query := `
+		SELECT id, user_id, language, level, topic, created_at, submitted_at, correct, score, mark
+		FROM quizzes
+		WHERE user_id = ?`
+	args := []any{c.Query("user_id")}
+
+	if language := c.Query("language"); language != "" {
+		query += " AND language = ?"
+		args = append(args, strings.ToLower(language))
+	}
+	query += " ORDER BY id DESC"
+
+	quizzes := []models.Quiz{}
+	if err := database.DB.Select(&quizzes, query, args...); err != nil {
+		log.Printf("DB Error (quizzes): %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Fehler beim Abrufen der Quizze"})
+		return
+	}
+
+	c.JSON(http.StatusOK, quizzes)
+}
@@ -0,0 +1,183 @@
+package handlers
+
+import (
+	"api-test/database"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ulule/limiter/v3"
+	"github.com/ulule/limiter/v3/drivers/store/common"
+	"github.com/ulule/limiter/v3/drivers/store/memory"
+)
+
+// Standardlimits je Routengruppe. Überschreibbar per RATE_LIMIT_<GRUPPE>, z. B. RATE_LIMIT_CHAT=100-H.
+var rateLimitPolicies = map[string]string{
+	"default":  "300-M",
+	"auth":     "60-M",
+	"generate": "30-H",
+	"evaluate": "60-H",
+	"chat":     "120-H",
+	"stats":    "120-M",
+}
+
+var (
+	rateLimitStore     limiter.Store
+	rateLimitStoreOnce sync.Once
+)
+
+// getRateLimitStore wählt das Backend über RATE_LIMIT_STORE: "sqlite" (Standard) hält die
+// Zähler in der Datenbank, sodass sie Neustarts überstehen und von mehreren Instanzen auf
+// derselben Datenbank geteilt werden; "memory" zählt nur im Prozess.
+func getRateLimitStore() limiter.Store {
+	rateLimitStoreOnce.Do(func() {
+		switch backend := os.Getenv("RATE_LIMIT_STORE"); backend {
+		case "", "sqlite":
+			rateLimitStore = sqliteStore{}
+		case "memory":
+			rateLimitStore = memory.NewStore()
+		default:
+			log.Printf("Unbekannter RATE_LIMIT_STORE %q, verwende sqlite", backend)
+			rateLimitStore = sqliteStore{}
+		}
+	})
+	return rateLimitStore
+}
+
+// sqliteStore implementiert limiter.Store auf der Tabelle rate_limits. Ein Zähler gilt
+// bis expires_at und beginnt danach von vorn.
+type sqliteStore struct{}
+
+func (sqliteStore) Get(ctx context.Context, key string, rate limiter.Rate) (limiter.Context, error) {
+	return sqliteStore{}.Increment(ctx, key, 1, rate)
+}
+
+func (sqliteStore) Increment(ctx context.Context, key string, count int64, rate limiter.Rate) (limiter.Context, error) {
+	now := time.Now()
+	var state struct {
+		Count     int64 `db:"count"`
+		ExpiresAt int64 `db:"expires_at"`
+	}
+	err := database.DB.GetContext(ctx, &state, `
+		INSERT INTO rate_limits (key, count, expires_at)
+		VALUES (?, ?, ?)
+		ON CONFLICT (key) DO UPDATE SET
+			count = CASE WHEN rate_limits.expires_at <= ? THEN excluded.count ELSE rate_limits.count + excluded.count END,
+			expires_at = CASE WHEN rate_limits.expires_at <= ? THEN excluded.expires_at ELSE rate_limits.expires_at END
+		RETURNING count, expires_at
+	`, key, count, now.Add(rate.Period).UnixMilli(), now.UnixMilli(), now.UnixMilli())
+	if err != nil {
+		return limiter.Context{}, err
+	}
+
+	return common.GetContextFromState(now, rate, time.UnixMilli(state.ExpiresAt), state.Count), nil
+}
+
+func (sqliteStore) Peek(ctx context.Context, key string, rate limiter.Rate) (limiter.Context, error) {
+	now := time.Now()
+	var state struct {
+		Count     int64 `db:"count"`
+		ExpiresAt int64 `db:"expires_at"`
+	}
+	err := database.DB.GetContext(ctx, &state, `
+		SELECT count, expires_at FROM rate_limits WHERE key = ? AND expires_at > ?
+	`, key, now.UnixMilli())
+	if errors.Is(err, sql.ErrNoRows) {
+		return common.GetContextFromState(now, rate, now.Add(rate.Period), 0), nil
+	}
+	if err != nil {
+		return limiter.Context{}, err
+	}
+
+	return common.GetContextFromState(now, rate, time.UnixMilli(state.ExpiresAt), state.Count), nil
+}
+
+func (sqliteStore) Reset(ctx context.Context, key string, rate limiter.Rate) (limiter.Context, error) {
+	now := time.Now()
+	if _, err := database.DB.ExecContext(ctx, "DELETE FROM rate_limits WHERE key = ?", key); err != nil {
+		return limiter.Context{}, err
+	}
+
+	return common.GetContextFromState(now, rate, now.Add(rate.Period), 0), nil
+}
+
+// RunRateLimitSweeper löscht abgelaufene Zähler aus rate_limits.
+func RunRateLimitSweeper(interval time.Duration) {
+	if _, ok := getRateLimitStore().(sqliteStore); !ok {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if _, err := database.DB.Exec("DELETE FROM rate_limits WHERE expires_at <= ?", time.Now().UnixMilli()); err != nil {
+			log.Printf("RunRateLimitSweeper: delete failed: %v", err)
+		}
+	}
+}
+
+// rateLimitKey zählt angemeldete User einzeln und fällt sonst auf die IP zurück, damit
+// eine Klasse hinter einem gemeinsamen NAT sich nicht gegenseitig ausbremst.
+func rateLimitKey(c *gin.Context) string {
+	if userID, _, err := authenticate(c); err == nil {
+		return fmt.Sprintf("user:%d", userID)
+	}
+	return "ip:" + c.ClientIP()
+}
+
+// RateLimit begrenzt die Anfragen je User (bzw. IP) nach der Policy der Routengruppe und
+// setzt die Header X-RateLimit-* sowie RateLimit-* nach dem IETF-Entwurf.
+func RateLimit(policy string) gin.HandlerFunc {
+	formatted := rateLimitPolicies[policy]
+	if override := os.Getenv("RATE_LIMIT_" + strings.ToUpper(policy)); override != "" {
+		formatted = override
+	}
+
+	rate, err := limiter.NewRateFromFormatted(formatted)
+	if err != nil {
+		log.Fatalf("Ungültiges Rate-Limit %q für %s: %v", formatted, policy, err)
+	}
+	lim := limiter.New(getRateLimitStore(), rate)
+
+	return func(c *gin.Context) {
+		if c.Request.Method == http.MethodOptions {
+			c.Next()
+			return
+		}
+
+		ctx, err := lim.Get(c, policy+":"+rateLimitKey(c))
+		if err != nil {
+			// Fällt der Store aus, soll das nicht die ganze API lahmlegen.
+			log.Printf("RateLimit(%s): %v", policy, err)
+			c.Next()
+			return
+		}
+
+		resetIn := max(ctx.Reset-time.Now().Unix(), 0)
+		c.Header("X-RateLimit-Limit", strconv.FormatInt(ctx.Limit, 10))
+		c.Header("X-RateLimit-Remaining", strconv.FormatInt(ctx.Remaining, 10))
+		c.Header("X-RateLimit-Reset", strconv.FormatInt(ctx.Reset, 10))
+		c.Header("RateLimit-Limit", strconv.FormatInt(ctx.Limit, 10))
+		c.Header("RateLimit-Remaining", strconv.FormatInt(ctx.Remaining, 10))
+		c.Header("RateLimit-Reset", strconv.FormatInt(resetIn, 10))
+		c.Header("RateLimit-Policy", fmt.Sprintf("%d;w=%d", rate.Limit, int64(rate.Period.Seconds())))
+
+		if ctx.Reached {
+			c.Header("Retry-After", strconv.FormatInt(resetIn, 10))
+			c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"error": "Zu viele Anfragen, bitte später erneut versuchen"})
+			return
+		}
+
+		c.Next()
+	}
+}
@@ -0,0 +1,302 @@
+package handlers
+
+import (
+	"api-test/database"
+	"api-test/models"
+	"database/sql"
+	"errors"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jmoiron/sqlx"
+)
+
+// Glicko-Parameter: Startwertung, maximale Unsicherheit und deren Zunahme pro Tag ohne Lösung.
+const (
+	initialRating  = 1400.0
+	initialRD      = 350.0
+	minRD          = 50.0
+	rdGrowthPerDay = 30.0
+	taskRD         = 50.0
+	hintPenalty    = 0.02
+	maxHintPenalty = 0.1
+)
+
+var glickoQ = math.Ln10 / 400
+
+// taskRating ordnet jedem Level eine feste Gegnerwertung zu.
+func taskRating(level string) float64 {
+	return 1000 + 200*float64(levelIndex(level))
+}
+
+func glickoG(rd float64) float64 {
+	return 1 / math.Sqrt(1+3*glickoQ*glickoQ*rd*rd/(math.Pi*math.Pi))
+}
+
+func glickoExpected(rating, opponent, opponentRD float64) float64 {
+	return 1 / (1 + math.Pow(10, -glickoG(opponentRD)*(rating-opponent)/400))
+}
+
+// inflateRD erhöht die Unsicherheit einer Wertung mit der Zeit seit der letzten Aktualisierung.
+func inflateRD(rd float64, since, now int64) float64 {
+	days := float64(now-since) / float64(24*time.Hour/time.Millisecond)
+	if days <= 0 {
+		return rd
+	}
+	return math.Min(math.Sqrt(rd*rd+rdGrowthPerDay*rdGrowthPerDay*days), initialRD)
+}
+
+// glickoDenominator ist der Kehrwert der neuen Varianz nach einem Ergebnis mit dem
+// erwarteten Wert expected. Er hängt nicht vom tatsächlichen Ergebnis ab.
+func glickoDenominator(rd, expected float64) float64 {
+	g := glickoG(taskRD)
+	dSquared := 1 / (glickoQ * glickoQ * g * g * expected * (1 - expected))
+	return 1/(rd*rd) + 1/dSquared
+}
+
+// glickoUpdate wendet ein einzelnes Ergebnis (0 bis 1) gegen eine Aufgabe an.
+func glickoUpdate(rating, rd, opponent, outcome float64) (float64, float64, float64) {
+	expected := glickoExpected(rating, opponent, taskRD)
+	denominator := glickoDenominator(rd, expected)
+
+	newRating := rating + glickoQ/denominator*glickoG(taskRD)*(outcome-expected)
+	newRD := math.Max(math.Sqrt(1/denominator), minRD)
+
+	return newRating, newRD, expected
+}
+
+func withBounds(r *models.SkillRating) {
+	r.Lower = math.Round(r.Rating - 2*r.RD)
+	r.Upper = math.Round(r.Rating + 2*r.RD)
+}
+
+// ratingOutcome ergänzt die Leistung einer Lösung um einen Abzug je gestellter Chatfrage.
+func ratingOutcome(o solutionOutcome, hints int) float64 {
+	return math.Max(0, o.performance()*(1-math.Min(float64(hints)*hintPenalty, maxHintPenalty)))
+}
+
+// ratingSource ist das Ergebnis, aus dem eine Wertungsänderung stammt: eine Lösung oder
+// ein Quiz. Bei Quizzen bleiben Aufgabe und Lösung NULL.
+type ratingSource struct {
+	TaskID     *int
+	SolutionID *int64
+	QuizID     *int
+}
+
+func applyRating(tx *sqlx.Tx, userID int, language, topic string, src ratingSource, opponent, outcome float64, now int64) error {
+	current := models.SkillRating{Rating: initialRating, RD: initialRD, UpdatedAt: now}
+	err := tx.Get(&current, `
+		SELECT language, topic, rating, rd, solutions, updated_at
+		FROM skill_ratings
+		WHERE user_id = ? AND language = ? AND topic = ?`, userID, language, topic)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+
+	rdBefore := inflateRD(current.RD, current.UpdatedAt, now)
+	rating, rd, expected := glickoUpdate(current.Rating, rdBefore, opponent, outcome)
+
+	_, err = tx.Exec(`
+		INSERT INTO skill_ratings (user_id, language, topic, rating, rd, solutions, updated_at)
+		VALUES (?, ?, ?, ?, ?, 1, ?)
+		ON CONFLICT (user_id, language, topic) DO UPDATE SET
+			rating = excluded.rating,
+			rd = excluded.rd,
+			solutions = skill_ratings.solutions + 1,
+			updated_at = excluded.updated_at
+	`, userID, language, topic, rating, rd, now)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO skill_rating_history (user_id, language, topic, task_id, solution_id, quiz_id, task_rating,
+			outcome, expected, rating_before, rd_before, rating, rd, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, userID, language, topic, src.TaskID, src.SolutionID, src.QuizID, opponent, outcome, expected, current.Rating, rdBefore, rating, rd, now)
+	return err
+}
+
+// updateSkillRatings aktualisiert nach einer bewerteten Lösung die Wertung des Users
+// für die Sprache der Aufgabe und für jedes ihrer Themen.
+func updateSkillRatings(tx *sqlx.Tx, solutionID int64) error {
+	o, userID, hints, err := loadSolutionOutcome(tx, solutionID)
+	if err != nil {
+		return err
+	}
+
+	outcome := ratingOutcome(o, hints)
+	opponent := taskRating(o.Level)
+	now := time.Now().UnixMilli()
+
+	src := ratingSource{TaskID: &o.TaskID, SolutionID: &solutionID}
+	if err := applyRating(tx, userID, o.Language, "", src, opponent, outcome, now); err != nil {
+		return err
+	}
+	for _, topic := range o.Topics {
+		if err := applyRating(tx, userID, o.Language, topic, src, opponent, outcome, now); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// correctSkillRatings passt die Wertungen an, nachdem sich die Note einer Lösung geändert
+// hat. Die Wertung verschiebt sich um den Unterschied, den das neue Ergebnis beim
+// ursprünglichen Update ausgemacht hätte; die Unsicherheit hängt nicht vom Ergebnis ab und
+// bleibt. Jede Korrektur erscheint als eigener Eintrag im Verlauf.
+func correctSkillRatings(tx *sqlx.Tx, solutionID int64) error {
+	o, userID, hints, err := loadSolutionOutcome(tx, solutionID)
+	if err != nil {
+		return err
+	}
+	outcome := ratingOutcome(o, hints)
+
+	var entries []struct {
+		Language   string  `db:"language"`
+		Topic      string  `db:"topic"`
+		TaskRating float64 `db:"task_rating"`
+		Outcome    float64 `db:"outcome"`
+		Expected   float64 `db:"expected"`
+		RDBefore   float64 `db:"rd_before"`
+	}
+	err = tx.Select(&entries, `
+		SELECT h.language, h.topic, h.task_rating, h.outcome, h.expected, h.rd_before
+		FROM skill_rating_history h
+		WHERE h.user_id = ? AND h.solution_id = ? AND h.id = (
+			SELECT MAX(id) FROM skill_rating_history
+			WHERE solution_id = h.solution_id AND language = h.language AND topic = h.topic)`,
+		userID, solutionID)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().UnixMilli()
+	src := ratingSource{TaskID: &o.TaskID, SolutionID: &solutionID}
+
+	for _, e := range entries {
+		if e.Outcome == outcome {
+			continue
+		}
+		shift := glickoQ / glickoDenominator(e.RDBefore, e.Expected) * glickoG(taskRD) * (outcome - e.Outcome)
+
+		var current models.SkillRating
+		err := tx.Get(&current, `
+			SELECT language, topic, rating, rd, solutions, updated_at
+			FROM skill_ratings
+			WHERE user_id = ? AND language = ? AND topic = ?`, userID, e.Language, e.Topic)
+		if errors.Is(err, sql.ErrNoRows) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec("UPDATE skill_ratings SET rating = ? WHERE user_id = ? AND language = ? AND topic = ?",
+			current.Rating+shift, userID, e.Language, e.Topic)
+		if err != nil {
+			return err
+		}
+
+		// rd_before und expected stammen aus dem ursprünglichen Update, damit eine weitere
+		// Korrektur derselben Lösung wieder dieselbe Verschiebung pro Ergebnispunkt ergibt.
+		_, err = tx.Exec(`
+			INSERT INTO skill_rating_history (user_id, language, topic, task_id, solution_id, quiz_id, task_rating,
+				outcome, expected, rating_before, rd_before, rating, rd, created_at)
+			VALUES (?, ?, ?, ?, ?, NULL, ?, ?, ?, ?, ?, ?, ?, ?)
+		`, userID, e.Language, e.Topic, src.TaskID, src.SolutionID, e.TaskRating, outcome, e.Expected,
+			current.Rating, e.RDBefore, current.Rating+shift, current.RD, now)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func loadSkillRating(userID int, language, topic string) (*models.SkillRating, error) {
+	var rating models.SkillRating
+	err := database.DB.Get(&rating, `
+		SELECT language, topic, rating, rd, solutions, updated_at
+		FROM skill_ratings
+		WHERE user_id = ? AND language = ? AND topic = ?`, userID, language, topic)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	rating.RD = inflateRD(rating.RD, rating.UpdatedAt, time.Now().UnixMilli())
+	withBounds(&rating)
+	return &rating, nil
+}
+
+func GetUserRatings(c *gin.Context) {
+	userID := c.Query("user_id")
+
+	ratings := []models.SkillRating{}
+	err := database.DB.Select(&ratings, `
+		SELECT language, topic, rating, rd, solutions, updated_at
+		FROM skill_ratings
+		WHERE user_id = ?
+		ORDER BY language, topic`, userID)
+	if err != nil {
+		log.Printf("DB Error (ratings): %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Fehler beim Abrufen der Wertungen"})
+		return
+	}
+
+	now := time.Now().UnixMilli()
+	for i := range ratings {
+		ratings[i].RD = inflateRD(ratings[i].RD, ratings[i].UpdatedAt, now)
+		withBounds(&ratings[i])
+	}
+
+	c.JSON(http.StatusOK, ratings)
+}
+
+func GetUserRatingHistory(c *gin.Context) {
+	userID, err := strconv.Atoi(c.Query("user_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Ungültige User-ID"})
+		return
+	}
+
+	history := models.SkillRatingHistory{
+		Language: strings.ToLower(c.Query("language")),
+		Topic:    strings.ToLower(c.Query("topic")),
+		Entries:  []models.SkillRatingHistoryEntry{},
+	}
+
+	err = database.DB.Select(&history.Entries, `
+		SELECT id, task_id, solution_id, quiz_id, task_rating, outcome, expected,
+			rating_before, rd_before, rating, rd, created_at
+		FROM skill_rating_history
+		WHERE user_id = ? AND language = ? AND topic = ?
+		ORDER BY id`, userID, history.Language, history.Topic)
+	if err != nil {
+		log.Printf("DB Error (rating history): %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Fehler beim Abrufen des Wertungsverlaufs"})
+		return
+	}
+
+	for i := range history.Entries {
+		e := &history.Entries[i]
+		e.Lower = math.Round(e.Rating - 2*e.RD)
+		e.Upper = math.Round(e.Rating + 2*e.RD)
+	}
+
+	history.Current, err = loadSkillRating(userID, history.Language, history.Topic)
+	if err != nil {
+		log.Printf("DB Error (rating): %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Fehler beim Abrufen der Wertung"})
+		return
+	}
+
+	c.JSON(http.StatusOK, history)
+}
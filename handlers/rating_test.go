@@ -0,0 +1,68 @@
+package handlers
+
+import "testing"
+
+func TestGlickoUpdate(t *testing.T) {
+	tests := []struct {
+		name     string
+		rating   float64
+		rd       float64
+		opponent float64
+		outcome  float64
+		dir      int
+	}{
+		{"Sieg gegen gleich starke Aufgabe", 1400, 200, 1400, 1, 1},
+		{"Niederlage gegen gleich starke Aufgabe", 1400, 200, 1400, 0, -1},
+		{"Sieg gegen leichte Aufgabe", 1600, 100, 1000, 1, 1},
+		{"Niederlage gegen schwere Aufgabe", 1000, 100, 1800, 0, -1},
+		{"halbe Leistung gegen schwere Aufgabe", 1000, 350, 1800, 0.5, 1},
+		{"halbe Leistung gegen leichte Aufgabe", 1800, 350, 1000, 0.5, -1},
+		{"sichere Wertung bleibt bei minRD", 1400, minRD, 1400, 1, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rating, rd, expected := glickoUpdate(tt.rating, tt.rd, tt.opponent, tt.outcome)
+
+			if tt.dir > 0 && rating <= tt.rating || tt.dir < 0 && rating >= tt.rating {
+				t.Errorf("Wertung %.1f -> %.1f, erwartete Richtung %d", tt.rating, rating, tt.dir)
+			}
+			if rd < minRD {
+				t.Errorf("RD %.1f unter minRD %.1f", rd, minRD)
+			}
+			if rd > tt.rd {
+				t.Errorf("RD %.1f -> %.1f gestiegen", tt.rd, rd)
+			}
+			if expected <= 0 || expected >= 1 {
+				t.Errorf("Erwartungswert %.3f außerhalb von (0, 1)", expected)
+			}
+		})
+	}
+}
+
+func TestGlickoUpdateRepeatedKeepsMinRD(t *testing.T) {
+	rating, rd := initialRating, initialRD
+	for i := 0; i < 200; i++ {
+		rating, rd, _ = glickoUpdate(rating, rd, taskRating("medium"), float64(i%2))
+		if rd < minRD {
+			t.Fatalf("RD nach %d Ergebnissen %.2f unter minRD", i+1, rd)
+		}
+	}
+	if rd != minRD {
+		t.Errorf("RD nach vielen Ergebnissen = %.2f, erwartet minRD", rd)
+	}
+}
+
+// Die Korrektur nach einer Notenänderung muss dieselbe Wertung ergeben, als wäre das neue
+// Ergebnis von Anfang an verwendet worden.
+func TestGlickoCorrectionMatchesUpdate(t *testing.T) {
+	rating, rd, opponent := 1500.0, 120.0, taskRating("hard")
+
+	before, _, expected := glickoUpdate(rating, rd, opponent, 0.3)
+	after, _, _ := glickoUpdate(rating, rd, opponent, 0.8)
+
+	shift := glickoQ / glickoDenominator(rd, expected) * glickoG(taskRD) * (0.8 - 0.3)
+	if diff := before + shift - after; diff > 1e-9 || diff < -1e-9 {
+		t.Errorf("Korrektur ergibt %.4f, erwartet %.4f", before+shift, after)
+	}
+}
@@ -0,0 +1,382 @@
+package handlers
+
+import (
+	"api-test/database"
+	"api-test/models"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jmoiron/sqlx"
+)
+
+const (
+	skillSmoothing    = 0.4
+	weakTopicCutoff   = 0.5
+	defaultLevelIndex = 1
+)
+
+var taskLevels = []string{"super-easy", "easy", "medium", "hard", "super-hard"}
+
+func levelIndex(level string) int {
+	for i, l := range taskLevels {
+		if strings.EqualFold(l, level) {
+			return i
+		}
+	}
+	return 2
+}
+
+func levelName(score float64) string {
+	i := int(math.Round(score))
+	if i < 0 {
+		i = 0
+	}
+	if i >= len(taskLevels) {
+		i = len(taskLevels) - 1
+	}
+	return taskLevels[i]
+}
+
+type solutionOutcome struct {
+	TaskID        int     `db:"task_id"`
+	Language      string  `db:"language"`
+	Level         string  `db:"level"`
+	Topic         string  `db:"topic"`
+	Mark          float64 `db:"mark"`
+	AIUsage       bool    `db:"ai_usage"`
+	TimeSpent     int     `db:"time_spent"`
+	TimeEstimated int     `db:"time_estimated"`
+	CatalogTaskID int     `db:"catalog_task_id"`
+	Topics        []string
+}
+
+// performance bildet eine Lösung auf [0, 1] ab: Note 1,0 entspricht 1, Note 6,0 entspricht 0.
+// KI-Nutzung und deutliche Zeitüberschreitung mindern den Wert.
+func (o solutionOutcome) performance() float64 {
+	p := (6 - o.Mark) / 5
+	if o.AIUsage {
+		p *= 0.85
+	}
+	if o.TimeEstimated > 0 && o.TimeSpent > 0 && float64(o.TimeSpent)/float64(o.TimeEstimated*60) > 1.5 {
+		p *= 0.9
+	}
+	return math.Max(0, math.Min(1, p))
+}
+
+// demonstratedLevel verschiebt das Level der Aufgabe je nach Leistung um bis zu eine Stufe.
+// Note 3,0 ohne Abzüge bestätigt das Level genau.
+func (o solutionOutcome) demonstratedLevel() float64 {
+	return float64(levelIndex(o.Level)) + (o.performance()-0.6)*2.5
+}
+
+type skillAccumulator struct {
+	score       float64
+	performance float64
+	solutions   int
+}
+
+func (s *skillAccumulator) add(o solutionOutcome) {
+	if s.solutions == 0 {
+		s.score = o.demonstratedLevel()
+		s.performance = o.performance()
+	} else {
+		s.score += skillSmoothing * (o.demonstratedLevel() - s.score)
+		s.performance += skillSmoothing * (o.performance() - s.performance)
+	}
+	s.solutions++
+}
+
+func (s *skillAccumulator) estimate(language, topic string) models.SkillEstimate {
+	return models.SkillEstimate{
+		Language:    language,
+		Topic:       topic,
+		Level:       levelName(s.score),
+		Score:       math.Round(s.score*100) / 100,
+		Performance: math.Round(s.performance*100) / 100,
+		Solutions:   s.solutions,
+	}
+}
+
+// outcomeMark ist die Note einer Lösung ohne Verspätungsabzug. Nach einer Änderung durch
+// Lehrkraft oder Regrade (graded_at gesetzt) gilt die geänderte Note, denn raw_mark hält
+// nur die ursprüngliche Bewertung der KI fest.
+const outcomeMark = `CASE WHEN solutions.graded_at IS NULL THEN COALESCE(solutions.raw_mark, solutions.mark)
+	ELSE MAX(1, solutions.mark - COALESCE(solutions.late_penalty, 0)) END`
+
+func loadSolutionOutcomes(userID int) ([]solutionOutcome, error) {
+	var outcomes []solutionOutcome
+	err := database.DB.Select(&outcomes, `
+		SELECT tasks.id AS task_id, COALESCE(tasks.language, '') AS language,
+			COALESCE(tasks.level, '') AS level, COALESCE(tasks.topic, '') AS topic,
+			`+outcomeMark+` AS mark, COALESCE(solutions.ai_usage, 0) AS ai_usage,
+			COALESCE(solutions.time_spent, 0) AS time_spent,
+			COALESCE(tasks.time_estimated, 0) AS time_estimated,
+			COALESCE(tasks.catalog_task_id, 0) AS catalog_task_id
+		FROM tasks
+			JOIN solutions ON solutions.task_id = tasks.id
+		WHERE tasks.user_id = ? AND solutions.mark IS NOT NULL
+		ORDER BY solutions.id`, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := database.DB.Query(`
+		SELECT tasks.id, topics.name
+		FROM tasks
+			JOIN catalog_task_topics ctt ON ctt.catalog_task_id = tasks.catalog_task_id
+			JOIN topics ON topics.id = ctt.topic_id
+		WHERE tasks.user_id = ?`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	catalogTopics := make(map[int][]string)
+	for rows.Next() {
+		var taskID int
+		var name string
+		if err := rows.Scan(&taskID, &name); err != nil {
+			return nil, err
+		}
+		catalogTopics[taskID] = append(catalogTopics[taskID], name)
+	}
+
+	for i := range outcomes {
+		outcomes[i].Topics = catalogTopics[outcomes[i].TaskID]
+		if outcomes[i].Topic != "" {
+			outcomes[i].Topics = append(outcomes[i].Topics, outcomes[i].Topic)
+		}
+	}
+
+	return outcomes, rows.Err()
+}
+
+// loadSolutionOutcome lädt eine einzelne bewertete Lösung samt Themen der Aufgabe,
+// dem User und der Anzahl der dazu gestellten Chatfragen.
+func loadSolutionOutcome(tx *sqlx.Tx, solutionID int64) (solutionOutcome, int, int, error) {
+	var o solutionOutcome
+	var userID int
+	err := tx.QueryRow(`
+		SELECT tasks.id, tasks.user_id, COALESCE(tasks.language, ''), COALESCE(tasks.level, ''),
+			COALESCE(tasks.topic, ''), `+outcomeMark+`, COALESCE(solutions.ai_usage, 0),
+			COALESCE(solutions.time_spent, 0), COALESCE(tasks.time_estimated, 0),
+			COALESCE(tasks.catalog_task_id, 0)
+		FROM solutions
+			JOIN tasks ON tasks.id = solutions.task_id
+		WHERE solutions.id = ?`, solutionID).Scan(
+		&o.TaskID, &userID, &o.Language, &o.Level, &o.Topic, &o.Mark, &o.AIUsage, &o.TimeSpent, &o.TimeEstimated,
+		&o.CatalogTaskID,
+	)
+	if err != nil {
+		return o, 0, 0, err
+	}
+
+	err = tx.Select(&o.Topics, `
+		SELECT topics.name
+		FROM tasks
+			JOIN catalog_task_topics ctt ON ctt.catalog_task_id = tasks.catalog_task_id
+			JOIN topics ON topics.id = ctt.topic_id
+		WHERE tasks.id = ?`, o.TaskID)
+	if err != nil {
+		return o, 0, 0, err
+	}
+	if o.Topic != "" {
+		o.Topics = append(o.Topics, o.Topic)
+	}
+	o.Topics = normalizeTopics(o.Topics)
+
+	var hints int
+	err = tx.Get(&hints, "SELECT COUNT(*) FROM interactions WHERE task_id = ? AND role = 'user'", o.TaskID)
+	return o, userID, hints, err
+}
+
+// estimateSkills schätzt aus den bisherigen Lösungen eines Users das Können
+// je Sprache sowie je Sprache und Thema. Neuere Lösungen zählen stärker.
+func estimateSkills(userID int) (map[string]*skillAccumulator, map[string]map[string]*skillAccumulator, error) {
+	outcomes, err := loadSolutionOutcomes(userID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	languages := make(map[string]*skillAccumulator)
+	topics := make(map[string]map[string]*skillAccumulator)
+
+	for _, o := range outcomes {
+		if languages[o.Language] == nil {
+			languages[o.Language] = &skillAccumulator{}
+			topics[o.Language] = make(map[string]*skillAccumulator)
+		}
+		languages[o.Language].add(o)
+
+		for _, topic := range o.Topics {
+			if topics[o.Language][topic] == nil {
+				topics[o.Language][topic] = &skillAccumulator{}
+			}
+			topics[o.Language][topic].add(o)
+		}
+	}
+
+	return languages, topics, nil
+}
+
+func recommendTask(userID int, language string) (models.TaskRecommendation, error) {
+	var rec models.TaskRecommendation
+
+	languages, topics, err := estimateSkills(userID)
+	if err != nil {
+		return rec, err
+	}
+
+	var reasons []string
+	language = strings.ToLower(strings.TrimSpace(language))
+
+	if language == "" {
+		weakest := math.Inf(1)
+		for lang, skill := range languages {
+			if skill.performance < weakest || (skill.performance == weakest && lang < language) {
+				weakest, language = skill.performance, lang
+			}
+		}
+		if language != "" {
+			reasons = append(reasons, fmt.Sprintf("In %s sind deine Ergebnisse zuletzt am schwächsten.", language))
+		}
+	}
+
+	if language == "" {
+		err = database.DB.Get(&language, `
+			SELECT COALESCE(language, '') FROM tasks
+			WHERE user_id = ?
+			ORDER BY id DESC
+			LIMIT 1`, userID)
+		if err != nil || language == "" {
+			return rec, fmt.Errorf("keine Sprache bekannt")
+		}
+		reasons = append(reasons, fmt.Sprintf("Zuletzt hast du in %s gearbeitet.", language))
+	}
+
+	rec.Language = language
+
+	if skill, ok := languages[language]; ok {
+		rec.Level = levelName(skill.score)
+		reasons = append(reasons, fmt.Sprintf(
+			"Aus %d bewerteten Lösungen in %s ergibt sich das Level %s (Leistung %.0f %%).",
+			skill.solutions, language, rec.Level, skill.performance*100))
+	} else {
+		rec.Level = taskLevels[defaultLevelIndex]
+		reasons = append(reasons, fmt.Sprintf("In %s gibt es noch keine bewerteten Lösungen, daher der Einstieg mit %s.", language, rec.Level))
+	}
+
+	weakTopic, weakPerformance := "", weakTopicCutoff
+	for topic, skill := range topics[language] {
+		if skill.performance < weakPerformance || (skill.performance == weakPerformance && topic < weakTopic) {
+			weakTopic, weakPerformance = topic, skill.performance
+		}
+	}
+
+	if weakTopic != "" {
+		rec.Topic = weakTopic
+		rec.Level = levelName(topics[language][weakTopic].score)
+		reasons = append(reasons, fmt.Sprintf("Das Thema %s sitzt noch nicht (Leistung %.0f %%) und wird auf Level %s wiederholt.",
+			weakTopic, weakPerformance*100, rec.Level))
+	} else {
+		var candidates []string
+		err = database.DB.Select(&candidates, `
+			SELECT topics.name
+			FROM topics
+				JOIN catalog_task_topics ctt ON ctt.topic_id = topics.id
+				JOIN catalog_tasks ON catalog_tasks.id = ctt.catalog_task_id
+			WHERE catalog_tasks.language = ?
+			GROUP BY topics.id
+			ORDER BY COUNT(*) DESC, topics.name`, language)
+		if err != nil {
+			return rec, err
+		}
+
+		for _, topic := range candidates {
+			if _, seen := topics[language][topic]; !seen {
+				rec.Topic = topic
+				reasons = append(reasons, fmt.Sprintf("Das Thema %s hast du in %s noch nicht bearbeitet.", topic, language))
+				break
+			}
+		}
+	}
+
+	rec.Skills = []models.SkillEstimate{}
+	for lang, skill := range languages {
+		rec.Skills = append(rec.Skills, skill.estimate(lang, ""))
+		for topic, topicSkill := range topics[lang] {
+			rec.Skills = append(rec.Skills, topicSkill.estimate(lang, topic))
+		}
+	}
+	sort.Slice(rec.Skills, func(i, j int) bool {
+		if rec.Skills[i].Language != rec.Skills[j].Language {
+			return rec.Skills[i].Language < rec.Skills[j].Language
+		}
+		return rec.Skills[i].Topic < rec.Skills[j].Topic
+	})
+
+	rec.Explanation = strings.Join(reasons, " ")
+	rec.TaskRequest = models.TaskRequest{
+		UserID:   userID,
+		Language: rec.Language,
+		Level:    rec.Level,
+		Topic:    rec.Topic,
+	}
+
+	return rec, nil
+}
+
+func GetNextTask(c *gin.Context) {
+	userID, err := strconv.Atoi(c.Query("user_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Ungültige User-ID"})
+		return
+	}
+
+	rec, err := recommendTask(userID, c.Query("language"))
+	if err != nil {
+		log.Printf("GetNextTask: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Keine Empfehlung möglich, bitte eine Sprache angeben"})
+		return
+	}
+
+	c.JSON(http.StatusOK, rec)
+}
+
+func GenerateNextTask(c *gin.Context) {
+	var req models.NextTaskRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	req.UserID, _ = currentUser(c)
+
+	rec, err := recommendTask(req.UserID, req.Language)
+	if err != nil {
+		log.Printf("GenerateNextTask: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Keine Empfehlung möglich, bitte eine Sprache angeben"})
+		return
+	}
+
+	rec.TaskRequest.Comment = req.Comment
+
+	task, err := generateDistinctTask(rec.TaskRequest)
+	if err != nil {
+		respondGenerationError(c, err)
+		return
+	}
+
+	if err := storeGeneratedTask(req.UserID, &task); err != nil {
+		log.Printf("GenerateNextTask: storeGeneratedTask failed: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Fehler beim Speichern der Aufgabe"})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.NextTaskResponse{Recommendation: rec, Task: task})
+}
@@ -0,0 +1,181 @@
+package handlers
+
+import (
+	"api-test/database"
+	"api-test/models"
+	"encoding/json"
+	"log"
+	"math"
+	"regexp"
+	"strings"
+)
+
+const snapshotEventPaste = "paste"
+
+// Übereinstimmung mit Antworten des Tutors zählt voll. Eingefügter Code kann auch aus
+// eigenen Notizen stammen, eine Nähe zur Musterlösung auch aus einer sauberen eigenen
+// Lösung, beide zählen deshalb schwächer.
+const (
+	pasteRelianceWeight     = 0.8
+	referenceRelianceWeight = 0.5
+)
+
+var codeFence = regexp.MustCompile("(?s)```[^\\n`]*\\n(.*?)```")
+
+// assistantCode liefert die Codeblöcke aus den Antworten des Tutors zu einer Aufgabe,
+// bei Antworten ohne Codeblock den ganzen Text.
+func assistantCode(taskID int) (string, error) {
+	var messages []string
+	err := database.DB.Select(&messages, "SELECT content FROM interactions WHERE task_id = ? AND role = 'assistant'", taskID)
+	if err != nil {
+		return "", err
+	}
+
+	var parts []string
+	for _, m := range messages {
+		blocks := codeFence.FindAllStringSubmatch(m, -1)
+		if len(blocks) == 0 {
+			parts = append(parts, m)
+			continue
+		}
+		for _, b := range blocks {
+			parts = append(parts, b[1])
+		}
+	}
+	return strings.Join(parts, "\n"), nil
+}
+
+// pastedCode sammelt den Text, der mit Snapshots des Ereignisses "paste" eingefügt wurde.
+func pastedCode(taskID int) (string, error) {
+	var snapshots []struct {
+		Kind    string `db:"kind"`
+		Content string `db:"content"`
+		Event   string `db:"event"`
+	}
+	err := database.DB.Select(&snapshots, `
+		SELECT kind, content, COALESCE(event, '') AS event
+		FROM code_snapshots
+		WHERE task_id = ?
+		ORDER BY id`, taskID)
+	if err != nil {
+		return "", err
+	}
+
+	var parts []string
+	code := ""
+	for _, s := range snapshots {
+		d := codeDiff{}
+		if s.Kind == "full" {
+			d = diffCode(code, s.Content)
+			code = s.Content
+		} else {
+			if err := json.Unmarshal([]byte(s.Content), &d); err != nil {
+				return "", err
+			}
+			if code, err = applyDiff(code, d); err != nil {
+				return "", err
+			}
+		}
+
+		if s.Event == snapshotEventPaste && d.Insert != "" {
+			parts = append(parts, d.Insert)
+		}
+	}
+	return strings.Join(parts, "\n"), nil
+}
+
+// coverage ist der Anteil der Fingerabdrücke einer Abgabe, die auch in der Quelle
+// vorkommen. Zu kurze Abgaben erlauben keine Aussage.
+func (fp codeFingerprint) coverage(source codeFingerprint) float64 {
+	if len(fp.hashes) < minFingerprints {
+		return 0
+	}
+
+	var shared int
+	for h := range fp.hashes {
+		if _, ok := source.hashes[h]; ok {
+			shared++
+		}
+	}
+	return math.Round(float64(shared)/float64(len(fp.hashes))*100) / 100
+}
+
+// relianceSources hält die Fingerabdrücke einer Abgabe und ihrer KI-Quellen, damit die
+// Schätzung vor und nach der Bewertung nur einmal aus Chat und Snapshots gerechnet wird.
+type relianceSources struct {
+	code      codeFingerprint
+	tutor     codeFingerprint
+	paste     codeFingerprint
+	reference *codeFingerprint
+}
+
+// loadRelianceSources liest Tutor-Antworten und eingefügten Code einer Aufgabe. Vorgegebener
+// Ausgangscode zählt nicht zur Abgabe. Als Musterlösung dient die beim Generieren der Aufgabe
+// entstandene, nie die aus der Bewertung, denn die passt die KI der Abgabe an. Bei einem
+// Fehler gibt es keine Schätzung (nil).
+func loadRelianceSources(taskID int, code, language, starter, reference string) *relianceSources {
+	tutor, err := assistantCode(taskID)
+	if err != nil {
+		log.Printf("loadRelianceSources(%d): %v", taskID, err)
+		return nil
+	}
+	pasted, err := pastedCode(taskID)
+	if err != nil {
+		log.Printf("loadRelianceSources(%d): %v", taskID, err)
+		return nil
+	}
+
+	fp := fingerprintCode(code, language)
+	if starter != "" {
+		fp = fp.without(fingerprintCode(starter, language))
+	}
+
+	sources := &relianceSources{
+		code:  fp,
+		tutor: fingerprintCode(tutor, language),
+		paste: fingerprintCode(pasted, language),
+	}
+	if reference != "" {
+		referenceFP := fingerprintCode(reference, language)
+		sources.reference = &referenceFP
+	}
+	return sources
+}
+
+// reliance schätzt, wie viel einer Abgabe aus KI-Quellen stammt: aus den Antworten des
+// Tutors, aus eingefügtem Code und, falls die Aufgabe eine hat, aus der Musterlösung.
+// Anders als die Selbstauskunft ai_usage wird der Wert serverseitig ermittelt.
+func (s *relianceSources) reliance() models.AIReliance {
+	var reliance models.AIReliance
+	reliance.Tutor = s.code.coverage(s.tutor)
+	reliance.Paste = s.code.coverage(s.paste)
+	if s.reference != nil {
+		overlap := s.code.coverage(*s.reference)
+		reliance.Reference = &overlap
+	}
+
+	score := math.Max(reliance.Tutor, pasteRelianceWeight*reliance.Paste)
+	if reliance.Reference != nil {
+		score = math.Max(score, referenceRelianceWeight**reliance.Reference)
+	}
+	reliance.Score = math.Round(score*100) / 100
+	return reliance
+}
+
+// estimate liefert den Wert der Schätzung für den Bewertungsprompt.
+func (s *relianceSources) estimate() *float64 {
+	if s == nil {
+		return nil
+	}
+	reliance := s.reliance()
+	return &reliance.Score
+}
+
+// attach ergänzt eine Bewertung um die Schätzung mit ihren Einzelwerten.
+func (s *relianceSources) attach(eval *models.TaskEvaluation) {
+	if s == nil {
+		return
+	}
+	reliance := s.reliance()
+	eval.AIReliance = &reliance
+}
@@ -0,0 +1,163 @@
+package handlers
+
+import (
+	"api-test/database"
+	"api-test/models"
+	"database/sql"
+	"errors"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jmoiron/sqlx"
+)
+
+const (
+	initialEasiness = 2.5
+	minEasiness     = 1.3
+	reviewThreshold = 3
+)
+
+// reviewQuality bildet eine Lösung auf die SM-2-Qualitätsstufen 0 bis 5 ab.
+func reviewQuality(o solutionOutcome, hints int) int {
+	return int(math.Round(ratingOutcome(o, hints) * 5))
+}
+
+// sm2 berechnet Leichtigkeitsfaktor, Intervall in Tagen und Anzahl erfolgreicher
+// Wiederholungen nach dem SM-2-Verfahren.
+func sm2(easiness float64, interval, repetitions, quality int) (float64, int, int) {
+	if quality < reviewThreshold {
+		repetitions = 0
+		interval = 1
+	} else {
+		switch repetitions {
+		case 0:
+			interval = 1
+		case 1:
+			interval = 6
+		default:
+			interval = int(math.Round(float64(interval) * easiness))
+		}
+		repetitions++
+	}
+
+	q := float64(5 - quality)
+	easiness = math.Max(minEasiness, easiness+0.1-q*(0.08+q*0.02))
+
+	return easiness, interval, repetitions
+}
+
+type reviewKey struct {
+	topic         string
+	catalogTaskID int
+}
+
+// updateReviewQueue plant nach einer bewerteten Lösung die betroffenen Themen neu ein.
+// Schwache Ergebnisse nehmen ein Thema (oder ohne Thema die Katalogaufgabe) neu in die
+// Warteschlange auf, jede weitere Lösung dazu verschiebt den nächsten Termin.
+func updateReviewQueue(tx *sqlx.Tx, solutionID int64) error {
+	o, userID, hints, err := loadSolutionOutcome(tx, solutionID)
+	if err != nil {
+		return err
+	}
+
+	var keys []reviewKey
+	for _, topic := range o.Topics {
+		keys = append(keys, reviewKey{topic: topic})
+	}
+	if len(keys) == 0 && o.CatalogTaskID > 0 {
+		keys = append(keys, reviewKey{catalogTaskID: o.CatalogTaskID})
+	}
+
+	quality := reviewQuality(o, hints)
+	now := time.Now()
+
+	for _, key := range keys {
+		var item models.ReviewItem
+		err := tx.Get(&item, `
+			SELECT id, easiness, interval_days, repetitions
+			FROM review_items
+			WHERE user_id = ? AND language = ? AND topic = ? AND catalog_task_id = ?`,
+			userID, o.Language, key.topic, key.catalogTaskID)
+		if errors.Is(err, sql.ErrNoRows) {
+			if quality >= reviewThreshold {
+				continue
+			}
+			item.Easiness = initialEasiness
+		} else if err != nil {
+			return err
+		}
+
+		easiness, interval, repetitions := sm2(item.Easiness, item.IntervalDays, item.Repetitions, quality)
+		dueAt := now.AddDate(0, 0, interval).UnixMilli()
+
+		_, err = tx.Exec(`
+			INSERT INTO review_items (user_id, language, topic, catalog_task_id, level, easiness, interval_days,
+				repetitions, last_quality, last_task_id, due_at, updated_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+			ON CONFLICT (user_id, language, topic, catalog_task_id) DO UPDATE SET
+				level = excluded.level,
+				easiness = excluded.easiness,
+				interval_days = excluded.interval_days,
+				repetitions = excluded.repetitions,
+				last_quality = excluded.last_quality,
+				last_task_id = excluded.last_task_id,
+				due_at = excluded.due_at,
+				updated_at = excluded.updated_at
+		`, userID, o.Language, key.topic, key.catalogTaskID, o.Level, easiness, interval,
+			repetitions, quality, o.TaskID, dueAt, now.UnixMilli())
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func GetReviewQueue(c *gin.Context) {
+	userID, err := strconv.Atoi(c.Query("user_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Ungültige User-ID"})
+		return
+	}
+
+	now := time.Now()
+	endOfDay := time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, now.Location()).UnixMilli()
+
+	queue := models.ReviewQueue{Due: []models.ReviewItem{}}
+	err = database.DB.Select(&queue.Due, `
+		SELECT id, language, topic, NULLIF(catalog_task_id, 0) AS catalog_task_id, COALESCE(level, '') AS level,
+			easiness, interval_days, repetitions, last_quality, last_task_id, due_at
+		FROM review_items
+		WHERE user_id = ? AND due_at < ?
+		ORDER BY due_at`, userID, endOfDay)
+	if err != nil {
+		log.Printf("DB Error (review queue): %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Fehler beim Abrufen der Wiederholungen"})
+		return
+	}
+
+	err = database.DB.Get(&queue.Upcoming, "SELECT COUNT(*) FROM review_items WHERE user_id = ? AND due_at >= ?", userID, endOfDay)
+	if err != nil {
+		log.Printf("DB Error (review upcoming): %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Fehler beim Abrufen der Wiederholungen"})
+		return
+	}
+
+	for i := range queue.Due {
+		item := &queue.Due[i]
+		if item.Topic != "" {
+			item.Suggestion = &models.TaskRequest{
+				UserID:   userID,
+				Language: item.Language,
+				Level:    item.Level,
+				Topic:    item.Topic,
+			}
+		}
+	}
+
+	c.JSON(http.StatusOK, queue)
+}
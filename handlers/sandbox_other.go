@@ -0,0 +1,14 @@
+//go:build !linux
+
+package handlers
+
+import (
+	"errors"
+	"os/exec"
+)
+
+// sandbox ist nur unter Linux umgesetzt. Ohne Sandbox laufen keine externen Werkzeuge,
+// die eingebauten Metriken bleiben verfügbar.
+func sandbox(*exec.Cmd) error {
+	return errors.New("keine Sandbox für dieses Betriebssystem")
+}
@@ -0,0 +1,452 @@
+package handlers
+
+import (
+	"api-test/database"
+	"api-test/models"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	sessionStarted   = "started"
+	sessionPaused    = "paused"
+	sessionResumed   = "resumed"
+	sessionSubmitted = "submitted"
+	sessionAbandoned = "abandoned"
+)
+
+var (
+	errSessionAbandoned = errors.New("Sitzung wurde abgebrochen")
+	errSessionSubmitted = errors.New("Sitzung wurde bereits abgegeben")
+	sessionMu           sync.Mutex
+)
+
+var sessionActions = map[string]string{
+	"start":   sessionStarted,
+	"pause":   sessionPaused,
+	"resume":  sessionResumed,
+	"abandon": sessionAbandoned,
+}
+
+// sessionTransitions legt fest, aus welchen Zuständen ein Zustand erreichbar ist.
+// Ein leerer Zustand bedeutet, dass noch keine Sitzung existiert.
+var sessionTransitions = map[string][]string{
+	sessionStarted:   {""},
+	sessionPaused:    {sessionStarted, sessionResumed},
+	sessionResumed:   {sessionPaused},
+	sessionAbandoned: {sessionStarted, sessionResumed, sessionPaused},
+}
+
+func isActive(state string) bool {
+	return state == sessionStarted || state == sessionResumed
+}
+
+func loadSessionEvents(taskID int) ([]models.TaskSessionEvent, error) {
+	var events []models.TaskSessionEvent
+	err := database.DB.Select(&events, `
+		SELECT id, user_id, state, auto, created_at
+		FROM task_session_events
+		WHERE task_id = ?
+		ORDER BY created_at, id`, taskID)
+	return events, err
+}
+
+func currentState(events []models.TaskSessionEvent) string {
+	if len(events) == 0 {
+		return ""
+	}
+	return events[len(events)-1].State
+}
+
+// sessionElapsed summiert die aktiven Intervalle einer Sitzung bis now (Unix-Millisekunden).
+// Bei gesetztem Zeitlimit wird zusätzlich der Zeitpunkt zurückgegeben, an dem das Limit
+// erreicht wurde bzw. wird; 0 wenn kein Limit aktiv ist.
+func sessionElapsed(events []models.TaskSessionEvent, now int64, timeLimit int) (int64, int64) {
+	var elapsed int64
+	var activeSince int64 = -1
+
+	for _, e := range events {
+		if activeSince >= 0 {
+			elapsed += e.CreatedAt - activeSince
+			activeSince = -1
+		}
+		if isActive(e.State) {
+			activeSince = e.CreatedAt
+		}
+	}
+
+	var deadline int64
+	if activeSince >= 0 {
+		if timeLimit > 0 {
+			deadline = activeSince + int64(timeLimit)*1000 - elapsed
+		}
+		elapsed += now - activeSince
+	}
+
+	if timeLimit > 0 && elapsed > int64(timeLimit)*1000 {
+		elapsed = int64(timeLimit) * 1000
+	}
+
+	return elapsed / 1000, deadline
+}
+
+func recordSessionEvent(taskID, userID int, state string, auto bool, at int64) error {
+	_, err := database.DB.Exec(`
+		INSERT INTO task_session_events (task_id, user_id, state, auto, created_at)
+		VALUES (?, ?, ?, ?, ?)
+	`, taskID, userID, state, auto, at)
+	return err
+}
+
+func taskTimeLimit(taskID int) (int, error) {
+	var timeLimit int
+	err := database.DB.Get(&timeLimit, "SELECT COALESCE(time_limit, 0) FROM tasks WHERE id = ?", taskID)
+	return timeLimit, err
+}
+
+// expireSession gibt eine aktive Sitzung automatisch ab, sobald ihr Zeitlimit
+// überschritten ist, und stößt die Bewertung des letzten Snapshots an.
+// Muss mit gehaltenem sessionMu aufgerufen werden.
+func expireSession(taskID int) ([]models.TaskSessionEvent, error) {
+	events, err := loadSessionEvents(taskID)
+	if err != nil || !isActive(currentState(events)) {
+		return events, err
+	}
+
+	timeLimit, err := taskTimeLimit(taskID)
+	if err != nil || timeLimit == 0 {
+		return events, err
+	}
+
+	now := time.Now().UnixMilli()
+	_, deadline := sessionElapsed(events, now, timeLimit)
+	if deadline > now {
+		return events, nil
+	}
+
+	userID := events[len(events)-1].UserID
+	if err := recordSessionEvent(taskID, userID, sessionSubmitted, true, deadline); err != nil {
+		return events, err
+	}
+
+	log.Printf("Task %d: Zeitlimit erreicht, automatisch abgegeben", taskID)
+	go autoEvaluate(taskID, deadline, timeLimit)
+
+	return loadSessionEvents(taskID)
+}
+
+func autoEvaluate(taskID int, deadline int64, timeSpent int) {
+	task, err := loadEvaluationTask(taskID)
+	if err != nil {
+		log.Printf("autoEvaluate(%d): task fetch failed: %v", taskID, err)
+		return
+	}
+
+	code, _, err := reconstructCode(taskID, deadline)
+	if err != nil {
+		log.Printf("autoEvaluate(%d): reconstruct failed: %v", taskID, err)
+		return
+	}
+	if code == "" {
+		log.Printf("autoEvaluate(%d): kein Code vorhanden, keine Bewertung", taskID)
+		return
+	}
+
+	var chatMessages int
+	err = database.DB.Get(&chatMessages, "SELECT COUNT(*) FROM interactions WHERE task_id = ? AND role = 'user'", taskID)
+	if err != nil {
+		log.Printf("autoEvaluate(%d): interaction count failed: %v", taskID, err)
+		return
+	}
+
+	useAI := chatMessages > 0
+
+	assignment, err := loadTaskAssignment(taskID)
+	if err != nil {
+		log.Printf("autoEvaluate(%d): assignment fetch failed: %v", taskID, err)
+		return
+	}
+
+	penalty := 0.0
+	if assignment != nil {
+		penalty, err = checkSubmission(*assignment, taskID, useAI, deadline)
+		if err != nil {
+			log.Printf("autoEvaluate(%d): keine Bewertung: %v", taskID, err)
+			return
+		}
+		if err := reserveSubmission(*assignment, taskID); err != nil {
+			log.Printf("autoEvaluate(%d): keine Bewertung: %v", taskID, err)
+			return
+		}
+		defer releaseSubmission(taskID)
+	}
+
+	settings, err := evaluationSettingsFor(taskID)
+	if err != nil {
+		log.Printf("autoEvaluate(%d): settings fetch failed: %v", taskID, err)
+		return
+	}
+
+	// Die Snapshots halten mehrere Dateien mit Kopfzeilen in einem Text. Zerlegt wird er nur
+	// bei Mehrdateiaufgaben; eine einzelne Datei bleibt Code, auch wenn ihre erste Zeile wie
+	// eine Kopfzeile aussieht.
+	var files []models.CodeFile
+	if task.MultiFile {
+		files = unflattenFiles(code)
+	}
+	analysis := analyzeSubmission(code, files, task.Language, task.Type)
+
+	reliance := loadRelianceSources(taskID, code, task.Language, task.Starter, task.Reference)
+
+	result, err := consensusEvaluate(evaluationInput{
+		Task:          task.Description,
+		Code:          code,
+		Level:         task.Level,
+		Language:      task.Language,
+		UseAI:         useAI,
+		TimeEstimated: task.TimeEstimated,
+		TimeSpent:     timeSpent,
+		AIReliance:    reliance.estimate(),
+		Analysis:      analysis,
+		Type:          task.Type,
+		Starter:       task.Starter,
+		AnswerKey:     task.AnswerKey,
+		EntryPoints:   task.entryPoints(),
+		Tests:         task.Tests,
+	}, settings)
+	if err != nil {
+		log.Printf("autoEvaluate(%d): %v", taskID, err)
+		return
+	}
+
+	reliance.attach(&result.Eval)
+	result.Eval.Analysis = analysis
+
+	finalMark := applyLatePenalty(&result.Eval, result.Mark, penalty)
+	if err := saveSolution(taskID, code, files, result, finalMark, useAI, timeSpent); err != nil {
+		log.Printf("autoEvaluate(%d): saveSolution failed: %v", taskID, err)
+	}
+}
+
+// submitSession schließt die Sitzung einer Aufgabe ab und liefert die serverseitig
+// gemessene Bearbeitungszeit in Sekunden. Ohne Sitzung wird auf die aus Snapshots
+// und Chatnachrichten gemessene Zeit zurückgegriffen. Eine bereits abgegebene Sitzung,
+// auch eine beim Zeitlimit automatisch abgegebene, lässt keine weitere Abgabe zu.
+func submitSession(taskID, userID int) (int, error) {
+	sessionMu.Lock()
+	defer sessionMu.Unlock()
+
+	events, err := expireSession(taskID)
+	if err != nil {
+		return 0, err
+	}
+
+	if len(events) == 0 {
+		return measuredTimeSpent(taskID)
+	}
+
+	timeLimit, err := taskTimeLimit(taskID)
+	if err != nil {
+		return 0, err
+	}
+
+	now := time.Now().UnixMilli()
+	elapsed, _ := sessionElapsed(events, now, timeLimit)
+
+	switch currentState(events) {
+	case sessionAbandoned:
+		return 0, errSessionAbandoned
+	case sessionSubmitted:
+		return 0, errSessionSubmitted
+	}
+
+	if err := recordSessionEvent(taskID, userID, sessionSubmitted, false, now); err != nil {
+		return 0, err
+	}
+
+	return int(elapsed), nil
+}
+
+// reopenSession nimmt eine manuelle Abgabe zurück, wenn ihre Bewertung gescheitert ist,
+// damit die Aufgabe erneut abgegeben werden kann. Automatische Abgaben bleiben bestehen.
+func reopenSession(taskID int) {
+	sessionMu.Lock()
+	defer sessionMu.Unlock()
+
+	_, err := database.DB.Exec(`
+		DELETE FROM task_session_events
+		WHERE id = (SELECT MAX(id) FROM task_session_events WHERE task_id = ?)
+			AND state = ? AND auto = 0`, taskID, sessionSubmitted)
+	if err != nil {
+		log.Printf("reopenSession(%d): %v", taskID, err)
+	}
+}
+
+// sessionClosed meldet, ob eine Aufgabe bereits abgegeben oder abgebrochen wurde.
+func sessionClosed(taskID int) (bool, error) {
+	sessionMu.Lock()
+	defer sessionMu.Unlock()
+
+	events, err := expireSession(taskID)
+	if err != nil {
+		return false, err
+	}
+
+	state := currentState(events)
+	return state == sessionSubmitted || state == sessionAbandoned, nil
+}
+
+func RunSessionSweeper(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		var taskIDs []int
+		err := database.DB.Select(&taskIDs, `
+			SELECT e.task_id
+			FROM task_session_events e
+				JOIN tasks ON tasks.id = e.task_id
+			WHERE tasks.time_limit > 0
+				AND e.id = (SELECT MAX(id) FROM task_session_events WHERE task_id = e.task_id)
+				AND e.state IN ('started', 'resumed')`)
+		if err != nil {
+			log.Printf("RunSessionSweeper: query failed: %v", err)
+			continue
+		}
+
+		for _, taskID := range taskIDs {
+			sessionMu.Lock()
+			if _, err := expireSession(taskID); err != nil {
+				log.Printf("RunSessionSweeper: expire %d failed: %v", taskID, err)
+			}
+			sessionMu.Unlock()
+		}
+	}
+}
+
+func buildSession(taskID int, events []models.TaskSessionEvent) (models.TaskSession, error) {
+	session := models.TaskSession{
+		TaskID: taskID,
+		State:  currentState(events),
+		Events: events,
+	}
+	if session.Events == nil {
+		session.Events = []models.TaskSessionEvent{}
+	}
+
+	timeLimit, err := taskTimeLimit(taskID)
+	if err != nil {
+		return session, err
+	}
+
+	elapsed, _ := sessionElapsed(events, time.Now().UnixMilli(), timeLimit)
+	session.Elapsed = int(elapsed)
+
+	if timeLimit > 0 {
+		remaining := timeLimit - session.Elapsed
+		if remaining < 0 {
+			remaining = 0
+		}
+		session.TimeLimit = &timeLimit
+		session.Remaining = &remaining
+	}
+
+	return session, nil
+}
+
+func UpdateTaskSession(c *gin.Context) {
+	var req models.TaskSessionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	req.UserID, _ = currentUser(c)
+	if !ownTask(c, req.TaskID) {
+		return
+	}
+
+	next, ok := sessionActions[req.Action]
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unbekannte Aktion"})
+		return
+	}
+
+	sessionMu.Lock()
+	defer sessionMu.Unlock()
+
+	if _, err := taskTimeLimit(req.TaskID); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Aufgabe nicht gefunden"})
+		return
+	}
+
+	events, err := expireSession(req.TaskID)
+	if err != nil {
+		log.Printf("UpdateTaskSession: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Fehler beim Laden der Sitzung"})
+		return
+	}
+
+	state := currentState(events)
+	valid := false
+	for _, from := range sessionTransitions[next] {
+		if from == state {
+			valid = true
+			break
+		}
+	}
+	if !valid {
+		c.JSON(http.StatusConflict, gin.H{"error": "Aktion im aktuellen Zustand nicht möglich", "state": state})
+		return
+	}
+
+	if err := recordSessionEvent(req.TaskID, req.UserID, next, false, time.Now().UnixMilli()); err != nil {
+		log.Printf("UpdateTaskSession: Insertion failed: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Fehler beim Speichern der Sitzung"})
+		return
+	}
+
+	events, err = loadSessionEvents(req.TaskID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Fehler beim Laden der Sitzung"})
+		return
+	}
+
+	session, err := buildSession(req.TaskID, events)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Fehler beim Laden der Sitzung"})
+		return
+	}
+
+	c.JSON(http.StatusOK, session)
+}
+
+func GetTaskSession(c *gin.Context) {
+	taskID, err := strconv.Atoi(c.Param("task_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Ungültige Task-ID"})
+		return
+	}
+
+	sessionMu.Lock()
+	events, err := expireSession(taskID)
+	sessionMu.Unlock()
+	if err != nil {
+		log.Printf("GetTaskSession: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Fehler beim Laden der Sitzung"})
+		return
+	}
+
+	session, err := buildSession(taskID, events)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Aufgabe nicht gefunden"})
+		return
+	}
+
+	c.JSON(http.StatusOK, session)
+}
@@ -0,0 +1,153 @@
+package handlers
+
+import (
+	"api-test/database"
+	"math"
+	"strings"
+	"unicode"
+)
+
+const (
+	shingleSize         = 3
+	stemLength          = 6
+	similarityThreshold = 0.35
+)
+
+// stopWords enthält Füllwörter und typische Formulierungen von Aufgabenstellungen,
+// die in fast jeder Aufgabe vorkommen und nichts über ihren Inhalt aussagen.
+var stopWords = map[string]bool{
+	"aber": true, "alle": true, "also": true, "auch": true, "dann": true, "dass": true,
+	"diese": true, "dieser": true, "eine": true, "einem": true, "einen": true, "einer": true,
+	"eines": true, "sich": true, "sind": true, "soll": true, "sollen": true, "sollte": true,
+	"oder": true, "wenn": true, "werden": true, "wird": true, "durch": true, "jede": true,
+	"jeden": true, "jedes": true, "nach": true, "über": true, "unter": true, "zwischen": true,
+	"schreibe": true, "schreiben": true, "programm": true, "programms": true, "implementiere": true,
+	"implementieren": true, "erstelle": true, "erstellen": true, "entwickle": true, "funktion": true,
+	"aufgabe": true, "ausgibt": true, "ausgeben": true, "ausgabe": true, "eingabe": true,
+	"benutzer": true, "nutzer": true, "zurückgibt": true, "gibt": true, "beispiel": true,
+	"that": true, "this": true, "with": true, "from": true, "write": true, "program": true,
+	"function": true, "should": true, "which": true, "each": true, "returns": true, "return": true,
+	"input": true, "output": true, "user": true,
+}
+
+func normalizeWords(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+type fingerprint struct {
+	stems    map[string]bool
+	shingles map[string]bool
+}
+
+// textFingerprint bildet die Menge der Inhaltswörter und der Wort-Shingles eines Textes.
+// Die auf ihren Anfang gekürzten Wörter erkennen umformulierte Varianten trotz Flexion,
+// die Shingles wörtliche Übernahmen.
+func textFingerprint(text string) fingerprint {
+	words := normalizeWords(text)
+	fp := fingerprint{stems: make(map[string]bool), shingles: make(map[string]bool)}
+
+	for _, w := range words {
+		r := []rune(w)
+		if len(r) <= 3 || stopWords[w] {
+			continue
+		}
+		if len(r) > stemLength {
+			r = r[:stemLength]
+		}
+		fp.stems[string(r)] = true
+	}
+	for i := 0; i+shingleSize <= len(words); i++ {
+		fp.shingles[strings.Join(words[i:i+shingleSize], " ")] = true
+	}
+	return fp
+}
+
+// similarity liefert das stärkere Signal aus der nach idf gewichteten Jaccard-Ähnlichkeit
+// der Wortstämme und der ungewichteten Jaccard-Ähnlichkeit der Shingles.
+func (fp fingerprint) similarity(other fingerprint, idf func(string) float64) float64 {
+	var intersection, union float64
+	for s := range fp.stems {
+		w := idf(s)
+		union += w
+		if other.stems[s] {
+			intersection += w
+		}
+	}
+	for s := range other.stems {
+		if !fp.stems[s] {
+			union += idf(s)
+		}
+	}
+
+	stems := 0.0
+	if union > 0 {
+		stems = intersection / union
+	}
+
+	return math.Max(stems, jaccard(fp.shingles, other.shingles))
+}
+
+func jaccard(a, b map[string]bool) float64 {
+	if len(a) == 0 || len(b) == 0 {
+		return 0
+	}
+
+	intersection := 0
+	for k := range a {
+		if b[k] {
+			intersection++
+		}
+	}
+
+	return float64(intersection) / float64(len(a)+len(b)-intersection)
+}
+
+// corpusIDF liefert die inverse Dokumentfrequenz der Wortstämme eines Korpus.
+// Stämme, die in vielen Aufgaben vorkommen, zählen dadurch weniger.
+func corpusIDF(corpus []fingerprint) func(string) float64 {
+	df := make(map[string]int)
+	for _, fp := range corpus {
+		for s := range fp.stems {
+			df[s]++
+		}
+	}
+
+	n := float64(len(corpus))
+	return func(stem string) float64 {
+		return math.Log(1 + n/float64(df[stem]+1))
+	}
+}
+
+// mostSimilarTask vergleicht eine Aufgabenbeschreibung mit den bisherigen Aufgaben
+// des Users und optional dem Katalog derselben Sprache und liefert die höchste
+// Ähnlichkeit samt der ähnlichsten Beschreibung.
+func mostSimilarTask(userID int, language, description string, includeCatalog bool) (float64, string, error) {
+	var previous []string
+	err := database.DB.Select(&previous, `
+		SELECT description FROM tasks
+		WHERE user_id = ?
+		UNION ALL
+		SELECT description FROM catalog_tasks
+		WHERE ? AND language = ?`, userID, includeCatalog, strings.ToLower(language))
+	if err != nil {
+		return 0, "", err
+	}
+
+	candidate := textFingerprint(description)
+	corpus := []fingerprint{candidate}
+	for _, p := range previous {
+		corpus = append(corpus, textFingerprint(p))
+	}
+	idf := corpusIDF(corpus)
+
+	best, bestDescription := 0.0, ""
+	for i, p := range previous {
+		if score := candidate.similarity(corpus[i+1], idf); score > best {
+			best, bestDescription = score, p
+		}
+	}
+
+	return best, bestDescription, nil
+}
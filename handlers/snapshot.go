@@ -0,0 +1,318 @@
+package handlers
+
+import (
+	"api-test/database"
+	"api-test/models"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	snapshotKeyframeInterval = 25
+	maxSnapshotLength        = 200000
+	idleThreshold            = 5 * time.Minute
+)
+
+// snapshotMu hält Lesen des letzten Stands und Speichern des nächsten Diffs zusammen.
+// Zwei parallele Diffs auf dieselbe Basis würden die Kette dauerhaft zerstören.
+var snapshotMu sync.Mutex
+
+// codeDiff beschreibt eine Änderung als gemeinsamen Präfix und Suffix
+// des alten Codes plus den dazwischen eingefügten Text.
+type codeDiff struct {
+	Prefix int    `json:"p"`
+	Suffix int    `json:"s"`
+	Insert string `json:"i"`
+}
+
+func diffCode(old, new string) codeDiff {
+	prefix := 0
+	for prefix < len(old) && prefix < len(new) && old[prefix] == new[prefix] {
+		prefix++
+	}
+	for prefix > 0 && prefix < len(new) && !utf8.RuneStart(new[prefix]) {
+		prefix--
+	}
+
+	suffix := 0
+	for suffix < len(old)-prefix && suffix < len(new)-prefix && old[len(old)-1-suffix] == new[len(new)-1-suffix] {
+		suffix++
+	}
+	for suffix > 0 && !utf8.RuneStart(new[len(new)-suffix]) {
+		suffix--
+	}
+
+	return codeDiff{Prefix: prefix, Suffix: suffix, Insert: new[prefix : len(new)-suffix]}
+}
+
+func applyDiff(old string, d codeDiff) (string, error) {
+	if d.Prefix < 0 || d.Suffix < 0 || d.Prefix+d.Suffix > len(old) {
+		return "", fmt.Errorf("ungültiger Diff (p=%d, s=%d) für Länge %d", d.Prefix, d.Suffix, len(old))
+	}
+	return old[:d.Prefix] + d.Insert + old[len(old)-d.Suffix:], nil
+}
+
+// reconstructCode baut den Code einer Aufgabe zum Zeitpunkt at (Unix-Millisekunden)
+// aus dem letzten Keyframe und den darauf folgenden Diffs wieder auf.
+// Der zweite Rückgabewert gibt die Anzahl der Diffs seit dem Keyframe an,
+// -1 wenn noch kein Snapshot existiert.
+func reconstructCode(taskID int, at int64) (string, int, error) {
+	var keyframeID int
+	err := database.DB.Get(&keyframeID, `
+		SELECT COALESCE(MAX(id), 0) FROM code_snapshots
+		WHERE task_id = ? AND kind = 'full' AND created_at <= ?`, taskID, at)
+	if err != nil {
+		return "", -1, err
+	}
+	if keyframeID == 0 {
+		return "", -1, nil
+	}
+
+	rows, err := database.DB.Query(`
+		SELECT kind, content FROM code_snapshots
+		WHERE task_id = ? AND id >= ? AND created_at <= ?
+		ORDER BY id`, taskID, keyframeID, at)
+	if err != nil {
+		return "", -1, err
+	}
+	defer rows.Close()
+
+	code := ""
+	diffs := -1
+	for rows.Next() {
+		var kind, content string
+		if err := rows.Scan(&kind, &content); err != nil {
+			return "", -1, err
+		}
+
+		if kind == "full" {
+			code = content
+			diffs = 0
+			continue
+		}
+
+		var d codeDiff
+		if err := json.Unmarshal([]byte(content), &d); err != nil {
+			return "", -1, err
+		}
+		if code, err = applyDiff(code, d); err != nil {
+			return "", -1, err
+		}
+		diffs++
+	}
+
+	return code, diffs, rows.Err()
+}
+
+// measuredTimeSpent berechnet die Bearbeitungszeit in Sekunden aus den Zeitstempeln
+// von Snapshots und Chatnachrichten. Pausen über idleThreshold zählen nicht mit.
+func measuredTimeSpent(taskID int) (int, error) {
+	var times []int64
+	err := database.DB.Select(&times, `
+		SELECT created_at FROM code_snapshots WHERE task_id = ?
+		UNION ALL
+		SELECT created_at FROM interactions WHERE task_id = ? AND created_at IS NOT NULL
+		ORDER BY created_at`, taskID, taskID)
+	if err != nil {
+		return 0, err
+	}
+
+	var total time.Duration
+	for i := 1; i < len(times); i++ {
+		gap := time.Duration(times[i]-times[i-1]) * time.Millisecond
+		if gap > idleThreshold {
+			gap = idleThreshold
+		}
+		total += gap
+	}
+
+	return int(total.Seconds()), nil
+}
+
+func SaveCodeSnapshot(c *gin.Context) {
+	var req models.CodeSnapshotRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	req.UserID, _ = currentUser(c)
+	if !ownTask(c, req.TaskID) {
+		return
+	}
+
+	code, _, err := submittedCode(req.Code, req.Files)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	req.Code = code
+
+	if len(req.Code) > maxSnapshotLength {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Code ist zu lang"})
+		return
+	}
+
+	closed, err := sessionClosed(req.TaskID)
+	if err != nil {
+		log.Printf("SaveCodeSnapshot: sessionClosed failed: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Fehler beim Laden der Sitzung"})
+		return
+	}
+	if closed {
+		c.JSON(http.StatusConflict, gin.H{"error": "Aufgabe wurde bereits abgegeben"})
+		return
+	}
+
+	snapshotMu.Lock()
+	defer snapshotMu.Unlock()
+
+	now := time.Now().UnixMilli()
+
+	previous, diffs, err := reconstructCode(req.TaskID, now)
+	if err != nil {
+		log.Printf("SaveCodeSnapshot: reconstruct failed: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Fehler beim Laden des letzten Snapshots"})
+		return
+	}
+
+	if diffs >= 0 && previous == req.Code && req.Event == "" {
+		c.JSON(http.StatusOK, gin.H{"message": "Code unverändert"})
+		return
+	}
+
+	kind := "full"
+	content := req.Code
+	if diffs >= 0 && diffs < snapshotKeyframeInterval {
+		b, err := json.Marshal(diffCode(previous, req.Code))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Fehler beim Erstellen des Diffs"})
+			return
+		}
+		kind = "diff"
+		content = string(b)
+	}
+
+	_, err = database.DB.Exec(`
+		INSERT INTO code_snapshots (user_id, task_id, kind, content, length, event, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`, req.UserID, req.TaskID, kind, content, len(req.Code), req.Event, now)
+	if err != nil {
+		log.Printf("SaveCodeSnapshot: Insertion failed: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Fehler beim Speichern des Snapshots"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Snapshot gespeichert", "created_at": now})
+}
+
+func ReplayTask(c *gin.Context) {
+	taskID, err := strconv.Atoi(c.Param("task_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Ungültige Task-ID"})
+		return
+	}
+
+	at := time.Now().UnixMilli()
+	if raw := c.Query("at"); raw != "" {
+		at, err = strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Ungültiger Zeitpunkt"})
+			return
+		}
+	}
+
+	code, _, err := reconstructCode(taskID, at)
+	if err != nil {
+		log.Printf("ReplayTask: reconstruct failed: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Fehler beim Wiederherstellen des Codes"})
+		return
+	}
+
+	replay := models.CodeReplay{TaskID: taskID, At: at, Code: code}
+	err = database.DB.Select(&replay.Interactions, `
+		SELECT * FROM interactions
+		WHERE task_id = ? AND created_at <= ?
+		ORDER BY id`, taskID, at)
+	if err != nil {
+		log.Printf("ReplayTask: interaction fetch failed: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Fehler beim Laden des Chatverlaufs"})
+		return
+	}
+	if replay.Interactions == nil {
+		replay.Interactions = []models.TaskInteraction{}
+	}
+
+	c.JSON(http.StatusOK, replay)
+}
+
+func GetTaskTimeline(c *gin.Context) {
+	taskID, err := strconv.Atoi(c.Param("task_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Ungültige Task-ID"})
+		return
+	}
+
+	timeline := models.TaskTimeline{TaskID: taskID, Entries: []models.TimelineEntry{}}
+
+	rows, err := database.DB.Query(`
+		SELECT id, created_at, length, COALESCE(event, '')
+		FROM code_snapshots
+		WHERE task_id = ?
+		ORDER BY id`, taskID)
+	if err != nil {
+		log.Printf("GetTaskTimeline: snapshot query failed: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Fehler beim Laden der Snapshots"})
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		entry := models.TimelineEntry{Type: "snapshot"}
+		if err := rows.Scan(&entry.Reference, &entry.Time, &entry.Length, &entry.Event); err != nil {
+			log.Printf("DB Scan Error: %v", err)
+			continue
+		}
+		timeline.Entries = append(timeline.Entries, entry)
+	}
+
+	rows, err = database.DB.Query(`
+		SELECT id, created_at, role
+		FROM interactions
+		WHERE task_id = ? AND created_at IS NOT NULL
+		ORDER BY id`, taskID)
+	if err != nil {
+		log.Printf("GetTaskTimeline: interaction query failed: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Fehler beim Laden des Chatverlaufs"})
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		entry := models.TimelineEntry{Type: "interaction"}
+		if err := rows.Scan(&entry.Reference, &entry.Time, &entry.Role); err != nil {
+			log.Printf("DB Scan Error: %v", err)
+			continue
+		}
+		timeline.Entries = append(timeline.Entries, entry)
+	}
+
+	sort.SliceStable(timeline.Entries, func(i, j int) bool {
+		return timeline.Entries[i].Time < timeline.Entries[j].Time
+	})
+
+	timeline.MeasuredTime, err = measuredTimeSpent(taskID)
+	if err != nil {
+		log.Printf("GetTaskTimeline: measured time failed: %v", err)
+	}
+
+	c.JSON(http.StatusOK, timeline)
+}
@@ -0,0 +1,108 @@
+package handlers
+
+import (
+	"api-test/database"
+	"encoding/json"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/jmoiron/sqlx"
+)
+
+func TestDiffCodeRoundTrip(t *testing.T) {
+	tests := []struct {
+		name, old, new string
+	}{
+		{"leer zu Text", "", "print(1)"},
+		{"Text zu leer", "print(1)", ""},
+		{"unverändert", "x = 1\n", "x = 1\n"},
+		{"Einfügen am Anfang", "b = 2\n", "a = 1\nb = 2\n"},
+		{"Einfügen am Ende", "a = 1\n", "a = 1\nb = 2\n"},
+		{"Ersetzen in der Mitte", "a = 1\nb = 2\nc = 3\n", "a = 1\nb = 20\nc = 3\n"},
+		{"Löschen in der Mitte", "a = 1\nb = 2\nc = 3\n", "a = 1\nc = 3\n"},
+		{"Präfix und Suffix überlappen", "aaa", "aaaa"},
+		{"Umlaut ersetzt Umlaut", "print(\"Größe\")", "print(\"Grüße\")"},
+		{"gleiches erstes Byte", "x = \"ä\"", "x = \"ö\""},
+		{"Emoji eingefügt", "s = \"ab\"", "s = \"a😀b\""},
+		{"mehrbyte am Rand", "äöü", "äü"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := diffCode(tt.old, tt.new)
+			if !utf8.ValidString(d.Insert) {
+				t.Errorf("diffCode(%q, %q) zerschneidet ein Zeichen: Insert = %q", tt.old, tt.new, d.Insert)
+			}
+
+			got, err := applyDiff(tt.old, d)
+			if err != nil {
+				t.Fatalf("applyDiff(%q, %+v): %v", tt.old, d, err)
+			}
+			if got != tt.new {
+				t.Errorf("applyDiff(%q, diffCode(%q, %q)) = %q", tt.old, tt.old, tt.new, got)
+			}
+		})
+	}
+}
+
+func TestApplyDiffRejectsInvalidDiff(t *testing.T) {
+	tests := []codeDiff{
+		{Prefix: -1},
+		{Suffix: -1},
+		{Prefix: 3, Suffix: 3},
+	}
+
+	for _, d := range tests {
+		if _, err := applyDiff("abcde", d); err == nil {
+			t.Errorf("applyDiff(%q, %+v) ohne Fehler", "abcde", d)
+		}
+	}
+}
+
+func TestReconstructCode(t *testing.T) {
+	db := sqlx.MustConnect("sqlite3", ":memory:")
+	defer db.Close()
+	db.MustExec(`
+		CREATE TABLE code_snapshots (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			task_id INTEGER NOT NULL,
+			kind TEXT NOT NULL,
+			content TEXT NOT NULL,
+			created_at INTEGER NOT NULL
+		)`)
+
+	previous := database.DB
+	database.DB = db
+	defer func() { database.DB = previous }()
+
+	versions := []string{"", "def f():\n", "def größe():\n    return 1\n", "def größe():\n    return 2\n", "def grüße():\n    return 2\n"}
+	insert := func(kind, content string, at int64) {
+		db.MustExec("INSERT INTO code_snapshots (task_id, kind, content, created_at) VALUES (1, ?, ?, ?)", kind, content, at)
+	}
+	insert("full", versions[1], 10)
+	for i := 2; i < len(versions); i++ {
+		content, _ := json.Marshal(diffCode(versions[i-1], versions[i]))
+		insert("diff", string(content), int64(i*10))
+	}
+
+	tests := []struct {
+		at    int64
+		code  string
+		diffs int
+	}{
+		{5, "", -1},
+		{10, versions[1], 0},
+		{25, versions[2], 1},
+		{40, versions[4], 3},
+	}
+
+	for _, tt := range tests {
+		code, diffs, err := reconstructCode(1, tt.at)
+		if err != nil {
+			t.Fatalf("reconstructCode(1, %d): %v", tt.at, err)
+		}
+		if code != tt.code || diffs != tt.diffs {
+			t.Errorf("reconstructCode(1, %d) = %q, %d; erwartet %q, %d", tt.at, code, diffs, tt.code, tt.diffs)
+		}
+	}
+}
@@ -3,24 +3,44 @@ package handlers
 import (
 	"api-test/database"
 	"api-test/models"
+	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"math"
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
-func GenerateTask(c *gin.Context) {
-	var req models.TaskRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-		return
+const maxGenerationAttempts = 3
+
+var errAIResponseFormat = errors.New("KI-Antwort nicht lesbar")
+
+func generateTaskCandidate(req models.TaskRequest, avoid []string) (models.TaskResponse, error) {
+	var taskResponse models.TaskResponse
+
+	typeName, t, err := validateTaskType(req.TaskType, req.MultiFile)
+	if err != nil {
+		return taskResponse, err
 	}
 
-	log.Printf("%+v\n", req)
+	avoidInstruction := ""
+	if len(avoid) > 0 {
+		avoidInstruction = "- Die Aufgabe darf sich inhaltlich NICHT mit folgenden, bereits gestellten Aufgaben überschneiden (anderes Szenario, anderer Algorithmus):\n"
+		for _, a := range avoid {
+			avoidInstruction += fmt.Sprintf("  * %q\n", truncate(a, 300))
+		}
+	}
+
+	fileInstruction := "- Stelle sicher, dass die Aufgabe in einer einzigen Datei lösbar ist."
+	if req.MultiFile {
+		fileInstruction = fmt.Sprintf("- Die Aufgabe soll mehrere Dateien umfassen (z. B. ein kleines Paket mit Tests oder ein Hauptprogramm mit Hilfsmodul), höchstens %d. Nenne die erwarteten Dateien in der Aufgabenstellung.", maxGeneratedFiles)
+	}
 
 	prompt := fmt.Sprintf(`
 Goal:
@@ -41,33 +61,145 @@ Return Format:
 Instructions:
 - Verwende für den Einstieg kreative Kontexte, damit sich Aufgaben unterschiedlich anfühlen.
 - Stelle sicher, dass die Aufgabe nur mit Standardbibliotheken lösbar ist.
-- Stelle sicher, dass die Aufgabe in einer einzigen Datei lösbar ist.
+%s
 - Wann immer möglich, soll ein bestimmter, dem Schwierigkeitsgrad entsprechender Algorithmus abgefragt werden.
+- Ist ein Thema angegeben, muss die Aufgabe dieses Thema behandeln.
 - Gib realistische und nicht überzogene Zeitschätzungen an. Die Zeitschätzung darf auf keinen Fall 0 sein!
-
+%s
 Context Dump:
 - Programmiersprache: "%s";
 - Schwierigkeitsgrad: "%s";
+- Thema: "%s";
 - Zusätzliche Anmerkungen: "%s"
-`, req.Language, req.Level, req.Comment)
+`, fileInstruction, avoidInstruction, req.Language, req.Level, req.Topic, req.Comment)
+
+	if t.Generation != "" {
+		prompt += "\nAufgabentyp:\n" + t.Generation + "\n"
+	}
+	if t.Code {
+		prompt += "\nMusterlösung:\n" + referenceInstruction(req.MultiFile) + "\n"
+	}
 
 	response, err := GetAIResponse(prompt)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Fehler beim Kontaktieren der KI"})
-		return
+		return taskResponse, err
 	}
 
 	jsonString, err := CleanAndExtractJSON(response)
 	if err != nil {
 		log.Printf("Fehler beim Extrahieren von JSON: %v\nOriginal: %s\n", err, response)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Fehler beim Parsen der KI-Antwort"})
-		return
+		return taskResponse, fmt.Errorf("%w: %v", errAIResponseFormat, err)
 	}
 
-	var taskResponse models.TaskResponse
-	if err := json.Unmarshal([]byte(jsonString), &taskResponse); err != nil {
+	// Lösungsschlüssel und Musterlösung werden nie an den Client ausgegeben und deshalb
+	// hier separat gelesen.
+	var generated struct {
+		models.TaskResponse
+		AnswerKey string `json:"answer_key"`
+		Reference string `json:"reference_solution"`
+	}
+	if err := json.Unmarshal([]byte(jsonString), &generated); err != nil {
 		log.Printf("json.Unmarshal-Fehler: %v\nBereinigtes JSON: %s\n", err, jsonString)
+		return taskResponse, fmt.Errorf("%w: %v", errAIResponseFormat, err)
+	}
+	taskResponse = generated.TaskResponse
+	taskResponse.AnswerKey = generated.AnswerKey
+	if t.Code {
+		taskResponse.Reference = generated.Reference
+	}
+
+	if t.Starter && strings.TrimSpace(taskResponse.StarterCode) == "" {
+		return taskResponse, fmt.Errorf("%w: Ausgangscode fehlt", errAIResponseFormat)
+	}
+	if typeName == taskTypeWrite {
+		taskResponse.AnswerKey = ""
+		if err := validateScaffold(taskResponse.StarterCode, taskResponse.EntryPoints); err != nil {
+			return taskResponse, fmt.Errorf("%w: %v", errAIResponseFormat, err)
+		}
+	} else {
+		taskResponse.EntryPoints = nil
+	}
+
+	taskResponse.Topic = req.Topic
+	taskResponse.MultiFile = req.MultiFile
+	taskResponse.TaskType = typeName
+
+	return taskResponse, nil
+}
+
+// generateDistinctTask generiert eine Aufgabe und wiederholt die Generierung, solange
+// sie den bisherigen Aufgaben des Users zu ähnlich ist. Zurückgegeben wird der Kandidat
+// mit der geringsten Ähnlichkeit.
+func generateDistinctTask(req models.TaskRequest) (models.TaskResponse, error) {
+	var taskResponse models.TaskResponse
+	var avoid []string
+	found := false
+
+	for attempt := 1; attempt <= maxGenerationAttempts; attempt++ {
+		candidate, err := generateTaskCandidate(req, avoid)
+		if err != nil {
+			if found {
+				break
+			}
+			return taskResponse, err
+		}
+
+		score, similar, err := mostSimilarTask(req.UserID, req.Language, candidate.Task, true)
+		if err != nil {
+			log.Printf("generateDistinctTask: similarity check failed: %v", err)
+		}
+		candidate.Similarity = score
+
+		if !found || candidate.Similarity < taskResponse.Similarity {
+			taskResponse = candidate
+			found = true
+		}
+
+		if score < similarityThreshold {
+			break
+		}
+
+		log.Printf("generateDistinctTask: Versuch %d zu ähnlich (%.2f), generiere neu", attempt, score)
+		avoid = append(avoid, similar)
+	}
+
+	return taskResponse, nil
+}
+
+func respondGenerationError(c *gin.Context, err error) {
+	if errors.Is(err, errAIResponseFormat) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Fehler beim Parsen der KI-Antwort"})
+	} else {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Fehler beim Kontaktieren der KI"})
+	}
+}
+
+func GenerateTask(c *gin.Context) {
+	var req models.TaskRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	req.UserID, _ = currentUser(c)
+
+	log.Printf("%+v\n", req)
+
+	typeName, _, err := validateTaskType(req.TaskType, req.MultiFile)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	req.TaskType = typeName
+
+	taskResponse, err := generateDistinctTask(req)
+	if err != nil {
+		respondGenerationError(c, err)
+		return
+	}
+
+	if err := storeGeneratedTask(req.UserID, &taskResponse); err != nil {
+		log.Printf("GenerateTask: storeGeneratedTask failed: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Fehler beim Speichern der Aufgabe"})
 		return
 	}
 
@@ -76,6 +208,49 @@ Context Dump:
 	c.JSON(http.StatusOK, taskResponse)
 }
 
+// referenceInstruction fordert bei Aufgaben mit Code als Abgabe eine Musterlösung an. Sie
+// entsteht vor jeder Abgabe und dient deshalb als unbeeinflusster Vergleich für die
+// Plagiatsprüfung und die Schätzung der KI-Nutzung.
+func referenceInstruction(multiFile bool) string {
+	instruction := `- Ergänze das JSON um "reference_solution": "<vollständige, lauffähige Musterlösung>".`
+	if multiFile {
+		instruction += fmt.Sprintf(` Bei mehreren Dateien beginnt jede Datei mit der Kopfzeile "%s<Pfad>%s".`,
+			fileHeaderStart, fileHeaderEnd)
+	}
+	return instruction
+}
+
+// Eine generierte Aufgabe wartet so lange auf das Speichern. Bis dahin liegen Ausgangscode,
+// Lösungsschlüssel und Musterlösung nur auf dem Server.
+const generatedTaskLifetime = 24 * time.Hour
+
+// storeGeneratedTask legt die typspezifischen Teile einer generierten Aufgabe ab. Der
+// Client erhält die generation_id und den Ausgangscode, aber nie Lösungsschlüssel oder
+// Musterlösung.
+func storeGeneratedTask(userID int, task *models.TaskResponse) error {
+	now := time.Now()
+	if _, err := database.DB.Exec("DELETE FROM generated_tasks WHERE created_at <= ?", now.Add(-generatedTaskLifetime).UnixMilli()); err != nil {
+		log.Printf("DB Error (generated task cleanup): %v", err)
+	}
+
+	entryPoints, _ := json.Marshal(task.EntryPoints)
+	res, err := database.DB.Exec(`
+		INSERT INTO generated_tasks (user_id, task_type, multi_file, starter_code, answer_key, entry_points,
+			reference_solution, created_at)
+		VALUES (?, ?, ?, NULLIF(?, ''), NULLIF(?, ''), NULLIF(?, 'null'), NULLIF(?, ''), ?)
+	`, userID, task.TaskType, task.MultiFile, task.StarterCode, task.AnswerKey, string(entryPoints),
+		task.Reference, now.UnixMilli())
+	if err != nil {
+		return err
+	}
+
+	task.GenerationID, err = res.LastInsertId()
+	return err
+}
+
+// SaveTask speichert eine Aufgabe. Typ, Ausgangscode, Lösungsschlüssel, Musterlösung und Signaturen
+// stammen aus der generierten Aufgabe zu generation_id, nie aus dem Request. Ohne
+// generation_id entsteht eine einfache Programmieraufgabe.
 func SaveTask(c *gin.Context) {
 	var req models.TaskSaveRequest
 
@@ -85,15 +260,48 @@ func SaveTask(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	req.UserID, _ = currentUser(c)
 
-	res, err := database.DB.Exec(`
-		INSERT INTO tasks (user_id, description, language, level, time_estimated)
-		VALUES (?, ?, ?, ?, ?)
-	`, req.UserID, req.Description, strings.ToLower(req.Language), req.Level, req.TimeEstimation)
+	similarity, _, err := mostSimilarTask(req.UserID, req.Language, req.Description, true)
+	if err != nil {
+		log.Printf("SaveTask: similarity check failed: %v", err)
+	}
+
+	tx, err := database.DB.Beginx()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Fehler beim Speichern der Aufgabe"})
+		return
+	}
+	defer tx.Rollback()
+
+	var res sql.Result
+	if req.GenerationID == 0 {
+		res, err = tx.Exec(`
+			INSERT INTO tasks (user_id, description, language, level, time_estimated, time_limit, similarity, topic, multi_file, task_type)
+			VALUES (?, ?, ?, ?, ?, NULLIF(?, 0), ?, NULLIF(?, ''), ?, ?)
+		`, req.UserID, req.Description, strings.ToLower(req.Language), req.Level, req.TimeEstimation, req.TimeLimit, similarity,
+			strings.ToLower(strings.TrimSpace(req.Topic)), req.MultiFile, taskTypeWrite)
+	} else {
+		res, err = tx.Exec(`
+			INSERT INTO tasks (user_id, description, language, level, time_estimated, time_limit, similarity, topic, multi_file,
+				task_type, starter_code, answer_key, entry_points, reference_solution)
+			SELECT ?, ?, ?, ?, ?, NULLIF(?, 0), ?, NULLIF(?, ''), multi_file, task_type, starter_code, answer_key, entry_points,
+				reference_solution
+			FROM generated_tasks
+			WHERE id = ? AND user_id = ? AND created_at > ?
+		`, req.UserID, req.Description, strings.ToLower(req.Language), req.Level, req.TimeEstimation, req.TimeLimit, similarity,
+			strings.ToLower(strings.TrimSpace(req.Topic)), req.GenerationID, req.UserID,
+			time.Now().Add(-generatedTaskLifetime).UnixMilli())
+	}
 	if err != nil {
+		log.Printf("DB Error (task save): %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Fehler beim Speichern der Aufgabe"})
 		return
 	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Generierte Aufgabe nicht gefunden oder abgelaufen"})
+		return
+	}
 
 	taskID, err := res.LastInsertId()
 	if err != nil {
@@ -101,29 +309,63 @@ func SaveTask(c *gin.Context) {
 		return
 	}
 
+	if _, err := tx.Exec("DELETE FROM generated_tasks WHERE id = ?", req.GenerationID); err != nil {
+		log.Printf("DB Error (generated task): %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Fehler beim Speichern der Aufgabe"})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Fehler beim Speichern der Aufgabe"})
+		return
+	}
+
 	c.JSON(http.StatusOK, gin.H{
 		"task_id": taskID,
 		"message": "Aufgabe erfolgreich gespeichert",
 	})
 }
 
-func EvaluateTask(c *gin.Context) {
-	var req models.TaskEvaluationRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-		return
-	}
+type evaluationInput struct {
+	Task          string
+	Code          string
+	Level         string
+	Language      string
+	UseAI         bool
+	TimeEstimated int
+	TimeSpent     int
+	Model         string
+	Temperature   float32
+	Prompt        string
+	AIReliance    *float64
+	Analysis      *models.CodeAnalysis
+	Type          string
+	Starter       string
+	AnswerKey     string
+	EntryPoints   []string
+	Tests         string
+}
 
-	log.Printf("%+v\n", req)
+func compareTime(timeSpent, timeEstimated int) string {
+	if timeEstimated <= 0 {
+		return "keine Zeitschätzung vorhanden"
+	}
 
-	useAI := ""
-	if req.UseAI {
-		useAI = "ja"
-	} else {
-		useAI = "nein"
+	ratio := float64(timeSpent) / float64(timeEstimated*60)
+	switch {
+	case ratio < 0.5:
+		return "zu schnell"
+	case ratio > 1.5:
+		return "zu langsam"
+	default:
+		return "realistisch"
 	}
+}
 
-	prompt := fmt.Sprintf(`
+// evaluationPrompt ist die Vorlage für die Bewertung. Die Platzhalter werden in dieser
+// Reihenfolge gefüllt: Aufgabe, Code, Level, Sprache, KI-Nutzung, geschätzte Minuten,
+// gemessene Sekunden, Zeitvergleich.
+const evaluationPrompt = `
 Goal:
 Bewerte die eingereichte Lösung zu folgender Aufgabe.
 
@@ -134,14 +376,14 @@ Return Format:
 - Gib am Ende einen kurzen Verbesserungsvorschlag ("Tipp") – maximal ein Satz.
 - Vergib eine Schulnote von 1,0 (sehr gut) bis 6,0 (ungenügend). Schritte von 0,1 sind möglich.
 - Begründe in der Bewertung, weshalb du diese Note vergeben hast.
-- Vergleich zwischen geschätzter Zeit und benötigter Zeit (realistisch, zu schnell, zu langsam).
+- Kommentiere den vorgegebenen Zeitvergleich in einem Satz, ohne ihn zu ändern.
 - Generiere eine mögliche und gültige Lösung, die als Code ausführbar ist.
 - Gib keine Code-Fences an.
 - Exaktes JSON-Format (zwingend im JSON-Format, keine illegalen Zeichen, keinerlei zusätzlichen Text!):
 {
   "rating": "<Bewertung mit Hinweis und Verbesserungsvorschlag>",
   "mark": "<Schulnote: x,y>",
-  "time_comparison": <Vergleich der Zeiten>,
+  "time_comparison": "<Kommentar zum Zeitvergleich>",
   "solution": <generierte Lösung>
 }
 
@@ -149,6 +391,7 @@ Warnings:
 - Gib objektive und realistische Bewertungen.
 - Beachte den Schwierigkeitsgrad (super-easy bis super-hard).
 - Wenn die eingereichte Lösung einer Musterlösung entspricht muss die Note mindestens eine 1,3 sein.
+- Der Zeitvergleich wurde vom Server gemessen und ist verbindlich.
 
 Context Dump:
 - Aufgabe: "%s";
@@ -156,14 +399,55 @@ Context Dump:
 - Level: "%s";
 - Sprache: "%s";
 - KI-Nutzung: "%s";
-- Zeitangabe: %d Sekunden;
-- Tatsächlich benötigte Zeit: %d Sekunden
-`, req.Task, req.Code, req.Level, req.Language, useAI, req.TimeEstimation, req.TimeSpent)
+- Geschätzte Zeit: %d Minuten;
+- Tatsächlich benötigte Zeit (serverseitig gemessen): %d Sekunden;
+- Zeitvergleich: "%s"
+`
 
-	response, err := GetAIResponse(prompt)
+func evaluateSolution(in evaluationInput) (models.TaskEvaluation, float64, error) {
+	var evalResponse models.TaskEvaluation
+
+	if t, ok := taskTypes[in.Type]; ok && t.Grade != nil {
+		if eval, mark, graded := t.Grade(in); graded {
+			return eval, mark, nil
+		}
+	}
+
+	useAI := ""
+	if in.UseAI {
+		useAI = "ja"
+	} else {
+		useAI = "nein"
+	}
+	if in.AIReliance != nil {
+		useAI = fmt.Sprintf("%s (Selbstauskunft); serverseitig geschätzter Anteil aus Tutor-Antworten und eingefügtem Code: %.0f %%",
+			useAI, *in.AIReliance*100)
+	}
+
+	timeComparison := compareTime(in.TimeSpent, in.TimeEstimated)
+
+	template := evaluationPrompt
+	if in.Prompt != "" {
+		template = in.Prompt
+	}
+
+	prompt := fmt.Sprintf(template, in.Task, in.Code, in.Level, in.Language, useAI, in.TimeEstimated, in.TimeSpent, timeComparison)
+
+	prompt += typeFacts(in)
+
+	if in.Analysis != nil {
+		prompt += analysisFacts(*in.Analysis)
+	}
+
+	var response string
+	var err error
+	if in.Model != "" {
+		response, err = GetAIResponseWith(in.Model, in.Temperature, prompt)
+	} else {
+		response, err = GetAIResponse(prompt)
+	}
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Fehler bei KI-Anfrage"})
-		return
+		return evalResponse, 0, fmt.Errorf("KI-Anfrage fehlgeschlagen: %w", err)
 	}
 
 	log.Println(response)
@@ -171,42 +455,260 @@ Context Dump:
 	jsonString, err := CleanAndExtractJSON(response)
 	if err != nil {
 		log.Printf("Fehler beim Extrahieren von JSON: %v\nOriginal: %s\n", err, response)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Fehler beim Parsen der KI-Antwort"})
-		return
+		return evalResponse, 0, err
 	}
 
-	var evalResponse models.TaskEvaluation
 	if err := json.Unmarshal([]byte(jsonString), &evalResponse); err != nil {
 		log.Printf("json.Unmarshal-Fehler: %v\nBereinigtes JSON: %s\n", err, jsonString)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Fehler beim Parsen der KI-Antwort"})
-		return
+		return evalResponse, 0, err
 	}
 
 	markStr := strings.Replace(evalResponse.Mark, ",", ".", 1)
 	mark, err := strconv.ParseFloat(markStr, 64)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Fehler beim konvertieren der Note"})
-		return
+		return evalResponse, 0, fmt.Errorf("Note %q nicht lesbar: %w", evalResponse.Mark, err)
+	}
+
+	if evalResponse.TimeComparison != "" {
+		evalResponse.TimeComparison = timeComparison + " – " + evalResponse.TimeComparison
+	} else {
+		evalResponse.TimeComparison = timeComparison
 	}
 
-	_, err = database.DB.Exec(`
-		INSERT INTO solutions (task_id, code, rating, mark, ai_usage, time_spent)
-		VALUES (?, ?, ?, ?, ?, ?)
+	return evalResponse, mark, nil
+}
+
+func formatMark(mark float64) string {
+	return strings.Replace(strconv.FormatFloat(mark, 'f', 1, 64), ".", ",", 1)
+}
+
+// applyLatePenalty verschlechtert die Note um den Verspätungsabzug, höchstens bis 6,0.
+func applyLatePenalty(evalResponse *models.TaskEvaluation, mark, penalty float64) float64 {
+	if penalty <= 0 {
+		return mark
+	}
+
+	final := math.Min(6, math.Round((mark+penalty)*10)/10)
+	evalResponse.Mark = formatMark(final)
+	evalResponse.LatePenalty = penalty
+	return final
+}
+
+func saveSolution(taskID int, code string, files []models.CodeFile, result evaluationConsensus, mark float64, useAI bool, timeSpent int) error {
+	evalResponse := result.Eval
+
+	var relianceScore, tutorOverlap, pasteOverlap, referenceOverlap *float64
+	if r := evalResponse.AIReliance; r != nil {
+		relianceScore, tutorOverlap, pasteOverlap, referenceOverlap = &r.Score, &r.Tutor, &r.Paste, r.Reference
+	}
+
+	tx, err := database.DB.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec(`
+		INSERT INTO solutions (task_id, code, rating, mark, ai_usage, time_spent, raw_mark, late_penalty, created_at, ai_mark,
+			samples, mark_spread, confidence, needs_review, reference_solution,
+			ai_reliance, tutor_overlap, paste_overlap, reference_overlap)
+		VALUES (?, ?, ?, ?, ?, ?, ?, NULLIF(?, 0), ?, ?, ?, ?, ?, ?, NULLIF(?, ''), ?, ?, ?, ?)
 	`,
-		req.TaskID,
-		req.Code,
+		taskID,
+		code,
 		evalResponse.Rating,
 		mark,
-		req.UseAI,
-		req.TimeSpent,
+		useAI,
+		timeSpent,
+		result.Mark,
+		evalResponse.LatePenalty,
+		time.Now().UnixMilli(),
+		result.Mark,
+		evalResponse.Samples,
+		evalResponse.Spread,
+		evalResponse.Confidence,
+		evalResponse.NeedsReview,
+		evalResponse.Solution,
+		relianceScore,
+		tutorOverlap,
+		pasteOverlap,
+		referenceOverlap,
 	)
+	if err != nil {
+		return err
+	}
+
+	solutionID, err := res.LastInsertId()
+	if err != nil {
+		return err
+	}
+
+	for _, sample := range result.Samples {
+		_, err := tx.Exec("INSERT INTO evaluation_samples (solution_id, model, mark) VALUES (?, ?, ?)",
+			solutionID, sample.Model, sample.Mark)
+		if err != nil {
+			return fmt.Errorf("evaluation sample insert failed: %w", err)
+		}
+	}
+
+	if err := updateSkillRatings(tx, solutionID); err != nil {
+		return fmt.Errorf("updateSkillRatings failed: %w", err)
+	}
+
+	if err := updateReviewQueue(tx, solutionID); err != nil {
+		return fmt.Errorf("updateReviewQueue failed: %w", err)
+	}
+
+	if err := saveSolutionFiles(tx, solutionID, files); err != nil {
+		return fmt.Errorf("saveSolutionFiles failed: %w", err)
+	}
+
+	if err := saveDiagnostics(tx, solutionID, evalResponse.Analysis); err != nil {
+		return fmt.Errorf("saveDiagnostics failed: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	// Der Ähnlichkeitsvergleich liest andere Lösungen und gehört nicht zur Abgabe selbst.
+	if err := checkSimilarity(solutionID); err != nil {
+		log.Printf("saveSolution: checkSimilarity failed: %v", err)
+	}
+
+	return nil
+}
+
+// evaluationTask enthält die gespeicherten Angaben zur Aufgabe, nach denen bewertet wird.
+type evaluationTask struct {
+	Description   string `db:"description"`
+	Language      string `db:"language"`
+	Level         string `db:"level"`
+	TimeEstimated int    `db:"time_estimated"`
+	MultiFile     bool   `db:"multi_file"`
+	taskTypeInfo
+}
+
+func loadEvaluationTask(taskID int) (evaluationTask, error) {
+	var task evaluationTask
+	err := database.DB.Get(&task, `
+		SELECT description, COALESCE(language, '') AS language, COALESCE(level, '') AS level,
+			COALESCE(time_estimated, 0) AS time_estimated, multi_file, `+taskTypeColumns+`
+		FROM tasks WHERE id = ?`, taskID)
+	return task, err
+}
+
+func EvaluateTask(c *gin.Context) {
+	var req models.TaskEvaluationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	req.UserID, _ = currentUser(c)
+	if !ownTask(c, req.TaskID) {
+		return
+	}
+
+	log.Printf("%+v\n", req)
+
+	code, files, err := submittedCode(req.Code, req.Files)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	req.Code = code
+
+	task, err := loadEvaluationTask(req.TaskID)
+	if err != nil {
+		log.Printf("EvaluateTask: loadEvaluationTask failed: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Fehler beim Abrufen der Aufgabe"})
+		return
+	}
+
+	assignment, err := loadTaskAssignment(req.TaskID)
+	if err != nil {
+		log.Printf("EvaluateTask: loadTaskAssignment failed: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Fehler beim Abrufen der Aufgabe"})
+		return
+	}
+
+	penalty := 0.0
+	if assignment != nil {
+		penalty, err = checkSubmission(*assignment, req.TaskID, req.UseAI, time.Now().UnixMilli())
+		if err != nil {
+			respondSubmissionError(c, err)
+			return
+		}
+		if err := reserveSubmission(*assignment, req.TaskID); err != nil {
+			respondSubmissionError(c, err)
+			return
+		}
+		defer releaseSubmission(req.TaskID)
+	}
+
+	timeSpent, err := submitSession(req.TaskID, req.UserID)
+	if errors.Is(err, errSessionAbandoned) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Aufgabe wurde abgebrochen"})
+		return
+	}
+	if errors.Is(err, errSessionSubmitted) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Aufgabe wurde bereits abgegeben"})
+		return
+	}
+	if err != nil {
+		log.Printf("EvaluateTask: submitSession failed: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Fehler beim Abschließen der Sitzung"})
+		return
+	}
+
+	settings, err := evaluationSettingsFor(req.TaskID)
+	if err != nil {
+		log.Printf("EvaluateTask: evaluationSettingsFor failed: %v", err)
+		reopenSession(req.TaskID)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Fehler beim Abrufen der Bewertungseinstellungen"})
+		return
+	}
+
+	analysis := analyzeSubmission(req.Code, files, task.Language, task.Type)
+
+	reliance := loadRelianceSources(req.TaskID, req.Code, task.Language, task.Starter, task.Reference)
+
+	result, err := consensusEvaluate(evaluationInput{
+		Task:          task.Description,
+		Code:          req.Code,
+		Level:         task.Level,
+		Language:      task.Language,
+		UseAI:         req.UseAI,
+		TimeEstimated: task.TimeEstimated,
+		TimeSpent:     timeSpent,
+		AIReliance:    reliance.estimate(),
+		Analysis:      analysis,
+		Type:          task.Type,
+		Starter:       task.Starter,
+		AnswerKey:     task.AnswerKey,
+		EntryPoints:   task.entryPoints(),
+		Tests:         task.Tests,
+	}, settings)
+	if err != nil {
+		log.Printf("EvaluateTask: %v", err)
+		reopenSession(req.TaskID)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Fehler bei der KI-Bewertung"})
+		return
+	}
+
+	reliance.attach(&result.Eval)
+	result.Eval.Analysis = analysis
+
+	finalMark := applyLatePenalty(&result.Eval, result.Mark, penalty)
+	err = saveSolution(req.TaskID, req.Code, files, result, finalMark, req.UseAI, timeSpent)
 
-	log.Printf("%+v\n", evalResponse)
+	log.Printf("%+v\n", result.Eval)
 
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Fehler beim Speichern der User-Nachricht"})
+		reopenSession(req.TaskID)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Fehler beim Speichern der Lösung"})
 		return
 	}
 
-	c.JSON(http.StatusOK, evalResponse)
+	c.JSON(http.StatusOK, result.Eval)
 }
@@ -0,0 +1,272 @@
+package handlers
+
+import (
+	"api-test/models"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	taskTypeWrite         = "write"
+	taskTypeDebug         = "debug"
+	taskTypeReview        = "review"
+	taskTypeFillBlanks    = "fill_blanks"
+	taskTypePredictOutput = "predict_output"
+	taskTypeRefactor      = "refactor"
+	blankMarker           = "___"
+	maxEntryPoints        = 10
+)
+
+// taskType beschreibt eine Aufgabenart. Generation ergänzt den Generierungsprompt,
+// Evaluation den Bewertungsprompt. Bei Typen mit Starter liefert die KI zusätzlich einen
+// Ausgangscode und einen Lösungsschlüssel, die mit der Aufgabe gespeichert werden. Code
+// gibt an, ob die Abgabe Programmcode ist und statisch analysiert werden kann. Grade
+// bewertet ohne KI, wenn der Typ eine eindeutige Antwort hat. Programmieraufgaben erhalten
+// statt eines Lösungsschlüssels ein Gerüst mit den Signaturen, die die Abgabe bereitstellen muss.
+type taskType struct {
+	Label      string
+	Generation string
+	Evaluation string
+	Starter    bool
+	Code       bool
+	Grade      func(in evaluationInput) (models.TaskEvaluation, float64, bool)
+}
+
+var taskTypeOrder = []string{taskTypeWrite, taskTypeDebug, taskTypeReview, taskTypeFillBlanks, taskTypePredictOutput, taskTypeRefactor}
+
+var taskTypes = map[string]taskType{
+	taskTypeWrite: {
+		Label: "Programm schreiben",
+		Generation: `- Lege die Schnittstelle fest: Die Aufgabe wird über eine oder mehrere Funktionen (bzw. Methoden) mit festen Signaturen gelöst.
+  Nenne Eingabe und Ausgabe mit einem Beispiel in der Aufgabenstellung.
+- Schreibe ein Gerüst in der Konvention der Sprache: die geforderten Signaturen mit Docstring bzw. Doc-Kommentar und leerem
+  Rumpf (TODO, ggf. ein Platzhalter-Rückgabewert, damit der Code kompiliert), dazu ein kleines Beispiel-Harness
+  (z. B. main-Funktion oder if __name__ == "__main__":), das die Funktionen mit dem Beispiel aufruft und das Ergebnis ausgibt.
+- Bei mehreren Dateien trenne die Dateien im Gerüst mit Kopfzeilen der Form "` + fileHeaderStart + `<Pfad>` + fileHeaderEnd + `".
+- Ergänze das JSON um "starter_code": "<Gerüst>" und "entry_points": ["<Signatur genau wie im Gerüst>", ...].`,
+		Code: true,
+	},
+	taskTypeDebug: {
+		Label: "Fehlersuche",
+		Generation: `- Aufgabentyp Fehlersuche: Schreibe ein vollständiges Programm zur Aufgabe und baue 2 bis 4 Fehler ein
+  (z. B. Off-by-one, falsche Bedingung, vertauschte Variablen, fehlender Sonderfall). Das Programm muss kompilieren.
+- Die Aufgabenstellung beschreibt das gewünschte Verhalten und dass der Code Fehler enthält, verrät die Fehler aber nicht.
+- Ergänze das JSON um "starter_code": "<fehlerhafter Code>" und "answer_key": "<Liste der Fehler mit Zeile und Korrektur>".`,
+		Evaluation: `- Aufgabentyp Fehlersuche: Die Abgabe ist der korrigierte Ausgangscode. Prüfe für jeden Fehler im
+  Lösungsschlüssel, ob er behoben wurde, und ob neue Fehler entstanden sind. Umbauten über die Korrektur hinaus sind
+  nicht nötig. Gib als "solution" den vollständig korrigierten Code an.`,
+		Starter: true,
+		Code:    true,
+	},
+	taskTypeReview: {
+		Label: "Code-Review",
+		Generation: `- Aufgabentyp Code-Review: Schreibe einen funktionierenden Codeausschnitt (20 bis 60 Zeilen) mit 3 bis 6 Schwächen
+  (z. B. Benennung, Duplikation, fehlende Fehlerbehandlung, Sicherheitslücke, ineffizienter Algorithmus).
+- Die Aufgabenstellung fordert auf, den Code zu begutachten und Anmerkungen in der Form "Zeile N: Anmerkung" zu schreiben.
+- Ergänze das JSON um "starter_code": "<zu begutachtender Code>" und "answer_key": "<Liste der Schwächen mit Zeile>".`,
+		Evaluation: `- Aufgabentyp Code-Review: Die Abgabe besteht aus Anmerkungen zum Ausgangscode, nicht aus Code. Bewerte, wie viele
+  Schwächen aus dem Lösungsschlüssel gefunden wurden, ob die Anmerkungen zutreffen und ob sie konkrete Verbesserungen
+  vorschlagen. Berechtigte Anmerkungen, die nicht im Schlüssel stehen, zählen ebenfalls.
+  Gib als "solution" ein vollständiges Musterreview an.`,
+		Starter: true,
+	},
+	taskTypeFillBlanks: {
+		Label: "Lückentext",
+		Generation: `- Aufgabentyp Lückentext: Schreibe ein vollständiges Programm zur Aufgabe und ersetze 3 bis 6 wesentliche Stellen
+  (Bedingungen, Schleifenköpfe, Ausdrücke) durch ` + blankMarker + `. Jede Lücke umfasst höchstens eine Zeile.
+- Ergänze das JSON um "starter_code": "<Code mit Lücken>" und "answer_key": "<Inhalt der Lücken in Reihenfolge, eine Zeile je Lücke>".`,
+		Evaluation: `- Aufgabentyp Lückentext: Die Abgabe ist der Ausgangscode mit gefüllten Lücken (` + blankMarker + `). Bewerte jede Lücke
+  einzeln. Abweichungen vom Lösungsschlüssel sind richtig, wenn sie das gleiche Verhalten haben. Der übrige Code sollte
+  unverändert bleiben. Gib als "solution" den Code mit dem Lösungsschlüssel an.`,
+		Starter: true,
+		Code:    true,
+	},
+	taskTypePredictOutput: {
+		Label: "Ausgabe vorhersagen",
+		Generation: `- Aufgabentyp Ausgabe vorhersagen: Schreibe ein kurzes Programm ohne Eingaben, Zufall oder Zeitabhängigkeit, dessen
+  Ausgabe sich durch sorgfältiges Lesen bestimmen lässt (höchstens 10 Ausgabezeilen).
+- Die Aufgabenstellung fordert auf, die exakte Ausgabe anzugeben.
+- Ergänze das JSON um "starter_code": "<Programm>" und "answer_key": "<exakte Ausgabe>".`,
+		Evaluation: `- Aufgabentyp Ausgabe vorhersagen: Die Abgabe ist die vorhergesagte Ausgabe des Ausgangscodes. Der
+  Lösungsschlüssel wurde nicht ausgeführt und kann falsch sein: Bestimme die Ausgabe selbst Zeile für Zeile aus dem
+  Ausgangscode und vergleiche die Abgabe zeilenweise damit. Gib als "solution" die exakte Ausgabe an.`,
+		Starter: true,
+		Grade:   gradePredictedOutput,
+	},
+	taskTypeRefactor: {
+		Label: "Refactoring",
+		Generation: `- Aufgabentyp Refactoring: Schreibe ein korrekt funktionierendes, aber schwer lesbares Programm (lange Funktionen,
+  Duplikation, magische Zahlen, unklare Namen).
+- Die Aufgabenstellung fordert auf, den Code zu verbessern, ohne sein Verhalten zu ändern.
+- Ergänze das JSON um "starter_code": "<Ausgangscode>" und "answer_key": "<Liste der Schwächen und das zu erhaltende Verhalten>".`,
+		Evaluation: `- Aufgabentyp Refactoring: Die Abgabe ist der überarbeitete Ausgangscode. Das Verhalten muss unverändert bleiben,
+  eine Verhaltensänderung ist ein schwerer Fehler. Bewerte, welche Schwächen aus dem Lösungsschlüssel behoben wurden
+  und ob der Code lesbarer geworden ist. Gib als "solution" eine überarbeitete Fassung an.`,
+		Starter: true,
+		Code:    true,
+	},
+}
+
+// validateTaskType prüft Typ, Ausgangscode und Mehrdateimodus einer Aufgabe und liefert
+// den Typ mit dem Standard für Programmieraufgaben.
+func validateTaskType(name string, multiFile bool) (string, taskType, error) {
+	if name == "" {
+		name = taskTypeWrite
+	}
+
+	t, ok := taskTypes[name]
+	if !ok {
+		return name, t, fmt.Errorf("Ungültiger Aufgabentyp %q", name)
+	}
+	if multiFile && name != taskTypeWrite {
+		return name, t, fmt.Errorf("Mehrere Dateien sind nur bei Programmieraufgaben möglich")
+	}
+	return name, t, nil
+}
+
+var entryPointName = regexp.MustCompile(`([A-Za-z_]\w*)\s*\(`)
+
+// validateScaffold prüft, ob jede Signatur eine Funktion benennt, die im Gerüst vorkommt.
+// Der Name ist der erste Bezeichner vor einer Klammer, der kein Schlüsselwort wie func
+// oder def ist; so werden auch Go-Methoden mit Empfänger erkannt.
+func validateScaffold(starter string, entryPoints []string) error {
+	if len(entryPoints) > maxEntryPoints {
+		return fmt.Errorf("Höchstens %d Signaturen erlaubt", maxEntryPoints)
+	}
+	if len(entryPoints) > 0 && strings.TrimSpace(starter) == "" {
+		return fmt.Errorf("Signaturen ohne Gerüst")
+	}
+
+	for _, e := range entryPoints {
+		name := ""
+		for _, m := range entryPointName.FindAllStringSubmatch(e, -1) {
+			if !slices.Contains([]string{"func", "def", "function", "fn", "fun"}, m[1]) {
+				name = m[1]
+				break
+			}
+		}
+		if name == "" {
+			return fmt.Errorf("Signatur %q ohne Funktionsnamen", e)
+		}
+		if !regexp.MustCompile(`\b` + name + `\s*\(`).MatchString(starter) {
+			return fmt.Errorf("Signatur %q fehlt im Gerüst", e)
+		}
+	}
+	return nil
+}
+
+// typeFacts beschreibt Typ, Ausgangscode und Lösungsschlüssel für den Bewertungsprompt,
+// bei Programmieraufgaben die vorgegebenen Signaturen und Tests.
+func typeFacts(in evaluationInput) string {
+	t, ok := taskTypes[in.Type]
+	if ok && in.Type == taskTypeWrite {
+		facts := ""
+		if len(in.EntryPoints) > 0 {
+			facts += fmt.Sprintf("- Die Lösung muss diese vorgegebenen Signaturen unverändert bereitstellen, "+
+				"fehlende oder geänderte Signaturen sind ein Mangel: %q\n", in.EntryPoints)
+		}
+		if in.Tests != "" {
+			facts += fmt.Sprintf("- Tests zur Aufgabe (nicht ausgeführt; prüfe, ob die Lösung sie bestehen würde): %q\n", in.Tests)
+		}
+		if facts == "" {
+			return ""
+		}
+		return "\nSchnittstelle:\n" + facts
+	}
+	if !ok || t.Evaluation == "" {
+		return ""
+	}
+
+	var b strings.Builder
+	b.WriteString("\nAufgabentyp:\n" + t.Evaluation + "\n")
+	fmt.Fprintf(&b, "- Ausgangscode: %q;\n", in.Starter)
+	if in.AnswerKey != "" {
+		fmt.Fprintf(&b, "- Lösungsschlüssel (nicht zitieren): %q\n", in.AnswerKey)
+	}
+	return b.String()
+}
+
+func outputLines(output string) []string {
+	output = strings.ReplaceAll(output, "\r\n", "\n")
+	lines := strings.Split(strings.TrimRight(output, "\n "), "\n")
+	for i := range lines {
+		lines[i] = strings.TrimRight(lines[i], " \t")
+	}
+	return lines
+}
+
+// fractionMark rechnet einen Anteil richtiger Antworten linear in eine Note von 1,0
+// (alles richtig) bis 6,0 (nichts richtig) um.
+func fractionMark(fraction float64) float64 {
+	return math.Round((1+5*(1-fraction))*10) / 10
+}
+
+// gradePredictedOutput bewertet ohne KI nur eine Vorhersage, die exakt dem Lösungsschlüssel
+// entspricht. Der Schlüssel ist die nicht ausgeführte Vorhersage der KI und kann selbst
+// falsch sein; bei jeder Abweichung bewertet deshalb die KI anhand des Ausgangscodes.
+func gradePredictedOutput(in evaluationInput) (models.TaskEvaluation, float64, bool) {
+	if strings.TrimSpace(in.AnswerKey) == "" || !slices.Equal(outputLines(in.AnswerKey), outputLines(in.Code)) {
+		return models.TaskEvaluation{}, 0, false
+	}
+
+	mark := fractionMark(1)
+	return models.TaskEvaluation{
+		Rating:         "Die vorhergesagte Ausgabe stimmt exakt. Tipp: Versuche als Nächstes eine schwierigere Aufgabe dieses Typs.",
+		Mark:           formatMark(mark),
+		TimeComparison: compareTime(in.TimeSpent, in.TimeEstimated),
+		Solution:       in.AnswerKey,
+	}, mark, true
+}
+
+type taskTypeInfo struct {
+	Type            string `db:"task_type"`
+	Starter         string `db:"starter_code"`
+	AnswerKey       string `db:"answer_key"`
+	EntryPointsJSON string `db:"entry_points"`
+	Tests           string `db:"tests"`
+	Reference       string `db:"reference_solution"`
+}
+
+const taskTypeColumns = `tasks.task_type, COALESCE(tasks.starter_code, '') AS starter_code,
+	COALESCE(tasks.answer_key, '') AS answer_key, COALESCE(tasks.entry_points, '[]') AS entry_points,
+	COALESCE(tasks.tests, '') AS tests, COALESCE(tasks.reference_solution, '') AS reference_solution`
+
+func (info taskTypeInfo) entryPoints() []string {
+	var entryPoints []string
+	if err := json.Unmarshal([]byte(info.EntryPointsJSON), &entryPoints); err != nil {
+		log.Printf("entryPoints: %v", err)
+	}
+	return entryPoints
+}
+
+// analyzeSubmission führt die statische Analyse nur für Abgaben aus, die Programmcode sind.
+func analyzeSubmission(code string, files []models.CodeFile, language, taskTypeName string) *models.CodeAnalysis {
+	if t, ok := taskTypes[taskTypeName]; ok && !t.Code {
+		return nil
+	}
+
+	var analysis models.CodeAnalysis
+	if files != nil {
+		analysis = analyzeFiles(files, language)
+	} else {
+		analysis = analyzeCode(code, language)
+	}
+	return &analysis
+}
+
+// GetTaskTypes liefert die Aufgabentypen für Auswahl und Filter im Frontend.
+func GetTaskTypes(c *gin.Context) {
+	types := make([]gin.H, 0, len(taskTypeOrder))
+	for _, name := range taskTypeOrder {
+		types = append(types, gin.H{"type": name, "label": taskTypes[name].Label, "starter": taskTypes[name].Starter})
+	}
+	c.JSON(http.StatusOK, types)
+}
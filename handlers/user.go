@@ -3,9 +3,12 @@ package handlers
 import (
 	"api-test/database"
 	"api-test/models"
+	"encoding/json"
 	"golang.org/x/crypto/bcrypt"
 	"log"
 	"net/http"
+	"strconv"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 )
@@ -36,29 +39,57 @@ func RegisterUser(c *gin.Context) {
 	c.JSON(http.StatusCreated, gin.H{"message": "User erfolgreich registriert"})
 }
 
+// LoginUser prüft vor den Anmeldedaten Sperre, Wartezeit und, nach wiederholten
+// Fehlversuchen, die Challenge. Jeder Versuch wird in login_attempts protokolliert.
 func LoginUser(c *gin.Context) {
-	var creds models.Credentials
+	var creds models.LoginRequest
 	if err := c.ShouldBindJSON(&creds); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
+	ip := c.ClientIP()
+	attemptID, guard, ok := admitLogin(c, creds, ip)
+	if !ok {
+		return
+	}
+
+	guard.user.Count++
+	guard.ip.Count++
+	failed := gin.H{
+		"error":              "Ungültige Anmeldedaten",
+		"challenge_required": guard.challengeRequired(),
+	}
+
 	var user models.User
 	err := database.DB.Get(&user, "SELECT * FROM users WHERE username = ?", creds.Username)
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Ungültige Anmeldedaten"})
+		finishLoginAttempt(attemptID, nil, false, loginReasonCredentials)
+		c.JSON(http.StatusUnauthorized, failed)
 		return
 	}
 
 	err = bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(creds.Password))
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Ungültige Anmeldedaten"})
+		finishLoginAttempt(attemptID, &user.ID, false, loginReasonCredentials)
+		c.JSON(http.StatusUnauthorized, failed)
+		return
+	}
+
+	finishLoginAttempt(attemptID, &user.ID, true, loginReasonOK)
+
+	token, err := issueToken(user.ID)
+	if err != nil {
+		log.Printf("DB Error (token): %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Fehler beim Erstellen des Tokens"})
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{
 		"message": "Login erfolgreich",
 		"user_id": user.ID,
+		"role":    user.Role,
+		"token":   token,
 	})
 }
 
@@ -222,6 +253,18 @@ func GetUserStatsLanguage(c *gin.Context) {
 		return
 	}
 
+	err = database.DB.QueryRow(`
+		SELECT COUNT(*), COALESCE(AVG(score), 0)
+		FROM quizzes
+		WHERE language = ? AND user_id = ? AND submitted_at IS NOT NULL`,
+		strings.ToLower(language), userID).Scan(&stats.Quizzes, &stats.QuizAvgScore)
+
+	if err != nil {
+		log.Printf("DB Error (Quizzes): %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Fehler beim Abrufen der Quizstatistik"})
+		return
+	}
+
 	err = database.DB.QueryRow(`
 		SELECT 
 			COUNT(CASE WHEN solutions.ai_usage > 0 THEN 1 END) AS ai_with_usage,
@@ -263,6 +306,14 @@ func GetUserStatsLanguage(c *gin.Context) {
 		stats.TaskLevels[level] = count
 	}
 
+	userIDInt, err := strconv.Atoi(userID)
+	if err == nil {
+		stats.Rating, err = loadSkillRating(userIDInt, strings.ToLower(language), "")
+	}
+	if err != nil {
+		log.Printf("DB Error (Rating): %v", err)
+	}
+
 	log.Printf("%+v\n", stats)
 
 	c.JSON(http.StatusOK, stats)
@@ -275,15 +326,28 @@ func GetUserTasks(c *gin.Context) {
 
 	var tasks models.Tasks
 
-	err := database.DB.Select(&tasks, `
+	query := `
 		SELECT
 		    tasks.id, tasks.description, tasks.language, solutions.mark,
     		tasks.level, COALESCE(solutions.ai_usage, 0) as ai_usage, 
     		COALESCE(solutions.time_spent, 0) as time_spent,
-    		tasks.time_estimated, solutions.rating
+    		tasks.time_estimated, solutions.rating, tasks.similarity, tasks.task_type,
+    		tasks.user_provided
 		FROM tasks
-        	LEFT JOIN solutions ON tasks.id = solutions.task_id
-		WHERE tasks.user_id = ?`, userID)
+        	LEFT JOIN solutions ON solutions.id = (SELECT MAX(id) FROM solutions WHERE task_id = tasks.id)
+		WHERE tasks.user_id = ?`
+	args := []any{userID}
+
+	if taskType := c.Query("type"); taskType != "" {
+		if _, ok := taskTypes[taskType]; !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Ungültiger Aufgabentyp"})
+			return
+		}
+		query += " AND tasks.task_type = ?"
+		args = append(args, taskType)
+	}
+
+	err := database.DB.Select(&tasks, query, args...)
 
 	if err != nil {
 		log.Printf("DB Error: %v", err)
@@ -304,14 +368,20 @@ func GetSingleTask(c *gin.Context) {
 	err := database.DB.Get(&task, `
 		SELECT
 			tasks.id, tasks.description, tasks.language, tasks.level,
+			solutions.id AS solution_id,
 			COALESCE(solutions.mark, NULL) as mark,
+			COALESCE(solutions.ai_mark, solutions.raw_mark, solutions.mark) AS ai_mark,
+			solutions.graded_by,
 			COALESCE(solutions.rating, 'Keine Bewertung') as rating, 
 			COALESCE(solutions.time_spent, 0) as time_spent, 
 			tasks.time_estimated,
 			COALESCE(solutions.ai_usage, 0) as ai_usage, 
-			COALESCE(solutions.code, '') as code
+			solutions.ai_reliance,
+			COALESCE(solutions.code, '') as code,
+			tasks.catalog_task_id, tasks.similarity, tasks.multi_file, tasks.task_type, tasks.starter_code,
+			tasks.entry_points, tasks.tests, tasks.user_provided, tasks.source_text
 		FROM tasks
-		LEFT JOIN solutions ON tasks.id = solutions.task_id
+		LEFT JOIN solutions ON solutions.id = (SELECT MAX(id) FROM solutions WHERE task_id = tasks.id)
 		WHERE tasks.id = ?`, taskID)
 
 	if err != nil {
@@ -330,8 +400,45 @@ func GetSingleTask(c *gin.Context) {
 		interactions = []models.TaskInteraction{}
 	}
 
+	var codeState *string
+	for i := range interactions {
+		if interactions[i].Code != nil && *interactions[i].Code != "" {
+			codeState = interactions[i].Code
+		} else {
+			interactions[i].Code = codeState
+		}
+	}
+
 	task.Interactions = interactions
 
+	task.EntryPoints = []string{}
+	if task.EntryPointsDB != nil {
+		if err := json.Unmarshal([]byte(*task.EntryPointsDB), &task.EntryPoints); err != nil {
+			log.Printf("GetSingleTask: entry points: %v", err)
+		}
+	}
+	if task.StarterCode != nil && task.MultiFile {
+		task.StarterFiles = unflattenFiles(*task.StarterCode)
+	}
+
+	task.Comments = []models.SolutionComment{}
+	task.Files = []models.CodeFile{}
+	if task.SolutionID != nil {
+		task.Comments, err = loadSolutionComments(*task.SolutionID)
+		if err != nil {
+			log.Printf("DB Error (comments): %v", err)
+		}
+		task.Files, err = loadSolutionFiles(*task.SolutionID)
+		if err != nil {
+			log.Printf("DB Error (solution files): %v", err)
+		}
+	}
+
+	task.MeasuredTime, err = measuredTimeSpent(task.ID)
+	if err != nil {
+		log.Printf("DB Error (measured time): %v", err)
+	}
+
 	c.JSON(http.StatusOK, task)
 }
 
@@ -342,6 +449,7 @@ func ChangeUsername(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Ungültige Anfrage"})
 		return
 	}
+	req.UserID, _ = currentUser(c)
 
 	_, err := database.DB.Exec("UPDATE users SET username = ? WHERE id = ?", req.Username, req.UserID)
 	if err != nil {
@@ -359,6 +467,7 @@ func ChangePassword(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Ungültige Anfrage"})
 		return
 	}
+	req.UserID, _ = currentUser(c)
 
 	var hashedPassword string
 	err := database.DB.Get(&hashedPassword, "SELECT password FROM users WHERE id = ?", req.UserID)
@@ -378,12 +487,32 @@ func ChangePassword(c *gin.Context) {
 		return
 	}
 
-	_, err = database.DB.Exec("UPDATE users SET password = ? WHERE id = ?", string(hashedNewPassword), req.UserID)
+	tx, err := database.DB.Beginx()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Fehler beim Ändern des Passworts"})
+		return
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec("UPDATE users SET password = ? WHERE id = ?", string(hashedNewPassword), req.UserID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Fehler beim Ändern des Passworts"})
 		return
 	}
 
+	// Alle anderen Sitzungen abmelden, die aktuelle bleibt bestehen.
+	_, err = tx.Exec("DELETE FROM auth_tokens WHERE user_id = ? AND token_hash != ?", req.UserID, hashToken(bearerToken(c)))
+	if err != nil {
+		log.Printf("DB Error (revoke tokens): %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Fehler beim Ändern des Passworts"})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Fehler beim Ändern des Passworts"})
+		return
+	}
+
 	c.JSON(http.StatusOK, gin.H{"message": "Passwort erfolgreich geändert"})
 }
 
@@ -394,6 +523,7 @@ func DeleteAccount(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Ungültige Anfrage"})
 		return
 	}
+	req.UserID, _ = currentUser(c)
 
 	tx, err := database.DB.Beginx()
 	if err != nil {
@@ -410,6 +540,148 @@ func DeleteAccount(c *gin.Context) {
 		return
 	}
 
+	_, err = tx.Exec("DELETE FROM code_snapshots WHERE task_id IN (SELECT id FROM tasks WHERE user_id = ?)", req.UserID)
+	if err != nil {
+		log.Printf("Error deleting code snapshots: %v", err)
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Fehler beim Löschen der Code-Snapshots"})
+		return
+	}
+
+	_, err = tx.Exec("DELETE FROM task_session_events WHERE task_id IN (SELECT id FROM tasks WHERE user_id = ?)", req.UserID)
+	if err != nil {
+		log.Printf("Error deleting session events: %v", err)
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Fehler beim Löschen der Sitzungen"})
+		return
+	}
+
+	_, err = tx.Exec("DELETE FROM review_items WHERE user_id = ?", req.UserID)
+	if err != nil {
+		log.Printf("Error deleting review items: %v", err)
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Fehler beim Löschen der Wiederholungen"})
+		return
+	}
+
+	_, err = tx.Exec("DELETE FROM skill_rating_history WHERE user_id = ?", req.UserID)
+	if err != nil {
+		log.Printf("Error deleting rating history: %v", err)
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Fehler beim Löschen des Wertungsverlaufs"})
+		return
+	}
+
+	_, err = tx.Exec("DELETE FROM quiz_questions WHERE quiz_id IN (SELECT id FROM quizzes WHERE user_id = ?)", req.UserID)
+	if err != nil {
+		log.Printf("Error deleting quiz questions: %v", err)
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Fehler beim Löschen der Quizfragen"})
+		return
+	}
+
+	_, err = tx.Exec("DELETE FROM quizzes WHERE user_id = ?", req.UserID)
+	if err != nil {
+		log.Printf("Error deleting quizzes: %v", err)
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Fehler beim Löschen der Quizze"})
+		return
+	}
+
+	_, err = tx.Exec("DELETE FROM skill_ratings WHERE user_id = ?", req.UserID)
+	if err != nil {
+		log.Printf("Error deleting ratings: %v", err)
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Fehler beim Löschen der Wertungen"})
+		return
+	}
+
+	_, err = tx.Exec("DELETE FROM course_members WHERE user_id = ? OR course_id IN (SELECT id FROM courses WHERE teacher_id = ?)", req.UserID, req.UserID)
+	if err != nil {
+		log.Printf("Error deleting course memberships: %v", err)
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Fehler beim Löschen der Kursmitgliedschaften"})
+		return
+	}
+
+	_, err = tx.Exec(`
+		UPDATE tasks SET assignment_id = NULL
+		WHERE assignment_id IN (SELECT id FROM assignments WHERE course_id IN (SELECT id FROM courses WHERE teacher_id = ?))
+	`, req.UserID)
+	if err == nil {
+		_, err = tx.Exec("DELETE FROM assignments WHERE course_id IN (SELECT id FROM courses WHERE teacher_id = ?)", req.UserID)
+	}
+	if err != nil {
+		log.Printf("Error deleting assignments: %v", err)
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Fehler beim Löschen der Kursaufgaben"})
+		return
+	}
+
+	_, err = tx.Exec("DELETE FROM evaluation_settings WHERE course_id IN (SELECT id FROM courses WHERE teacher_id = ?)", req.UserID)
+	if err == nil {
+		_, err = tx.Exec("DELETE FROM courses WHERE teacher_id = ?", req.UserID)
+	}
+	if err != nil {
+		log.Printf("Error deleting courses: %v", err)
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Fehler beim Löschen der Kurse"})
+		return
+	}
+
+	_, err = tx.Exec("DELETE FROM auth_tokens WHERE user_id = ?", req.UserID)
+	if err != nil {
+		log.Printf("Error deleting tokens: %v", err)
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Fehler beim Löschen der Anmeldungen"})
+		return
+	}
+
+	_, err = tx.Exec(`
+		DELETE FROM solution_comments
+		WHERE author_id = ? OR solution_id IN (SELECT solutions.id FROM solutions JOIN tasks ON tasks.id = solutions.task_id WHERE tasks.user_id = ?)
+	`, req.UserID, req.UserID)
+	if err == nil {
+		_, err = tx.Exec("DELETE FROM grade_changes WHERE solution_id IN (SELECT solutions.id FROM solutions JOIN tasks ON tasks.id = solutions.task_id WHERE tasks.user_id = ?)", req.UserID)
+	}
+	if err == nil {
+		_, err = tx.Exec("UPDATE grade_changes SET changed_by = NULL WHERE changed_by = ?", req.UserID)
+	}
+	if err == nil {
+		_, err = tx.Exec("DELETE FROM appeals WHERE user_id = ?", req.UserID)
+	}
+	if err == nil {
+		_, err = tx.Exec("UPDATE appeals SET resolved_by = NULL WHERE resolved_by = ?", req.UserID)
+	}
+	if err == nil {
+		_, err = tx.Exec("DELETE FROM notifications WHERE user_id = ?", req.UserID)
+	}
+	if err == nil {
+		_, err = tx.Exec("DELETE FROM generated_tasks WHERE user_id = ?", req.UserID)
+	}
+	if err == nil {
+		_, err = tx.Exec(`
+			DELETE FROM similarity_flags
+			WHERE solution_id IN (SELECT solutions.id FROM solutions JOIN tasks ON tasks.id = solutions.task_id WHERE tasks.user_id = ?)
+				OR other_solution_id IN (SELECT solutions.id FROM solutions JOIN tasks ON tasks.id = solutions.task_id WHERE tasks.user_id = ?)
+		`, req.UserID, req.UserID)
+	}
+	if err == nil {
+		_, err = tx.Exec("DELETE FROM solution_files WHERE solution_id IN (SELECT solutions.id FROM solutions JOIN tasks ON tasks.id = solutions.task_id WHERE tasks.user_id = ?)", req.UserID)
+	}
+	if err == nil {
+		_, err = tx.Exec("DELETE FROM solution_diagnostics WHERE solution_id IN (SELECT solutions.id FROM solutions JOIN tasks ON tasks.id = solutions.task_id WHERE tasks.user_id = ?)", req.UserID)
+	}
+	if err == nil {
+		_, err = tx.Exec("DELETE FROM evaluation_samples WHERE solution_id IN (SELECT solutions.id FROM solutions JOIN tasks ON tasks.id = solutions.task_id WHERE tasks.user_id = ?)", req.UserID)
+	}
+	if err != nil {
+		log.Printf("Error deleting grading data: %v", err)
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Fehler beim Löschen der Bewertungsdaten"})
+		return
+	}
+
 	_, err = tx.Exec("DELETE FROM solutions WHERE task_id IN (SELECT id FROM tasks WHERE user_id = ?)", req.UserID)
 	if err != nil {
 		log.Printf("Error deleting solutions: %v", err)
@@ -441,6 +713,6 @@ func DeleteAccount(c *gin.Context) {
 		return
 	}
 
-	log.Printf("Account with user_id=%s successfully deleted.", req.UserID)
+	log.Printf("Account with user_id=%d successfully deleted.", req.UserID)
 	c.JSON(http.StatusOK, gin.H{"message": "Konto erfolgreich gelöscht"})
 }
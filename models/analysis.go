@@ -0,0 +1,24 @@
+package models
+
+type Diagnostic struct {
+	Tool     string `json:"tool" db:"tool"`
+	File     string `json:"file,omitempty" db:"file"`
+	Line     int    `json:"line" db:"line"`
+	Column   int    `json:"column,omitempty" db:"col"`
+	Severity string `json:"severity" db:"severity"`
+	Message  string `json:"message" db:"message"`
+}
+
+type CodeMetrics struct {
+	CodeLines      int `json:"code_lines" db:"code_lines"`
+	Complexity     int `json:"complexity" db:"complexity"`
+	MaxNesting     int `json:"max_nesting" db:"max_nesting"`
+	MaxNestingLine int `json:"max_nesting_line,omitempty" db:"-"`
+	LongLines      int `json:"long_lines,omitempty" db:"-"`
+}
+
+type CodeAnalysis struct {
+	Tools       []string     `json:"tools"`
+	Metrics     CodeMetrics  `json:"metrics"`
+	Diagnostics []Diagnostic `json:"diagnostics"`
+}
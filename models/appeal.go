@@ -0,0 +1,42 @@
+package models
+
+type Appeal struct {
+	ID             int      `json:"id" db:"id"`
+	SolutionID     int      `json:"solution_id" db:"solution_id"`
+	UserID         int      `json:"user_id" db:"user_id"`
+	Username       string   `json:"username,omitempty" db:"username"`
+	TaskID         int      `json:"task_id" db:"task_id"`
+	Task           string   `json:"task,omitempty" db:"task"`
+	Code           string   `json:"code,omitempty" db:"code"`
+	Mark           *float64 `json:"mark" db:"mark"`
+	AIMark         *float64 `json:"ai_mark" db:"ai_mark"`
+	Justification  string   `json:"justification" db:"justification"`
+	Status         string   `json:"status" db:"status"`
+	PreviousMark   *float64 `json:"previous_mark" db:"previous_mark"`
+	RegradeMark    *float64 `json:"regrade_mark" db:"regrade_mark"`
+	RegradeSpread  *float64 `json:"regrade_spread" db:"regrade_spread"`
+	RegradeSamples int      `json:"regrade_samples" db:"regrade_samples"`
+	Response       *string  `json:"response" db:"response"`
+	ResolvedBy     *int     `json:"resolved_by" db:"resolved_by"`
+	ResolvedMark   *float64 `json:"resolved_mark" db:"resolved_mark"`
+	CreatedAt      int64    `json:"created_at" db:"created_at"`
+	UpdatedAt      int64    `json:"updated_at" db:"updated_at"`
+}
+
+type AppealRequest struct {
+	Justification string `json:"justification"`
+}
+
+type AppealResolution struct {
+	Mark     *float64 `json:"mark"`
+	Response string   `json:"response"`
+}
+
+type Notification struct {
+	ID          int    `json:"id" db:"id"`
+	Kind        string `json:"kind" db:"kind"`
+	ReferenceID *int   `json:"reference_id" db:"reference_id"`
+	Message     string `json:"message" db:"message"`
+	CreatedAt   int64  `json:"created_at" db:"created_at"`
+	ReadAt      *int64 `json:"read_at" db:"read_at"`
+}
@@ -0,0 +1,59 @@
+package models
+
+type Assignment struct {
+	ID            int     `json:"id" db:"id"`
+	CourseID      int     `json:"course_id" db:"course_id"`
+	CatalogTaskID *int    `json:"catalog_task_id" db:"catalog_task_id"`
+	Title         string  `json:"title" db:"title"`
+	Description   string  `json:"description" db:"description"`
+	Language      string  `json:"language" db:"language"`
+	Level         string  `json:"level" db:"level"`
+	TimeEstimated int     `json:"time_estimated" db:"time_estimated"`
+	TimeLimit     *int    `json:"time_limit" db:"time_limit"`
+	OpenAt        int64   `json:"open_at" db:"open_at"`
+	DueAt         int64   `json:"due_at" db:"due_at"`
+	AIPolicy      string  `json:"ai_policy" db:"ai_policy"`
+	MaxAttempts   int     `json:"max_attempts" db:"max_attempts"`
+	LatePenalty   float64 `json:"late_penalty" db:"late_penalty"`
+	LateDays      int     `json:"late_days" db:"late_days"`
+	CreatedAt     int64   `json:"created_at" db:"created_at"`
+}
+
+type AssignmentRequest struct {
+	CatalogTaskID *int    `json:"catalog_task_id"`
+	Title         string  `json:"title"`
+	Description   string  `json:"description"`
+	Language      string  `json:"language"`
+	Level         string  `json:"level"`
+	TimeEstimated int     `json:"time_estimated"`
+	TimeLimit     int     `json:"time_limit"`
+	OpenAt        int64   `json:"open_at"`
+	DueAt         int64   `json:"due_at"`
+	AIPolicy      string  `json:"ai_policy"`
+	MaxAttempts   int     `json:"max_attempts"`
+	LatePenalty   float64 `json:"late_penalty"`
+	LateDays      int     `json:"late_days"`
+}
+
+type AssignmentSubmission struct {
+	UserID      int      `json:"user_id" db:"user_id"`
+	Username    string   `json:"username" db:"username"`
+	Status      string   `json:"status" db:"-"`
+	TaskID      *int     `json:"task_id" db:"task_id"`
+	Attempts    int      `json:"attempts" db:"attempts"`
+	BestMark    *float64 `json:"best_mark" db:"best_mark"`
+	LastMark    *float64 `json:"last_mark" db:"last_mark"`
+	LastRawMark *float64 `json:"last_raw_mark" db:"last_raw_mark"`
+	LatePenalty *float64 `json:"late_penalty" db:"late_penalty"`
+	SubmittedAt *int64   `json:"submitted_at" db:"submitted_at"`
+	AIUsage     bool     `json:"ai_usage" db:"ai_usage"`
+	AIReliance  *float64 `json:"ai_reliance" db:"ai_reliance"`
+}
+
+type AssignmentOverview struct {
+	Assignment  Assignment             `json:"assignment"`
+	Submitted   int                    `json:"submitted"`
+	Late        int                    `json:"late"`
+	AvgMark     *float64               `json:"avg_mark"`
+	Submissions []AssignmentSubmission `json:"submissions"`
+}
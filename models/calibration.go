@@ -0,0 +1,59 @@
+package models
+
+type CalibrationCorpus struct {
+	Version string            `json:"version"`
+	Cases   []CalibrationCase `json:"cases"`
+}
+
+type CalibrationCase struct {
+	ID            string  `json:"id"`
+	Task          string  `json:"task"`
+	Language      string  `json:"language"`
+	Level         string  `json:"level"`
+	Code          string  `json:"code"`
+	UseAI         bool    `json:"use_ai"`
+	TimeEstimated int     `json:"time_estimated"`
+	TimeSpent     int     `json:"time_spent"`
+	ExpectedMin   float64 `json:"expected_min"`
+	ExpectedMax   float64 `json:"expected_max"`
+}
+
+type CalibrationConfig struct {
+	Label       string   `json:"label"`
+	Prompt      string   `json:"-"`
+	PromptName  string   `json:"prompt"`
+	Models      []string `json:"models"`
+	Samples     int      `json:"samples"`
+	Aggregate   string   `json:"aggregate"`
+	Temperature float32  `json:"temperature"`
+	Runs        int      `json:"runs"`
+}
+
+type CalibrationStats struct {
+	Cases    int     `json:"cases"`
+	Failures int     `json:"failures"`
+	MAE      float64 `json:"mae"`
+	Bias     float64 `json:"bias"`
+	HitRate  float64 `json:"hit_rate"`
+	StdDev   float64 `json:"stddev"`
+}
+
+type CalibrationCaseResult struct {
+	ID       string    `json:"id"`
+	Level    string    `json:"level"`
+	Expected []float64 `json:"expected"`
+	Marks    []float64 `json:"marks"`
+	Mean     float64   `json:"mean"`
+	StdDev   float64   `json:"stddev"`
+	Error    float64   `json:"error"`
+	Within   bool      `json:"within"`
+	Failures int       `json:"failures"`
+}
+
+type CalibrationReport struct {
+	CorpusVersion string                      `json:"corpus_version"`
+	Config        CalibrationConfig           `json:"config"`
+	Overall       CalibrationStats            `json:"overall"`
+	Levels        map[string]CalibrationStats `json:"levels"`
+	Cases         []CalibrationCaseResult     `json:"cases"`
+}
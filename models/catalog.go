@@ -0,0 +1,39 @@
+package models
+
+type CatalogTask struct {
+	ID            int      `json:"id" db:"id"`
+	Description   string   `json:"description" db:"description"`
+	Language      string   `json:"language" db:"language"`
+	Level         string   `json:"level" db:"level"`
+	TimeEstimated int      `json:"time_estimated" db:"time_estimated"`
+	Source        string   `json:"source" db:"source"`
+	SourceTaskID  *int     `json:"source_task_id" db:"source_task_id"`
+	CreatedAt     int64    `json:"created_at" db:"created_at"`
+	TaskType      string   `json:"task_type" db:"task_type"`
+	StarterCode   string   `json:"starter_code,omitempty" db:"starter_code"`
+	Topics        []string `json:"topics" db:"-"`
+}
+
+type CatalogTaskRequest struct {
+	Description   string   `json:"description"`
+	Language      string   `json:"language"`
+	Level         string   `json:"level"`
+	TimeEstimated int      `json:"time_estimated"`
+	Topics        []string `json:"topics"`
+}
+
+type CatalogPromoteRequest struct {
+	TaskID int      `json:"task_id"`
+	Topics []string `json:"topics"`
+}
+
+type CatalogStartRequest struct {
+	UserID    int `json:"user_id"`
+	TimeLimit int `json:"time_limit"`
+}
+
+type Topic struct {
+	ID        int    `json:"id" db:"id"`
+	Name      string `json:"name" db:"name"`
+	TaskCount int    `json:"task_count" db:"task_count"`
+}
@@ -1,14 +1,51 @@
 package models
 
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+)
+
 type TaskChatRequest struct {
-	UserId        int    `json:"user_id"`
-	TaskId        int    `json:"task_id"`
-	Message       string `json:"message"`
-	Level         string `json:"level"`
-	Language      string `json:"language"`
-	Task          string `json:"task"`
-	TimeRemaining int    `json:"time_remaining"`
-	TimeSpent     int    `json:"time_spent"`
+	UserId        int            `json:"user_id"`
+	TaskId        int            `json:"task_id"`
+	Message       string         `json:"message"`
+	Level         string         `json:"level"`
+	Language      string         `json:"language"`
+	Task          string         `json:"task"`
+	TimeRemaining int            `json:"time_remaining"`
+	TimeSpent     int            `json:"time_spent"`
+	Code          string         `json:"code"`
+	Selection     *CodeSelection `json:"selection"`
+	RunOutput     string         `json:"run_output"`
+	Files         []CodeFile     `json:"files"`
+}
+
+type CodeSelection struct {
+	File        string `json:"file,omitempty"`
+	StartLine   int    `json:"start_line"`
+	StartColumn int    `json:"start_column"`
+	EndLine     int    `json:"end_line"`
+	EndColumn   int    `json:"end_column"`
+}
+
+func (s CodeSelection) Value() (driver.Value, error) {
+	b, err := json.Marshal(s)
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}
+
+func (s *CodeSelection) Scan(src any) error {
+	switch v := src.(type) {
+	case string:
+		return json.Unmarshal([]byte(v), s)
+	case []byte:
+		return json.Unmarshal(v, s)
+	default:
+		return fmt.Errorf("CodeSelection: unsupported type %T", src)
+	}
 }
 
 type TaskChatResponse struct {
@@ -0,0 +1,37 @@
+package models
+
+type Course struct {
+	ID          int     `db:"id" json:"id"`
+	Name        string  `db:"name" json:"name"`
+	Description string  `db:"description" json:"description"`
+	TeacherID   int     `db:"teacher_id" json:"teacher_id"`
+	Teacher     string  `db:"teacher" json:"teacher"`
+	InviteCode  *string `db:"invite_code" json:"invite_code,omitempty"`
+	Role        string  `db:"role" json:"role"`
+	Members     int     `db:"members" json:"members"`
+	CreatedAt   int64   `db:"created_at" json:"created_at"`
+}
+
+type CourseRequest struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+type CourseJoinRequest struct {
+	InviteCode string `json:"invite_code"`
+}
+
+type CourseMember struct {
+	UserID         int      `db:"user_id" json:"user_id"`
+	Username       string   `db:"username" json:"username"`
+	Role           string   `db:"role" json:"role"`
+	JoinedAt       int64    `db:"joined_at" json:"joined_at"`
+	TotalTasks     int      `db:"total_tasks" json:"total_tasks"`
+	CompletedTasks int      `db:"completed_tasks" json:"completed_tasks"`
+	AvgMark        *float64 `db:"avg_mark" json:"avg_mark"`
+}
+
+type RoleRequest struct {
+	UserID int    `json:"user_id"`
+	Role   string `json:"role"`
+}
@@ -4,6 +4,7 @@ type User struct {
 	ID       int    `db:"id" json:"id"`
 	Username string `json:"username"`
 	Password string `json:"password"`
+	Role     string `db:"role" json:"role"`
 }
 
 type Interaction struct {
@@ -0,0 +1,46 @@
+package models
+
+type EvaluationSettings struct {
+	ID              int      `json:"id" db:"id"`
+	CourseID        int      `json:"course_id" db:"course_id"`
+	Level           string   `json:"level" db:"level"`
+	Samples         int      `json:"samples" db:"samples"`
+	Models          []string `json:"models" db:"-"`
+	ModelList       string   `json:"-" db:"models"`
+	Aggregate       string   `json:"aggregate" db:"aggregate"`
+	ReviewThreshold float64  `json:"review_threshold" db:"review_threshold"`
+	UpdatedAt       int64    `json:"updated_at" db:"updated_at"`
+}
+
+type EvaluationSettingsRequest struct {
+	CourseID        int      `json:"course_id"`
+	Level           string   `json:"level"`
+	Samples         int      `json:"samples"`
+	Models          []string `json:"models"`
+	Aggregate       string   `json:"aggregate"`
+	ReviewThreshold float64  `json:"review_threshold"`
+}
+
+type AIReliance struct {
+	Score     float64  `json:"score" db:"ai_reliance"`
+	Tutor     float64  `json:"tutor_overlap" db:"tutor_overlap"`
+	Paste     float64  `json:"paste_overlap" db:"paste_overlap"`
+	Reference *float64 `json:"reference_overlap" db:"reference_overlap"`
+}
+
+type EvaluationSample struct {
+	Model string  `json:"model" db:"model"`
+	Mark  float64 `json:"mark" db:"mark"`
+}
+
+type FlaggedSolution struct {
+	SolutionID int                `json:"solution_id" db:"solution_id"`
+	TaskID     int                `json:"task_id" db:"task_id"`
+	UserID     int                `json:"user_id" db:"user_id"`
+	Username   string             `json:"username" db:"username"`
+	Task       string             `json:"task" db:"task"`
+	Mark       *float64           `json:"mark" db:"mark"`
+	Spread     *float64           `json:"spread" db:"mark_spread"`
+	Confidence *float64           `json:"confidence" db:"confidence"`
+	Samples    []EvaluationSample `json:"samples" db:"-"`
+}
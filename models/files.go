@@ -0,0 +1,6 @@
+package models
+
+type CodeFile struct {
+	Path    string `json:"path" db:"path"`
+	Content string `json:"content" db:"content"`
+}
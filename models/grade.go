@@ -0,0 +1,43 @@
+package models
+
+type GradeChange struct {
+	ID           int      `json:"id" db:"id"`
+	Source       string   `json:"source" db:"source"`
+	ChangedBy    *int     `json:"changed_by" db:"changed_by"`
+	ChangedName  *string  `json:"changed_by_name" db:"changed_by_name"`
+	PreviousMark *float64 `json:"previous_mark" db:"previous_mark"`
+	Mark         float64  `json:"mark" db:"mark"`
+	Reason       string   `json:"reason" db:"reason"`
+	CreatedAt    int64    `json:"created_at" db:"created_at"`
+}
+
+type SolutionGrades struct {
+	SolutionID  int           `json:"solution_id" db:"id"`
+	AIMark      *float64      `json:"ai_mark" db:"ai_mark"`
+	Mark        *float64      `json:"mark" db:"mark"`
+	LatePenalty *float64      `json:"late_penalty" db:"late_penalty"`
+	GradedBy    *int          `json:"graded_by" db:"graded_by"`
+	GradedAt    *int64        `json:"graded_at" db:"graded_at"`
+	Changes     []GradeChange `json:"changes" db:"-"`
+}
+
+type GradeOverrideRequest struct {
+	Mark   float64 `json:"mark"`
+	Reason string  `json:"reason"`
+}
+
+type SolutionComment struct {
+	ID        int    `json:"id" db:"id"`
+	AuthorID  int    `json:"author_id" db:"author_id"`
+	Author    string `json:"author" db:"author"`
+	StartLine int    `json:"start_line" db:"start_line"`
+	EndLine   int    `json:"end_line" db:"end_line"`
+	Body      string `json:"body" db:"body"`
+	CreatedAt int64  `json:"created_at" db:"created_at"`
+}
+
+type SolutionCommentRequest struct {
+	StartLine int    `json:"start_line"`
+	EndLine   int    `json:"end_line"`
+	Body      string `json:"body"`
+}
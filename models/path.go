@@ -0,0 +1,53 @@
+package models
+
+type LearningPath struct {
+	ID          int          `json:"id" db:"id"`
+	Language    string       `json:"language" db:"language"`
+	Title       string       `json:"title" db:"title"`
+	Description string       `json:"description" db:"description"`
+	CreatedAt   int64        `json:"created_at" db:"created_at"`
+	Modules     []PathModule `json:"modules,omitempty" db:"-"`
+}
+
+type PathModule struct {
+	ID            int      `json:"id" db:"id"`
+	Position      int      `json:"position" db:"position"`
+	Title         string   `json:"title" db:"title"`
+	Description   string   `json:"description" db:"description"`
+	TargetLevel   string   `json:"target_level" db:"target_level"`
+	Topics        []string `json:"topics" db:"-"`
+	CatalogTasks  []int    `json:"catalog_task_ids" db:"-"`
+	Prerequisites []int    `json:"prerequisite_ids" db:"-"`
+}
+
+type PathModuleRequest struct {
+	Title         string   `json:"title"`
+	Description   string   `json:"description"`
+	TargetLevel   string   `json:"target_level"`
+	Topics        []string `json:"topics"`
+	CatalogTasks  []int    `json:"catalog_task_ids"`
+	Prerequisites []int    `json:"prerequisites"`
+}
+
+type LearningPathRequest struct {
+	Language    string              `json:"language"`
+	Title       string              `json:"title"`
+	Description string              `json:"description"`
+	Modules     []PathModuleRequest `json:"modules"`
+}
+
+type ModuleProgress struct {
+	PathModule
+	Status          string   `json:"status"`
+	Progress        float64  `json:"progress"`
+	CompletedTasks  []int    `json:"completed_catalog_task_ids"`
+	CompletedTopics []string `json:"completed_topics"`
+}
+
+type PathProgress struct {
+	PathID     int              `json:"path_id"`
+	Title      string           `json:"title"`
+	Language   string           `json:"language"`
+	Completion float64          `json:"completion"`
+	Modules    []ModuleProgress `json:"modules"`
+}
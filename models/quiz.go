@@ -0,0 +1,49 @@
+package models
+
+type QuizRequest struct {
+	Language  string `json:"language"`
+	Level     string `json:"level"`
+	Topic     string `json:"topic"`
+	Kind      string `json:"kind"`
+	Questions int    `json:"questions"`
+}
+
+// QuizQuestion enthält Lösung und Erklärung erst, wenn das Quiz abgegeben wurde.
+type QuizQuestion struct {
+	ID            int      `json:"id" db:"id"`
+	Position      int      `json:"position" db:"position"`
+	Kind          string   `json:"kind" db:"kind"`
+	Question      string   `json:"question" db:"question"`
+	Options       []string `json:"options,omitempty" db:"-"`
+	OptionsJSON   string   `json:"-" db:"options"`
+	CorrectOption *int     `json:"correct_option,omitempty" db:"correct_option"`
+	Answers       []string `json:"answers,omitempty" db:"-"`
+	AnswersJSON   string   `json:"-" db:"answers"`
+	Explanation   string   `json:"explanation,omitempty" db:"explanation"`
+	Answer        *string  `json:"answer,omitempty" db:"answer"`
+	IsCorrect     *bool    `json:"is_correct,omitempty" db:"is_correct"`
+}
+
+type Quiz struct {
+	ID          int            `json:"id" db:"id"`
+	UserID      int            `json:"user_id" db:"user_id"`
+	Language    string         `json:"language" db:"language"`
+	Level       string         `json:"level" db:"level"`
+	Topic       string         `json:"topic" db:"topic"`
+	CreatedAt   int64          `json:"created_at" db:"created_at"`
+	SubmittedAt *int64         `json:"submitted_at" db:"submitted_at"`
+	Correct     *int           `json:"correct" db:"correct"`
+	Score       *float64       `json:"score" db:"score"`
+	Mark        *float64       `json:"mark" db:"mark"`
+	Questions   []QuizQuestion `json:"questions,omitempty" db:"-"`
+}
+
+type QuizAnswer struct {
+	QuestionID int    `json:"question_id"`
+	Option     *int   `json:"option"`
+	Text       string `json:"text"`
+}
+
+type QuizSubmitRequest struct {
+	Answers []QuizAnswer `json:"answers"`
+}
@@ -0,0 +1,36 @@
+package models
+
+type SkillRating struct {
+	Language  string  `json:"language" db:"language"`
+	Topic     string  `json:"topic" db:"topic"`
+	Rating    float64 `json:"rating" db:"rating"`
+	RD        float64 `json:"rd" db:"rd"`
+	Lower     float64 `json:"lower" db:"-"`
+	Upper     float64 `json:"upper" db:"-"`
+	Solutions int     `json:"solutions" db:"solutions"`
+	UpdatedAt int64   `json:"updated_at" db:"updated_at"`
+}
+
+type SkillRatingHistoryEntry struct {
+	ID           int     `json:"id" db:"id"`
+	TaskID       *int    `json:"task_id" db:"task_id"`
+	SolutionID   *int    `json:"solution_id" db:"solution_id"`
+	QuizID       *int    `json:"quiz_id" db:"quiz_id"`
+	TaskRating   float64 `json:"task_rating" db:"task_rating"`
+	Outcome      float64 `json:"outcome" db:"outcome"`
+	Expected     float64 `json:"expected" db:"expected"`
+	RatingBefore float64 `json:"rating_before" db:"rating_before"`
+	RDBefore     float64 `json:"rd_before" db:"rd_before"`
+	Rating       float64 `json:"rating" db:"rating"`
+	RD           float64 `json:"rd" db:"rd"`
+	Lower        float64 `json:"lower" db:"-"`
+	Upper        float64 `json:"upper" db:"-"`
+	CreatedAt    int64   `json:"created_at" db:"created_at"`
+}
+
+type SkillRatingHistory struct {
+	Language string                    `json:"language"`
+	Topic    string                    `json:"topic"`
+	Current  *SkillRating              `json:"current"`
+	Entries  []SkillRatingHistoryEntry `json:"entries"`
+}
@@ -0,0 +1,30 @@
+package models
+
+type SkillEstimate struct {
+	Language    string  `json:"language"`
+	Topic       string  `json:"topic,omitempty"`
+	Level       string  `json:"level"`
+	Score       float64 `json:"score"`
+	Performance float64 `json:"performance"`
+	Solutions   int     `json:"solutions"`
+}
+
+type TaskRecommendation struct {
+	Language    string          `json:"language"`
+	Level       string          `json:"level"`
+	Topic       string          `json:"topic"`
+	Explanation string          `json:"explanation"`
+	Skills      []SkillEstimate `json:"skills"`
+	TaskRequest TaskRequest     `json:"task_request"`
+}
+
+type NextTaskRequest struct {
+	UserID   int    `json:"user_id"`
+	Language string `json:"language"`
+	Comment  string `json:"comment"`
+}
+
+type NextTaskResponse struct {
+	Recommendation TaskRecommendation `json:"recommendation"`
+	Task           TaskResponse       `json:"task"`
+}
@@ -0,0 +1,21 @@
+package models
+
+type ReviewItem struct {
+	ID            int          `json:"id" db:"id"`
+	Language      string       `json:"language" db:"language"`
+	Topic         string       `json:"topic" db:"topic"`
+	CatalogTaskID *int         `json:"catalog_task_id" db:"catalog_task_id"`
+	Level         string       `json:"level" db:"level"`
+	Easiness      float64      `json:"easiness" db:"easiness"`
+	IntervalDays  int          `json:"interval_days" db:"interval_days"`
+	Repetitions   int          `json:"repetitions" db:"repetitions"`
+	LastQuality   int          `json:"last_quality" db:"last_quality"`
+	LastTaskID    *int         `json:"last_task_id" db:"last_task_id"`
+	DueAt         int64        `json:"due_at" db:"due_at"`
+	Suggestion    *TaskRequest `json:"suggestion" db:"-"`
+}
+
+type ReviewQueue struct {
+	Due      []ReviewItem `json:"due"`
+	Upcoming int          `json:"upcoming"`
+}
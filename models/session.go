@@ -0,0 +1,24 @@
+package models
+
+type TaskSessionRequest struct {
+	UserID int    `json:"user_id"`
+	TaskID int    `json:"task_id"`
+	Action string `json:"action"`
+}
+
+type TaskSessionEvent struct {
+	ID        int    `json:"id" db:"id"`
+	UserID    int    `json:"user_id" db:"user_id"`
+	State     string `json:"state" db:"state"`
+	Auto      bool   `json:"auto" db:"auto"`
+	CreatedAt int64  `json:"created_at" db:"created_at"`
+}
+
+type TaskSession struct {
+	TaskID    int                `json:"task_id"`
+	State     string             `json:"state"`
+	Elapsed   int                `json:"elapsed"`
+	TimeLimit *int               `json:"time_limit"`
+	Remaining *int               `json:"remaining"`
+	Events    []TaskSessionEvent `json:"events"`
+}
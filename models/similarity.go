@@ -0,0 +1,28 @@
+package models
+
+type SimilarityFlag struct {
+	ID              int     `json:"id" db:"id"`
+	Kind            string  `json:"kind" db:"kind"`
+	Similarity      float64 `json:"similarity" db:"similarity"`
+	CreatedAt       int64   `json:"created_at" db:"created_at"`
+	SolutionID      int     `json:"solution_id" db:"solution_id"`
+	TaskID          int     `json:"task_id" db:"task_id"`
+	UserID          int     `json:"user_id" db:"user_id"`
+	Username        string  `json:"username" db:"username"`
+	OtherSolutionID *int    `json:"other_solution_id" db:"other_solution_id"`
+	OtherTaskID     *int    `json:"other_task_id" db:"other_task_id"`
+	OtherUserID     *int    `json:"other_user_id" db:"other_user_id"`
+	OtherUsername   *string `json:"other_username" db:"other_username"`
+}
+
+type SimilarityMatch struct {
+	Lines      [2]int `json:"lines"`
+	OtherLines [2]int `json:"other_lines"`
+}
+
+type SimilarityDetail struct {
+	Flag      SimilarityFlag    `json:"flag"`
+	Code      string            `json:"code"`
+	OtherCode string            `json:"other_code"`
+	Matches   []SimilarityMatch `json:"matches"`
+}
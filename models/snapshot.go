@@ -0,0 +1,31 @@
+package models
+
+type CodeSnapshotRequest struct {
+	UserID int        `json:"user_id"`
+	TaskID int        `json:"task_id"`
+	Code   string     `json:"code"`
+	Event  string     `json:"event"`
+	Files  []CodeFile `json:"files"`
+}
+
+type CodeReplay struct {
+	TaskID       int               `json:"task_id"`
+	At           int64             `json:"at"`
+	Code         string            `json:"code"`
+	Interactions []TaskInteraction `json:"interactions"`
+}
+
+type TimelineEntry struct {
+	Type      string `json:"type"`
+	Time      int64  `json:"time"`
+	Role      string `json:"role,omitempty"`
+	Event     string `json:"event,omitempty"`
+	Length    int    `json:"length,omitempty"`
+	Reference int    `json:"reference_id"`
+}
+
+type TaskTimeline struct {
+	TaskID       int             `json:"task_id"`
+	MeasuredTime int             `json:"measured_time_spent"`
+	Entries      []TimelineEntry `json:"entries"`
+}
@@ -1,14 +1,29 @@
 package models
 
 type TaskRequest struct {
-	Language string `json:"language"`
-	Level    string `json:"level"`
-	Comment  string `json:"comment"`
+	UserID    int    `json:"user_id"`
+	Language  string `json:"language"`
+	Level     string `json:"level"`
+	Topic     string `json:"topic"`
+	Comment   string `json:"comment"`
+	MultiFile bool   `json:"multi_file"`
+	TaskType  string `json:"task_type"`
 }
 
 type TaskResponse struct {
-	Task           string `json:"task"`
-	TimeEstimation int    `json:"time_estimation_minutes"`
+	Task           string   `json:"task"`
+	TimeEstimation int      `json:"time_estimation_minutes"`
+	Similarity     float64  `json:"similarity"`
+	Topic          string   `json:"topic"`
+	MultiFile      bool     `json:"multi_file"`
+	TaskType       string   `json:"task_type"`
+	StarterCode    string   `json:"starter_code,omitempty"`
+	AnswerKey      string   `json:"-"`
+	Reference      string   `json:"-"`
+	EntryPoints    []string `json:"entry_points,omitempty"`
+	Level          string   `json:"level,omitempty"`
+	Tests          string   `json:"tests,omitempty"`
+	GenerationID   int64    `json:"generation_id,omitempty"`
 }
 
 type TaskSaveRequest struct {
@@ -17,23 +32,43 @@ type TaskSaveRequest struct {
 	Language       string `json:"language"`
 	Level          string `json:"level"`
 	TimeEstimation int    `json:"time_estimated"`
+	TimeLimit      int    `json:"time_limit"`
+	Topic          string `json:"topic"`
+	MultiFile      bool   `json:"multi_file"`
+	GenerationID   int64  `json:"generation_id"`
+}
+
+type TaskImportRequest struct {
+	Language    string `json:"language"`
+	Description string `json:"description"`
+	StarterCode string `json:"starter_code"`
+	Tests       string `json:"tests"`
+	Comment     string `json:"comment"`
 }
 
 type TaskEvaluationRequest struct {
-	UserID         int    `json:"user_id"`
-	TaskID         int    `json:"task_id"`
-	Code           string `json:"code"`
-	Level          string `json:"level"`
-	Language       string `json:"language"`
-	Task           string `json:"task"`
-	UseAI          bool   `json:"use_ai"`
-	TimeEstimation int    `json:"time_estimation"`
-	TimeSpent      int    `json:"time_spent"`
+	UserID         int        `json:"user_id"`
+	TaskID         int        `json:"task_id"`
+	Code           string     `json:"code"`
+	Level          string     `json:"level"`
+	Language       string     `json:"language"`
+	Task           string     `json:"task"`
+	UseAI          bool       `json:"use_ai"`
+	TimeEstimation int        `json:"time_estimation"`
+	TimeSpent      int        `json:"time_spent"`
+	Files          []CodeFile `json:"files"`
 }
 
 type TaskEvaluation struct {
-	Rating         string `json:"rating"`
-	Mark           string `json:"mark"`
-	TimeComparison string `json:"time_comparison"`
-	Solution       string `json:"solution"`
+	Rating         string        `json:"rating"`
+	Mark           string        `json:"mark"`
+	TimeComparison string        `json:"time_comparison"`
+	Solution       string        `json:"solution"`
+	LatePenalty    float64       `json:"late_penalty,omitempty"`
+	Samples        int           `json:"samples,omitempty"`
+	Spread         *float64      `json:"spread,omitempty"`
+	Confidence     *float64      `json:"confidence,omitempty"`
+	NeedsReview    bool          `json:"needs_review,omitempty"`
+	AIReliance     *AIReliance   `json:"ai_reliance,omitempty"`
+	Analysis       *CodeAnalysis `json:"analysis,omitempty"`
 }
@@ -5,6 +5,24 @@ type Credentials struct {
 	Password string `json:"password"`
 }
 
+// LoginRequest enthält nach wiederholten Fehlversuchen zusätzlich die gelöste Challenge.
+type LoginRequest struct {
+	Username  string `json:"username"`
+	Password  string `json:"password"`
+	Challenge string `json:"challenge"`
+	Nonce     string `json:"nonce"`
+}
+
+type LoginAttempt struct {
+	ID        int    `db:"id" json:"id"`
+	Username  string `db:"username" json:"username"`
+	UserID    *int   `db:"user_id" json:"user_id"`
+	IP        string `db:"ip" json:"ip"`
+	Success   bool   `db:"success" json:"success"`
+	Reason    string `db:"reason" json:"reason"`
+	CreatedAt int64  `db:"created_at" json:"created_at"`
+}
+
 type Stats struct {
 	AvgMark        float64 `db:"avg_mark" json:"avg_mark"`
 	AIUsageRate    float64 `db:"ai_usage_rate" json:"ai_usage_rate"`
@@ -30,6 +48,9 @@ type StatsLanguage struct {
 	AIWithoutUsage int            `json:"ai_without_usage"`
 	TaskLevels     map[string]int `json:"task_levels"`
 	AvgMark        float64        `json:"avg_mark"`
+	Quizzes        int            `json:"quizzes"`
+	QuizAvgScore   float64        `json:"quiz_avg_score"`
+	Rating         *SkillRating   `json:"rating"`
 }
 
 type Tasks []struct {
@@ -42,6 +63,9 @@ type Tasks []struct {
 	TimeSpent     *int     `db:"time_spent" json:"time_spent"`
 	TimeEstimated int      `db:"time_estimated" json:"time_estimated"`
 	Rating        *string  `db:"rating" json:"rating"`
+	Similarity    *float64 `db:"similarity" json:"similarity"`
+	TaskType      string   `db:"task_type" json:"task_type"`
+	UserProvided  bool     `db:"user_provided" json:"user_provided"`
 }
 
 type Task struct {
@@ -49,24 +73,46 @@ type Task struct {
 	Description   string            `json:"description" db:"description"`
 	Level         string            `json:"level" db:"level"`
 	Language      string            `json:"language" db:"language"`
+	SolutionID    *int              `json:"solution_id" db:"solution_id"`
 	Mark          *float64          `json:"mark" db:"mark"`
+	AIMark        *float64          `json:"ai_mark" db:"ai_mark"`
+	GradedBy      *int              `json:"graded_by" db:"graded_by"`
 	Rating        *string           `json:"rating" db:"rating"`
 	TimeSpent     *int              `json:"time_spent" db:"time_spent"`
 	TimeEstimated int               `json:"time_estimated" db:"time_estimated"`
 	AIUsage       int               `json:"ai_usage" db:"ai_usage"`
+	AIReliance    *float64          `json:"ai_reliance" db:"ai_reliance"`
 	Code          *string           `json:"code" db:"code"`
+	CatalogTaskID *int              `json:"catalog_task_id" db:"catalog_task_id"`
+	Similarity    *float64          `json:"similarity" db:"similarity"`
+	MultiFile     bool              `json:"multi_file" db:"multi_file"`
+	TaskType      string            `json:"task_type" db:"task_type"`
+	StarterCode   *string           `json:"starter_code" db:"starter_code"`
+	StarterFiles  []CodeFile        `json:"starter_files,omitempty" db:"-"`
+	EntryPoints   []string          `json:"entry_points" db:"-"`
+	EntryPointsDB *string           `json:"-" db:"entry_points"`
+	Tests         *string           `json:"tests" db:"tests"`
+	UserProvided  bool              `json:"user_provided" db:"user_provided"`
+	SourceText    *string           `json:"source_text" db:"source_text"`
+	Files         []CodeFile        `json:"files" db:"-"`
+	MeasuredTime  int               `json:"measured_time_spent" db:"-"`
 	Interactions  []TaskInteraction `json:"interactions"`
+	Comments      []SolutionComment `json:"comments" db:"-"`
 }
 
 type TaskInteraction struct {
-	ID            int    `json:"id" db:"id"`
-	UserID        int    `json:"user_id" db:"user_id"`
-	TaskID        int    `json:"task_id" db:"task_id"`
-	Role          string `json:"role" db:"role"`
-	Content       string `json:"content" db:"content"`
-	TimeRemaining *int   `json:"time_remaining" db:"time_remaining"`
-	TimeSpent     *int   `json:"time_spent" db:"time_spent"`
-	CategoryID    *int   `json:"category_id" db:"category_id"`
+	ID            int            `json:"id" db:"id"`
+	UserID        int            `json:"user_id" db:"user_id"`
+	TaskID        int            `json:"task_id" db:"task_id"`
+	Role          string         `json:"role" db:"role"`
+	Content       string         `json:"content" db:"content"`
+	TimeRemaining *int           `json:"time_remaining" db:"time_remaining"`
+	TimeSpent     *int           `json:"time_spent" db:"time_spent"`
+	CategoryID    *int           `json:"category_id" db:"category_id"`
+	Code          *string        `json:"code" db:"code"`
+	Selection     *CodeSelection `json:"selection" db:"selection"`
+	RunOutput     *string        `json:"run_output" db:"run_output"`
+	CreatedAt     *int64         `json:"created_at" db:"created_at"`
 }
 
 type ChangeUsername struct {
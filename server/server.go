@@ -5,20 +5,18 @@ import (
 	"github.com/gin-contrib/cors"
 	"log"
 	"os"
+	"time"
 
 	"github.com/gin-gonic/gin"
-	"github.com/ulule/limiter/v3"
-	ginlimiter "github.com/ulule/limiter/v3/drivers/middleware/gin"
-	"github.com/ulule/limiter/v3/drivers/store/memory"
 )
 
 func NewServer() {
 	r := gin.Default()
 
-	rate, _ := limiter.NewRateFromFormatted("10-M")
-	store := memory.NewStore()
-	rateLimiter := ginlimiter.NewMiddleware(limiter.New(store, rate))
-	r.Use(rateLimiter)
+	go handlers.RunSessionSweeper(time.Minute)
+	go handlers.RunRateLimitSweeper(10 * time.Minute)
+	go handlers.RunAppealSweeper(5 * time.Minute)
+	go handlers.RunLoginAttemptSweeper(time.Hour)
 
 	r.Use(cors.New(cors.Config{
 		AllowOrigins: []string{
@@ -35,42 +33,147 @@ func NewServer() {
 			"Content-Length",
 			"Content-Type",
 			"Authorization",
+			"X-Admin-Key",
+		},
+		ExposeHeaders: []string{
+			"X-RateLimit-Limit",
+			"X-RateLimit-Remaining",
+			"X-RateLimit-Reset",
+			"RateLimit-Limit",
+			"RateLimit-Remaining",
+			"RateLimit-Reset",
+			"RateLimit-Policy",
+			"Retry-After",
 		},
 		AllowCredentials: true,
 	}))
 
+	r.Use(handlers.RateLimit("default"))
+
+	authLimit := handlers.RateLimit("auth")
+	generateLimit := handlers.RateLimit("generate")
+	evaluateLimit := handlers.RateLimit("evaluate")
+	chatLimit := handlers.RateLimit("chat")
+	statsLimit := handlers.RateLimit("stats")
+
 	api := r.Group("/api")
 	{
-		api.POST("/register", handlers.RegisterUser)
-		api.POST("/login", handlers.LoginUser)
+		api.POST("/register", authLimit, handlers.RegisterUser)
+		api.POST("/login", authLimit, handlers.LoginUser)
+		api.GET("/login/challenge", authLimit, handlers.GetLoginChallenge)
+		api.POST("/logout", authLimit, handlers.LogoutUser)
+		api.POST("/admin/role", authLimit, handlers.AdminOnly, handlers.SetUserRole)
+		api.GET("/admin/login-attempts", authLimit, handlers.AdminOnly, handlers.GetLoginAttempts)
 
-		api.POST("/interact", handlers.CreateInteraction)
+		api.POST("/interact", handlers.AuthRequired, chatLimit, handlers.CreateInteraction)
 
 		task := api.Group("/task")
 		{
-			task.POST("/generate", handlers.GenerateTask)
-			task.POST("/save", handlers.SaveTask)
-			task.POST("/evaluate", handlers.EvaluateTask)
+			task.GET("/types", handlers.GetTaskTypes)
+			task.POST("/generate", handlers.AuthRequired, generateLimit, handlers.GenerateTask)
+			task.POST("/save", handlers.AuthRequired, handlers.SaveTask)
+			task.POST("/import", handlers.AuthRequired, generateLimit, handlers.ImportTask)
+			task.POST("/evaluate", handlers.AuthRequired, evaluateLimit, handlers.EvaluateTask)
+			task.GET("/next", handlers.AuthRequired, handlers.UserAccess, handlers.GetNextTask)
+			task.POST("/next/generate", handlers.AuthRequired, generateLimit, handlers.GenerateNextTask)
+			task.POST("/snapshot", handlers.AuthRequired, handlers.SaveCodeSnapshot)
+			task.GET("/:task_id/replay", handlers.AuthRequired, handlers.TaskAccess, handlers.ReplayTask)
+			task.GET("/:task_id/timeline", handlers.AuthRequired, handlers.TaskAccess, handlers.GetTaskTimeline)
+			task.POST("/session", handlers.AuthRequired, handlers.UpdateTaskSession)
+			task.GET("/:task_id/session", handlers.AuthRequired, handlers.TaskAccess, handlers.GetTaskSession)
+			task.POST("/:task_id/zip", handlers.AuthRequired, handlers.TaskAccess, handlers.UploadTaskZip)
+		}
+
+		catalog := api.Group("/catalog")
+		{
+			catalog.GET("", handlers.SearchCatalog)
+			catalog.GET("/topics", handlers.GetCatalogTopics)
+			catalog.GET("/:catalog_id", handlers.GetCatalogTask)
+			catalog.POST("/:catalog_id/start", handlers.AuthRequired, handlers.StartCatalogTask)
+			catalog.POST("", handlers.AdminOnly, handlers.CreateCatalogTask)
+			catalog.POST("/promote", handlers.AdminOnly, handlers.PromoteTask)
 		}
 
-		chat := api.Group("/chat")
+		paths := api.Group("/paths")
+		{
+			paths.GET("", handlers.GetLearningPaths)
+			paths.GET("/:path_id", handlers.GetLearningPath)
+			paths.GET("/:path_id/progress", handlers.AuthRequired, handlers.UserAccess, handlers.GetLearningPathProgress)
+			paths.POST("", handlers.AuthRequired, handlers.RequireRole("teacher", "admin"), handlers.CreateLearningPath)
+		}
+
+		chat := api.Group("/chat", handlers.AuthRequired, chatLimit)
 		{
 			chat.POST("/task-question", handlers.TaskSendChat)
 		}
 
+		course := api.Group("/course", handlers.AuthRequired)
+		{
+			course.GET("", handlers.GetCourses)
+			course.POST("", handlers.RequireRole("teacher", "admin"), handlers.CreateCourse)
+			course.POST("/join", handlers.JoinCourse)
+			course.GET("/:course_id/members", handlers.GetCourseMembers)
+			course.POST("/:course_id/members/:user_id/remove", handlers.RemoveCourseMember)
+			course.POST("/:course_id/invite-code", handlers.RenewInviteCode)
+			course.GET("/:course_id/assignments", handlers.GetAssignments)
+			course.POST("/:course_id/assignments", handlers.CreateAssignment)
+			course.POST("/:course_id/assignments/:assignment_id/start", handlers.StartAssignment)
+			course.GET("/:course_id/assignments/:assignment_id/submissions", handlers.GetAssignmentSubmissions)
+			course.GET("/:course_id/similarity", handlers.GetSimilarityReport)
+			course.GET("/:course_id/similarity/:flag_id", handlers.GetSimilarityMatch)
+		}
+
+		solution := api.Group("/solution/:solution_id", handlers.AuthRequired, handlers.SolutionAccess)
+		{
+			solution.GET("/grades", handlers.GetSolutionGrades)
+			solution.GET("/comments", handlers.GetSolutionComments)
+			solution.GET("/diagnostics", handlers.GetSolutionDiagnostics)
+			solution.GET("/zip", handlers.DownloadSolutionZip)
+			solution.POST("/override", handlers.RequireRole("teacher", "admin"), handlers.OverrideGrade)
+			solution.POST("/comments", handlers.RequireRole("teacher", "admin"), handlers.AddSolutionComment)
+			solution.POST("/appeal", evaluateLimit, handlers.FileAppeal)
+		}
+
+		appeals := api.Group("/appeals", handlers.AuthRequired, handlers.RequireRole("teacher", "admin"))
+		{
+			appeals.GET("", handlers.GetAppealQueue)
+			appeals.POST("/:appeal_id/resolve", handlers.ResolveAppeal)
+		}
+
+		evaluation := api.Group("/evaluation", handlers.AuthRequired, handlers.RequireRole("teacher", "admin"))
+		{
+			evaluation.GET("/settings", handlers.GetEvaluationSettings)
+			evaluation.POST("/settings", handlers.SaveEvaluationSettings)
+			evaluation.GET("/flagged", handlers.GetFlaggedEvaluations)
+		}
+
+		quiz := api.Group("/quiz", handlers.AuthRequired)
+		{
+			quiz.POST("/generate", generateLimit, handlers.GenerateQuiz)
+			quiz.GET("/:quiz_id", handlers.QuizAccess, handlers.GetQuiz)
+			quiz.POST("/:quiz_id/submit", handlers.QuizAccess, handlers.SubmitQuiz)
+		}
+
 		user := api.Group("/user")
 		{
-			user.GET("/tasks", handlers.GetUserTasks)
-			user.GET("/task/:task_id", handlers.GetSingleTask)
+			user.GET("/tasks", handlers.AuthRequired, handlers.UserAccess, handlers.GetUserTasks)
+			user.GET("/task/:task_id", handlers.AuthRequired, handlers.TaskAccess, handlers.GetSingleTask)
+			user.GET("/ratings", handlers.AuthRequired, handlers.UserAccess, handlers.GetUserRatings)
+			user.GET("/quizzes", handlers.AuthRequired, handlers.UserAccess, handlers.GetUserQuizzes)
+			user.GET("/ratings/history", handlers.AuthRequired, handlers.UserAccess, handlers.GetUserRatingHistory)
+			user.GET("/review", handlers.AuthRequired, handlers.UserAccess, handlers.GetReviewQueue)
+			user.GET("/appeals", handlers.AuthRequired, handlers.UserAccess, handlers.GetUserAppeals)
+			user.GET("/notifications", handlers.AuthRequired, handlers.UserAccess, handlers.GetNotifications)
+			user.POST("/notifications/read", handlers.AuthRequired, handlers.MarkNotificationsRead)
 
-			stats := user.Group("/stats")
+			stats := user.Group("/stats", handlers.AuthRequired, handlers.UserAccess, statsLimit)
 			{
 				stats.GET("/general", handlers.GetUserStats)
 				stats.GET("/full", handlers.GetUserStatsFull)
 				stats.GET("/language", handlers.GetUserStatsLanguage)
 			}
 
-			settings := user.Group("/settings")
+			settings := user.Group("/settings", handlers.AuthRequired)
 			{
 				settings.POST("/change-username", handlers.ChangeUsername)
 				settings.POST("/change-password", handlers.ChangePassword)